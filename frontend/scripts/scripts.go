@@ -2,11 +2,12 @@ package main
 
 import (
 	"bytes"
-	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
@@ -18,7 +19,6 @@ const DIVIDER = "#"
 
 func main() {
 	document := dom.GetWindow().Document()
-	populateAllJobs(document, "")
 
 	addRowBtn := document.GetElementByID("addRowBtn")
 	submitBtn := document.GetElementByID("submitBtn")
@@ -32,54 +32,174 @@ func main() {
 	cancelBtn.AddEventListener("click", true, func(e dom.Event) {
 		hideUserInput(document)
 	})
+	showTrashBtn := document.GetElementByID("showTrashBtn")
+	showTrashBtn.AddEventListener("click", true, func(e dom.Event) {
+		showTrash(document)
+	})
+	closeTrashBtn := document.GetElementByID("closeTrashBtn")
+	closeTrashBtn.AddEventListener("click", true, func(e dom.Event) {
+		hideTrash(document)
+	})
+	showQuotesBtn := document.GetElementByID("showQuotesBtn")
+	showQuotesBtn.AddEventListener("click", true, func(e dom.Event) {
+		showQuotes(document)
+	})
+	closeQuotesBtn := document.GetElementByID("closeQuotesBtn")
+	closeQuotesBtn.AddEventListener("click", true, func(e dom.Event) {
+		hideQuotes(document)
+	})
+	createQuoteBtn := document.GetElementByID("createQuoteBtn")
+	createQuoteBtn.AddEventListener("click", true, func(e dom.Event) {
+		submitQuote(document)
+	})
+	searchInput := document.GetElementByID("searchInput").(*dom.HTMLInputElement)
+	searchInput.AddEventListener("input", true, func(e dom.Event) {
+		search(document, searchInput.Value)
+	})
+	closeSearchBtn := document.GetElementByID("closeSearchBtn")
+	closeSearchBtn.AddEventListener("click", true, func(e dom.Event) {
+		hideSearch(document)
+	})
+	closeHistoryBtn := document.GetElementByID("closeHistoryBtn")
+	closeHistoryBtn.AddEventListener("click", true, func(e dom.Event) {
+		hideHistory(document)
+	})
 
-	statusDropdown := document.GetElementByID("statusDropdown").(*dom.HTMLSelectElement)
-	populateStatusDropdownOptions(document, statusDropdown, "")
+	go func(document dom.Document) {
+		loadStatuses()
+		populateAllJobs(document)
+		statusDropdown := document.GetElementByID("statusDropdown").(*dom.HTMLSelectElement)
+		populateStatusDropdownOptions(document, statusDropdown, "")
+		filterStatusDropdown := document.GetElementByID("filterStatusDropdown").(*dom.HTMLSelectElement)
+		populateStatusDropdownOptions(document, filterStatusDropdown, "")
+		filterStatusDropdown.SelectedIndex = -1
+	}(document)
 	customerDropdown := document.GetElementByID("customerDropdown").(*dom.HTMLSelectElement)
 	populateCustomerDropdownOptions(document, customerDropdown, "")
+	quoteCustomerDropdown := document.GetElementByID("quoteCustomerDropdown").(*dom.HTMLSelectElement)
+	populateCustomerDropdownOptions(document, quoteCustomerDropdown, "")
 	addCustomerFilter(document)
 }
 
 func addCustomerFilter(document dom.Document) {
 	filterCustomerDropdown := document.GetElementByID("filterCustomerDropdown").(*dom.HTMLSelectElement)
 	populateCustomerDropdownOptions(document, filterCustomerDropdown, "")
-	filterCustomerDropdown.AddEventListener("change", true, func(e dom.Event) {
-		filter := filterCustomerDropdown.SelectedOptions()[0].Value
-		go func(document dom.Document, filter string) {
-			if filter == "All" {
-				populateAllJobs(document, "")
-				return
-			}
-			if filter == "Unknown" {
-				populateAllJobs(document, "unknown")
-				return
-			}
-			resp, err := http.Get(fmt.Sprintf("/customers/search?name=%s", filter))
-			if err != nil {
-				log.Fatal(err)
-			}
-			customer, err := jobs.NewCustomerSearchResponse(resp)
-			if err != nil {
-				log.Fatal(err)
-			}
-			populateAllJobs(document, customer.ID)
-		}(document, filter)
+	refilter := func(e dom.Event) {
+		jobsOffset = 0
+		populateAllJobs(document)
+	}
+	for _, id := range []string{"filterCustomerDropdown", "filterStatusDropdown",
+		"filterOrderedFromInput", "filterOrderedToInput", "filterDueFromInput", "filterDueToInput",
+		"filterOverdueCheck", "sortDropdown", "sortOrderDropdown"} {
+		document.GetElementByID(id).AddEventListener("change", true, refilter)
+	}
+	document.GetElementByID("filterTextInput").AddEventListener("input", true, refilter)
+	document.GetElementByID("prevPageBtn").AddEventListener("click", true, func(e dom.Event) {
+		jobsOffset -= jobsPageSize
+		if jobsOffset < 0 {
+			jobsOffset = 0
+		}
+		populateAllJobs(document)
 	})
+	document.GetElementByID("nextPageBtn").AddEventListener("click", true, func(e dom.Event) {
+		jobsOffset += jobsPageSize
+		populateAllJobs(document)
+	})
+	document.GetElementByID("exportBtn").AddEventListener("click", true, func(e dom.Event) {
+		// Export all the jobs matching the filters, not just this page.
+		query := readJobQuery(document)
+		query.Offset, query.Limit = 0, 0
+		v := query.Values()
+		v.Set("format", document.GetElementByID("exportFormatDropdown").(*dom.HTMLSelectElement).Value)
+		dom.GetWindow().Location().Href = "/jobs/export?" + v.Encode()
+	})
+}
+
+// jobsPageSize is how many jobs the jobs table shows at a time.
+const jobsPageSize = 50
+
+// jobsOffset is how many jobs come before the ones in the jobs table.
+var jobsOffset int
+
+// readJobQuery returns the query for the jobs the filters ask for.
+func readJobQuery(document dom.Document) *jobs.JobQuery {
+	value := func(id string) string {
+		switch el := document.GetElementByID(id).(type) {
+		case *dom.HTMLSelectElement:
+			return el.Value
+		case *dom.HTMLInputElement:
+			return el.Value
+		}
+		return ""
+	}
+	day := func(id string) *time.Time {
+		if v := value(id); v != "" {
+			return jobs.GetFormattedDate(v)
+		}
+		return nil
+	}
+	query := &jobs.JobQuery{
+		CustomerID:  value("filterCustomerDropdown"),
+		OrderedFrom: day("filterOrderedFromInput"),
+		OrderedTo:   day("filterOrderedToInput"),
+		DueFrom:     day("filterDueFromInput"),
+		DueTo:       day("filterDueToInput"),
+		Text:        strings.TrimSpace(value("filterTextInput")),
+		Overdue:     document.GetElementByID("filterOverdueCheck").(*dom.HTMLInputElement).Checked,
+		Sort:        value("sortDropdown"),
+		Desc:        value("sortOrderDropdown") == "desc",
+		Offset:      jobsOffset,
+		Limit:       jobsPageSize,
+	}
+	if query.CustomerID == unknownCustomer {
+		query.CustomerID = jobs.NoCustomer
+	}
+	for _, o := range document.GetElementByID("filterStatusDropdown").(*dom.HTMLSelectElement).SelectedOptions() {
+		query.Statuses = append(query.Statuses, o.Value)
+	}
+	return query
+}
+
+// loadStatuses replaces the default job statuses with the ones
+// configured on the server. It blocks, so call it from a goroutine.
+func loadStatuses() {
+	resp, err := http.Get("/statuses")
+	if err != nil {
+		log.Fatal(err)
+	}
+	statuses, err := jobs.NewJobStatusesResponse(resp)
+	if err != nil {
+		log.Fatal(err)
+	}
+	jobs.JobStatusList = statuses
 }
 
+// populateStatusDropdownOptions offers the statuses a job in the
+// status currentValue can move to, or all of them for new jobs.
 func populateStatusDropdownOptions(document dom.Document,
 	statusDropdown *dom.HTMLSelectElement,
 	currentValue string) {
-	for i, c := range jobs.JobStatusList {
-		o := document.CreateElement("option")
-		o.SetTextContent(c)
+	current := jobs.GetJobStatus(currentValue)
+	i := 0
+	for _, c := range jobs.JobStatusList {
+		if current != nil && !current.CanMoveTo(c.Key) {
+			continue
+		}
+		o := document.CreateElement("option").(*dom.HTMLOptionElement)
+		o.Value = c.Key
+		o.SetTextContent(c.Label)
 		statusDropdown.AppendChild(o)
-		if c == currentValue {
+		if c.Key == currentValue {
 			statusDropdown.SelectedIndex = i
 		}
+		i++
 	}
 }
 
+// unknownCustomer is the value of the customer dropdown option
+// for jobs without a customer. The other options hold customer IDs.
+const unknownCustomer = "Unknown"
+
 func populateCustomerDropdownOptions(document dom.Document,
 	customerDropdown *dom.HTMLSelectElement,
 	currentValue string) {
@@ -103,13 +223,15 @@ func populateCustomerDropdownOptionsCallback(document dom.Document,
 	customerDropdown *dom.HTMLSelectElement,
 	customers []*jobs.Customer,
 	currentValue string) {
-	o := document.CreateElement("option")
+	o := document.CreateElement("option").(*dom.HTMLOptionElement)
+	o.Value = unknownCustomer
 	o.SetTextContent("Unknown")
 	customerDropdown.AppendChild(o)
 	customerDropdown.SelectedIndex = 0
 
 	for i, c := range customers {
-		o := document.CreateElement("option")
+		o := document.CreateElement("option").(*dom.HTMLOptionElement)
+		o.Value = c.ID
 		o.SetTextContent(c.Name)
 		customerDropdown.AppendChild(o)
 		if c.ID == currentValue {
@@ -118,38 +240,47 @@ func populateCustomerDropdownOptionsCallback(document dom.Document,
 	}
 }
 
-func populateAllJobs(document dom.Document, filter string) {
-	go func(callback func(document dom.Document, jobs []*jobs.Job)) {
-		url := "/jobs"
-		if filter != "" {
-			url = fmt.Sprintf("/jobs?customerID=%s", filter)
-		}
-		resp, err := http.Get(url)
-		if err != nil {
-			log.Fatal(err)
+// populateAllJobs shows the page of jobs the filters ask for.
+func populateAllJobs(document dom.Document) {
+	query := readJobQuery(document)
+	go func(callback func(document dom.Document, jobs []*jobs.Job, total int)) {
+		resp, err := http.Get("/jobs?" + query.Values().Encode())
+		if err := jobs.CheckResponse(resp, err, http.StatusOK); err != nil {
+			dom.GetWindow().Alert(fmt.Sprintf("Loading the jobs failed: %v", err))
+			return
 		}
-		jobs, err := jobs.NewJobsResponse(resp)
+		total, _ := strconv.Atoi(resp.Header.Get(jobs.TotalCountHeader))
+		jobsList, err := jobs.NewJobsResponse(resp)
 		if err != nil {
 			log.Fatal(err)
 		}
-		callback(document, jobs)
+		callback(document, jobsList, total)
 	}(populateJobsCallback)
 }
 
-func populateJobsCallback(document dom.Document, jobs []*jobs.Job) {
+func populateJobsCallback(document dom.Document, jobsList []*jobs.Job, total int) {
+	pageInfo := "No jobs match"
+	if len(jobsList) > 0 {
+		pageInfo = fmt.Sprintf("Jobs %d to %d of %d", jobsOffset+1, jobsOffset+len(jobsList), total)
+	}
+	document.GetElementByID("pageInfo").SetTextContent(pageInfo)
+	document.GetElementByID("prevPageBtn").(*dom.HTMLButtonElement).Disabled = jobsOffset == 0
+	document.GetElementByID("nextPageBtn").(*dom.HTMLButtonElement).Disabled = jobsOffset+len(jobsList) >= total
+
 	newBody := document.CreateElement("tbody")
 	ts := newBody.(*dom.HTMLTableSectionElement)
-	for _, e := range jobs {
+	for _, e := range jobsList {
 		populateJob(document, ts, e)
 	}
 	oldBody := document.GetElementByID("jobsTable").GetElementsByTagName("tbody")[0]
 	document.GetElementByID("jobsTable").ReplaceChild(newBody, oldBody)
+	document.GetElementByID("viewTotal").SetTextContent(formatTotals(jobs.SumTotals(jobsList)))
 }
 
 func populateJob(document dom.Document,
 	tableSection *dom.HTMLTableSectionElement,
 	job *jobs.Job) {
-	row := tableSection.InsertRow(0)
+	row := tableSection.InsertRow(-1)
 	row.SetID(createElementID("row", job.ID))
 
 	// Order Date
@@ -164,7 +295,10 @@ func populateJob(document dom.Document,
 	orderDatePicker.AddEventListener("change", true, func(e dom.Event) {
 		jobId := extractJobIDFromElement(orderDatePicker.ID())
 		newOrderDate := orderDatePicker.Value
-		job := jobs.NewJob(newOrderDate, "", "", "", "")
+		if newOrderDate == "" {
+			return
+		}
+		job := &jobs.Job{OrderDate: jobs.GetFormattedDate(newOrderDate)}
 		updateJob(document, jobId, job)
 	})
 
@@ -180,7 +314,10 @@ func populateJob(document dom.Document,
 	deadlineDatePicker.AddEventListener("change", true, func(e dom.Event) {
 		jobId := extractJobIDFromElement(deadlineDatePicker.ID())
 		newDeadlineDate := deadlineDatePicker.Value
-		job := jobs.NewJob("", newDeadlineDate, "", "", "")
+		if newDeadlineDate == "" {
+			return
+		}
+		job := &jobs.Job{DeadlineDate: jobs.GetFormattedDate(newDeadlineDate)}
 		updateJob(document, jobId, job)
 	})
 
@@ -195,7 +332,7 @@ func populateJob(document dom.Document,
 	statusSelectElement.AddEventListener("change", true, func(e dom.Event) {
 		jobId := extractJobIDFromElement(statusSelectElement.ID())
 		newStatus := statusSelectElement.SelectedOptions()[0].Value
-		job := jobs.NewJob("", "", newStatus, "", "")
+		job := &jobs.Job{Status: newStatus}
 		updateJob(document, jobId, job)
 	})
 
@@ -209,45 +346,30 @@ func populateJob(document dom.Document,
 	customerCell.AppendChild(customerSelectElement)
 	customerSelectElement.AddEventListener("change", true, func(e dom.Event) {
 		jobId := extractJobIDFromElement(customerSelectElement.ID())
+		// The job service takes unknownCustomer to mean no customer.
 		newCustomer := customerSelectElement.SelectedOptions()[0].Value
-		go func(document dom.Document, newCustomer string, jobId string) {
-			newJob := jobs.NewJob("", "", "", "Unknown", "")
-			if newCustomer != "Unknown" {
-				resp, err := http.Get(fmt.Sprintf("/customers/search?name=%s", newCustomer))
-				if err != nil {
-					log.Fatal(err)
-				}
-				customer, err := jobs.NewCustomerSearchResponse(resp)
-				if err != nil {
-					log.Fatal(err)
-				}
-				newJob = jobs.NewJob("", "", "", customer.ID, "")
-			}
-			updateJob(document, jobId, newJob)
-		}(document, newCustomer, jobId)
+		updateJob(document, jobId, &jobs.Job{CustomerID: newCustomer})
 	})
 
 	// Description
-	decodedDescription, err := base64.StdEncoding.DecodeString(job.Description)
-	if err != nil {
-		log.Fatal(err)
-	}
 	descriptionCell := row.InsertCell(4)
-	descriptionCell.SetContentEditable("true")
 	descriptionTextArea := document.CreateElement("textarea").(*dom.HTMLTextAreaElement)
 	descriptionTextArea.SetID(createElementID("descriptionText", job.ID))
 	descriptionTextArea.Class().Add("form-control")
-	descriptionCell.AppendChild(descriptionTextArea)
-	descriptionTextArea.SetTextContent(string(decodedDescription))
+	descriptionTextArea.SetTextContent(job.Description)
+	appendMarkdownEditor(document, descriptionCell, descriptionTextArea)
 	descriptionTextArea.AddEventListener("change", true, func(e dom.Event) {
 		jobId := extractJobIDFromElement(descriptionTextArea.ID())
 		newDescription := descriptionTextArea.Value
-		job := jobs.NewJob("", "", "", "", newDescription)
+		job := &jobs.Job{Description: newDescription}
 		updateJob(document, jobId, job)
 	})
 
+	// Total
+	row.InsertCell(5).SetTextContent(formatTotals(job.Totals))
+
 	// Delete button
-	actionCell := row.InsertCell(5)
+	actionCell := row.InsertCell(6)
 	deleteBtn := document.CreateElement("button").(*dom.HTMLButtonElement)
 	deleteBtn.SetID(createElementID("deleteBtn", job.ID))
 	deleteBtn.Class().Add("btn")
@@ -257,16 +379,221 @@ func populateJob(document dom.Document,
 	actionCell.AppendChild(deleteBtn)
 	deleteBtn.AddEventListener("click", true, func(e dom.Event) {
 		jobId := extractJobIDFromElement(deleteBtn.ID())
-		answer := dom.GetWindow().Confirm("Are you sure you want to delete row?")
+		answer := dom.GetWindow().Confirm("Are you sure you want to move this row to the trash?")
 		if answer {
 			deleteJob(jobId, document)
 		}
 	})
 
+	// History button
+	historyBtn := document.CreateElement("button").(*dom.HTMLButtonElement)
+	historyBtn.SetID(createElementID("historyBtn", job.ID))
+	historyBtn.Class().Add("btn")
+	historyBtn.Class().Add("btn-secondary")
+	historyBtn.Class().Add("mt-2")
+	historyBtn.SetTextContent("History")
+	actionCell.AppendChild(historyBtn)
+	historyBtn.AddEventListener("click", true, func(e dom.Event) {
+		jobId := extractJobIDFromElement(historyBtn.ID())
+		showHistory(document, jobId)
+	})
+
+	// Items button
+	itemsBtn := document.CreateElement("button").(*dom.HTMLButtonElement)
+	itemsBtn.SetID(createElementID("itemsBtn", job.ID))
+	itemsBtn.Class().Add("btn")
+	itemsBtn.Class().Add("btn-outline-dark")
+	itemsBtn.Class().Add("mt-2")
+	itemsBtn.SetTextContent(fmt.Sprintf("Items (%d)", len(job.Items)))
+	actionCell.AppendChild(itemsBtn)
+	itemsBtn.AddEventListener("click", true, func(e dom.Event) {
+		toggleItems(document, row, job)
+	})
+
+	// Shipping label button
+	if job.CustomerID != "" {
+		labelBtn := document.CreateElement("button").(*dom.HTMLButtonElement)
+		labelBtn.SetID(createElementID("labelBtn", job.ID))
+		labelBtn.Class().Add("btn")
+		labelBtn.Class().Add("btn-outline-secondary")
+		labelBtn.Class().Add("mt-2")
+		labelBtn.SetTextContent("Label 📦")
+		actionCell.AppendChild(labelBtn)
+		labelBtn.AddEventListener("click", true, func(e dom.Event) {
+			jobId := extractJobIDFromElement(labelBtn.ID())
+			dom.GetWindow().Open(fmt.Sprintf("/jobs/%s/label.html", jobId), "_blank", "")
+		})
+	}
+
+	// Invoice button
+	if canInvoice(job) {
+		invoiceBtn := document.CreateElement("button").(*dom.HTMLButtonElement)
+		invoiceBtn.SetID(createElementID("invoiceBtn", job.ID))
+		invoiceBtn.Class().Add("btn")
+		invoiceBtn.Class().Add("btn-success")
+		invoiceBtn.Class().Add("mt-2")
+		invoiceBtn.SetTextContent("Invoice 🧾")
+		actionCell.AppendChild(invoiceBtn)
+		invoiceBtn.AddEventListener("click", true, func(e dom.Event) {
+			jobId := extractJobIDFromElement(invoiceBtn.ID())
+			createInvoice(document, jobId)
+		})
+	}
+
 	// At the end apply the style
 	applyRowStyle(row, job)
 }
 
+// formatTotals shows the total of t, with the tax it includes.
+func formatTotals(t jobs.Totals) string {
+	if t.Tax == 0 {
+		return jobs.FormatCents(t.Total)
+	}
+	return fmt.Sprintf("%s (incl. %s tax)", jobs.FormatCents(t.Total), jobs.FormatCents(t.Tax))
+}
+
+// toggleItems shows the line items of job in an editable table in a row
+// below its own, or hides them if they are already showing.
+func toggleItems(document dom.Document, row *dom.HTMLTableRowElement, job *jobs.Job) {
+	itemsRowID := createElementID("items", job.ID)
+	if itemsRow := document.GetElementByID(itemsRowID); itemsRow != nil {
+		itemsRow.ParentNode().RemoveChild(itemsRow)
+		return
+	}
+	tableSection := row.ParentElement().(*dom.HTMLTableSectionElement)
+	itemsRow := tableSection.InsertRow(row.SectionRowIndex + 1)
+	itemsRow.SetID(itemsRowID)
+	cell := itemsRow.InsertCell(0)
+	cell.ColSpan = 7
+	appendItemsEditor(document, cell, job.Items, func(items []*jobs.LineItem) {
+		updateJob(document, job.ID, &jobs.Job{Items: items})
+	})
+}
+
+// appendItemsEditor adds an editable table of the line items to
+// parent, with a button that calls save with the edited items.
+func appendItemsEditor(document dom.Document, parent dom.Element,
+	lineItems []*jobs.LineItem, save func(items []*jobs.LineItem)) {
+	itemsTable := document.CreateElement("table").(*dom.HTMLTableElement)
+	itemsTable.Class().Add("table")
+	itemsTable.Class().Add("table-sm")
+	head := document.CreateElement("thead").(*dom.HTMLTableSectionElement)
+	itemsTable.AppendChild(head)
+	header := head.InsertRow(0)
+	for _, title := range []string{"Product", "Quantity", "Unit Price", "Tax %", "Discount %",
+		"Subtotal", "Tax", "Total", ""} {
+		th := document.CreateElement("th")
+		th.SetAttribute("scope", "col")
+		th.SetTextContent(title)
+		header.AppendChild(th)
+	}
+	body := document.CreateElement("tbody").(*dom.HTMLTableSectionElement)
+	itemsTable.AppendChild(body)
+	for _, li := range lineItems {
+		addItemRow(document, body, li)
+	}
+	parent.AppendChild(itemsTable)
+
+	addItemBtn := document.CreateElement("button").(*dom.HTMLButtonElement)
+	addItemBtn.Class().Add("btn")
+	addItemBtn.Class().Add("btn-outline-primary")
+	addItemBtn.SetTextContent("Add Item")
+	parent.AppendChild(addItemBtn)
+	addItemBtn.AddEventListener("click", true, func(e dom.Event) {
+		addItemRow(document, body, &jobs.LineItem{Quantity: 1})
+	})
+
+	saveItemsBtn := document.CreateElement("button").(*dom.HTMLButtonElement)
+	saveItemsBtn.Class().Add("btn")
+	saveItemsBtn.Class().Add("btn-success")
+	saveItemsBtn.Class().Add("mx-2")
+	saveItemsBtn.SetTextContent("Save Items")
+	parent.AppendChild(saveItemsBtn)
+	saveItemsBtn.AddEventListener("click", true, func(e dom.Event) {
+		items, err := readItems(body)
+		if err != nil {
+			dom.GetWindow().Alert(err.Error())
+			return
+		}
+		save(items)
+	})
+}
+
+// addItemRow adds a row of inputs for the line item li to body.
+func addItemRow(document dom.Document, body *dom.HTMLTableSectionElement, li *jobs.LineItem) {
+	row := body.InsertRow(-1)
+	inputs := []struct {
+		name, kind, value string
+	}{
+		{"description", "text", li.Description},
+		{"quantity", "number", strconv.FormatFloat(li.Quantity, 'f', -1, 64)},
+		{"unit_price", "number", jobs.FormatCents(li.UnitPrice)},
+		{"tax_rate", "number", strconv.FormatFloat(li.TaxRate, 'f', -1, 64)},
+		{"discount", "number", strconv.FormatFloat(li.Discount, 'f', -1, 64)},
+	}
+	for i, in := range inputs {
+		input := document.CreateElement("input").(*dom.HTMLInputElement)
+		input.Class().Add("form-control")
+		input.SetAttribute("name", in.name)
+		input.SetAttribute("type", in.kind)
+		if in.kind == "number" {
+			input.SetAttribute("step", "any")
+		}
+		input.Value = in.value
+		row.InsertCell(i).AppendChild(input)
+	}
+	// The amounts are worked out by the server when the items are saved.
+	row.InsertCell(5).SetTextContent(jobs.FormatCents(li.Subtotal))
+	row.InsertCell(6).SetTextContent(jobs.FormatCents(li.Tax))
+	row.InsertCell(7).SetTextContent(jobs.FormatCents(li.Total))
+
+	removeBtn := document.CreateElement("button").(*dom.HTMLButtonElement)
+	removeBtn.Class().Add("btn")
+	removeBtn.Class().Add("btn-outline-danger")
+	removeBtn.SetTextContent("Remove")
+	row.InsertCell(8).AppendChild(removeBtn)
+	removeBtn.AddEventListener("click", true, func(e dom.Event) {
+		body.RemoveChild(row)
+	})
+}
+
+// readItems reads the line items from the rows added by addItemRow.
+func readItems(body *dom.HTMLTableSectionElement) ([]*jobs.LineItem, error) {
+	items := make([]*jobs.LineItem, 0)
+	for i, row := range body.Rows() {
+		value := func(name string) string {
+			return row.QuerySelector(fmt.Sprintf("input[name=%s]", name)).(*dom.HTMLInputElement).Value
+		}
+		number := func(name string) (float64, error) {
+			v := strings.TrimSpace(value(name))
+			if v == "" {
+				return 0, nil
+			}
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return 0, fmt.Errorf("item %d: %s %q is not a number", i+1, name, v)
+			}
+			return f, nil
+		}
+		li := &jobs.LineItem{Description: value("description")}
+		var err error
+		if li.Quantity, err = number("quantity"); err != nil {
+			return nil, err
+		}
+		if li.UnitPrice, err = jobs.ParseCents(value("unit_price")); err != nil {
+			return nil, fmt.Errorf("item %d: %v", i+1, err)
+		}
+		if li.TaxRate, err = number("tax_rate"); err != nil {
+			return nil, err
+		}
+		if li.Discount, err = number("discount"); err != nil {
+			return nil, err
+		}
+		items = append(items, li)
+	}
+	return items, nil
+}
+
 func showUserInput(document dom.Document) {
 	userInput := document.GetElementByID("userInput")
 	jobsContainer := document.GetElementByID("jobsContainer")
@@ -276,6 +603,480 @@ func showUserInput(document dom.Document) {
 	addRowContainer.Class().Add("d-none")
 }
 
+func showTrash(document dom.Document) {
+	go func() {
+		resp, err := http.Get("/jobs/trash")
+		if err != nil {
+			log.Fatal(err)
+		}
+		deleted, err := jobs.NewJobsResponse(resp)
+		if err != nil {
+			log.Fatal(err)
+		}
+		resp, err = http.Get("/customers")
+		if err != nil {
+			log.Fatal(err)
+		}
+		customers, err := jobs.NewCustomersResponse(resp)
+		if err != nil {
+			log.Fatal(err)
+		}
+		populateTrash(document, deleted, customers)
+		document.GetElementByID("trashContainer").Class().Remove("d-none")
+		document.GetElementByID("jobsContainer").Class().Add("d-none")
+		document.GetElementByID("addRowBtnContainer").Class().Add("d-none")
+	}()
+}
+
+func populateTrash(document dom.Document, deleted []*jobs.Job, customers []*jobs.Customer) {
+	customerNames := make(map[string]string)
+	for _, c := range customers {
+		customerNames[c.ID] = c.Name
+	}
+	newBody := document.CreateElement("tbody")
+	ts := newBody.(*dom.HTMLTableSectionElement)
+	for i, job := range deleted {
+		row := ts.InsertRow(i)
+		row.InsertCell(0).SetTextContent(job.OrderDate.Format(jobs.JobsDateFormat))
+		row.InsertCell(1).SetTextContent(job.DeadlineDate.Format(jobs.JobsDateFormat))
+		row.InsertCell(2).SetTextContent(jobs.StatusLabel(job.Status))
+		customerName, ok := customerNames[job.CustomerID]
+		if !ok {
+			customerName = "Unknown"
+		}
+		row.InsertCell(3).SetTextContent(customerName)
+		row.InsertCell(4).SetTextContent(job.Description)
+		row.InsertCell(5).SetTextContent(job.DeletedAt.Local().Format("2006-01-02 15:04"))
+
+		actionCell := row.InsertCell(6)
+		restoreBtn := document.CreateElement("button").(*dom.HTMLButtonElement)
+		restoreBtn.SetID(createElementID("restoreBtn", job.ID))
+		restoreBtn.Class().Add("btn")
+		restoreBtn.Class().Add("btn-success")
+		restoreBtn.Class().Add("mt-2")
+		restoreBtn.SetTextContent("Restore")
+		actionCell.AppendChild(restoreBtn)
+		restoreBtn.AddEventListener("click", true, func(e dom.Event) {
+			jobId := extractJobIDFromElement(restoreBtn.ID())
+			restoreJob(document, jobId)
+		})
+
+		purgeBtn := document.CreateElement("button").(*dom.HTMLButtonElement)
+		purgeBtn.SetID(createElementID("purgeBtn", job.ID))
+		purgeBtn.Class().Add("btn")
+		purgeBtn.Class().Add("btn-danger")
+		purgeBtn.Class().Add("mt-2")
+		purgeBtn.SetTextContent("Delete Forever")
+		actionCell.AppendChild(purgeBtn)
+		purgeBtn.AddEventListener("click", true, func(e dom.Event) {
+			jobId := extractJobIDFromElement(purgeBtn.ID())
+			answer := dom.GetWindow().Confirm("This cannot be undone. Delete the job forever?")
+			if answer {
+				purgeJob(document, jobId)
+			}
+		})
+	}
+	oldBody := document.GetElementByID("trashTable").GetElementsByTagName("tbody")[0]
+	document.GetElementByID("trashTable").ReplaceChild(newBody, oldBody)
+}
+
+func restoreJob(document dom.Document, id string) {
+	go func(id string) {
+		url := fmt.Sprintf("/jobs/%s/restore", id)
+		resp, err := http.Post(url, "application/json", nil)
+		if err := jobs.CheckResponse(resp, err, http.StatusOK); err != nil {
+			dom.GetWindow().Alert(fmt.Sprintf("Restoring the job failed: %v", err))
+		}
+		showTrash(document)
+	}(id)
+}
+
+func purgeJob(document dom.Document, id string) {
+	go func(id string) {
+		url := fmt.Sprintf("/jobs/trash/%s", id)
+		req, err := http.NewRequest("DELETE", url, nil)
+		if err != nil {
+			log.Fatalf("PurgeJob Request Error:%v\n", err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err := jobs.CheckResponse(resp, err, http.StatusOK); err != nil {
+			dom.GetWindow().Alert(fmt.Sprintf("Deleting the job failed: %v", err))
+		}
+		showTrash(document)
+	}(id)
+}
+
+func hideTrash(document dom.Document) {
+	document.GetElementByID("trashContainer").Class().Add("d-none")
+	document.GetElementByID("jobsContainer").Class().Remove("d-none")
+	document.GetElementByID("addRowBtnContainer").Class().Remove("d-none")
+	populateAllJobs(document)
+}
+
+// searchCount numbers the searches, so that the results
+// of a search are not shown once another has started.
+var searchCount int
+
+// search shows the jobs and customers matching query.
+func search(document dom.Document, query string) {
+	searchCount++
+	count := searchCount
+	if strings.TrimSpace(query) == "" {
+		hideSearch(document)
+		return
+	}
+	go func() {
+		resp, err := http.Get("/search?q=" + url.QueryEscape(query))
+		if err := jobs.CheckResponse(resp, err, http.StatusOK); err != nil {
+			dom.GetWindow().Alert(fmt.Sprintf("Searching failed: %v", err))
+			return
+		}
+		results, err := jobs.NewSearchResponse(resp)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if count != searchCount {
+			return
+		}
+		populateSearch(document, results)
+		document.GetElementByID("searchContainer").Class().Remove("d-none")
+	}()
+}
+
+func populateSearch(document dom.Document, results []*jobs.SearchResult) {
+	list := document.GetElementByID("searchResults")
+	list.SetInnerHTML("")
+	if len(results) == 0 {
+		empty := document.CreateElement("div")
+		empty.Class().Add("list-group-item")
+		empty.SetTextContent("Nothing found")
+		list.AppendChild(empty)
+		return
+	}
+	for _, r := range results {
+		r := r
+		item := document.CreateElement("div")
+		item.Class().Add("list-group-item")
+		title := document.CreateElement("h5")
+		title.SetTextContent(r.Title)
+		item.AppendChild(title)
+		if r.Kind == jobs.SearchKindJob {
+			info := document.CreateElement("small")
+			info.Class().Add("text-muted")
+			info.SetTextContent(fmt.Sprintf("Ordered %s, %s", formatDay(r.OrderDate), jobs.StatusLabel(r.Status)))
+			item.AppendChild(info)
+		}
+		// The snippet is escaped by the server, except for the highlights.
+		snippet := document.CreateElement("p")
+		snippet.Class().Add("mb-1")
+		snippet.SetInnerHTML(r.Snippet)
+		item.AppendChild(snippet)
+		openBtn := document.CreateElement("button").(*dom.HTMLButtonElement)
+		openBtn.Class().Add("btn")
+		openBtn.Class().Add("btn-sm")
+		openBtn.Class().Add("btn-outline-primary")
+		item.AppendChild(openBtn)
+		switch r.Kind {
+		case jobs.SearchKindCustomer:
+			openBtn.SetTextContent("Open Customer")
+			openBtn.AddEventListener("click", true, func(e dom.Event) {
+				dom.GetWindow().Location().Href = "/customers/" + url.PathEscape(r.ID)
+			})
+		case jobs.SearchKindJob:
+			openBtn.SetTextContent("Show in Jobs")
+			openBtn.AddEventListener("click", true, func(e dom.Event) {
+				showSearchedJob(document, r)
+			})
+		}
+		list.AppendChild(item)
+	}
+}
+
+// showSearchedJob filters the jobs table down to the jobs of the
+// customer of the job r that were ordered on the same day.
+func showSearchedJob(document dom.Document, r *jobs.SearchResult) {
+	customerID := r.CustomerID
+	if customerID == "" {
+		customerID = unknownCustomer
+	}
+	document.GetElementByID("filterCustomerDropdown").(*dom.HTMLSelectElement).Value = customerID
+	document.GetElementByID("filterStatusDropdown").(*dom.HTMLSelectElement).SelectedIndex = -1
+	for id, value := range map[string]string{
+		"filterTextInput":        "",
+		"filterOrderedFromInput": formatDay(r.OrderDate),
+		"filterOrderedToInput":   formatDay(r.OrderDate),
+		"filterDueFromInput":     "",
+		"filterDueToInput":       "",
+	} {
+		document.GetElementByID(id).(*dom.HTMLInputElement).Value = value
+	}
+	document.GetElementByID("filterOverdueCheck").(*dom.HTMLInputElement).Checked = false
+	jobsOffset = 0
+	hideSearch(document)
+	populateAllJobs(document)
+}
+
+func hideSearch(document dom.Document) {
+	document.GetElementByID("searchContainer").Class().Add("d-none")
+}
+
+func showHistory(document dom.Document, id string) {
+	go func(id string) {
+		resp, err := http.Get(fmt.Sprintf("/jobs/%s/history", id))
+		if err != nil {
+			log.Fatal(err)
+		}
+		history, err := jobs.NewAuditResponse(resp)
+		if err != nil {
+			log.Fatal(err)
+		}
+		populateHistory(document, history)
+		document.GetElementByID("historyContainer").Class().Remove("d-none")
+		document.GetElementByID("jobsContainer").Class().Add("d-none")
+		document.GetElementByID("addRowBtnContainer").Class().Add("d-none")
+	}(id)
+}
+
+func populateHistory(document dom.Document, history []*jobs.AuditEntry) {
+	newBody := document.CreateElement("tbody")
+	ts := newBody.(*dom.HTMLTableSectionElement)
+	for _, entry := range history {
+		for _, change := range entry.Changes {
+			// newest changes first
+			row := ts.InsertRow(0)
+			row.InsertCell(0).SetTextContent(entry.Time.Local().Format("2006-01-02 15:04"))
+			row.InsertCell(1).SetTextContent(entry.Actor)
+			row.InsertCell(2).SetTextContent(entry.Action)
+			row.InsertCell(3).SetTextContent(change.Field)
+			row.InsertCell(4).SetTextContent(formatHistoryValue(change.Before))
+			row.InsertCell(5).SetTextContent(formatHistoryValue(change.After))
+		}
+	}
+	oldBody := document.GetElementByID("historyTable").GetElementsByTagName("tbody")[0]
+	document.GetElementByID("historyTable").ReplaceChild(newBody, oldBody)
+}
+
+func formatHistoryValue(v any) string {
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+func hideHistory(document dom.Document) {
+	document.GetElementByID("historyContainer").Class().Add("d-none")
+	document.GetElementByID("jobsContainer").Class().Remove("d-none")
+	document.GetElementByID("addRowBtnContainer").Class().Remove("d-none")
+}
+
+func showQuotes(document dom.Document) {
+	go func() {
+		resp, err := http.Get("/quotes")
+		if err != nil {
+			log.Fatal(err)
+		}
+		quotes, err := jobs.NewQuotesResponse(resp)
+		if err != nil {
+			log.Fatal(err)
+		}
+		resp, err = http.Get("/customers")
+		if err != nil {
+			log.Fatal(err)
+		}
+		customers, err := jobs.NewCustomersResponse(resp)
+		if err != nil {
+			log.Fatal(err)
+		}
+		populateQuotes(document, quotes, customers)
+		document.GetElementByID("quotesContainer").Class().Remove("d-none")
+		document.GetElementByID("jobsContainer").Class().Add("d-none")
+		document.GetElementByID("addRowBtnContainer").Class().Add("d-none")
+	}()
+}
+
+func populateQuotes(document dom.Document, quotes []*jobs.Quote, customers []*jobs.Customer) {
+	names := make(map[string]string)
+	for _, c := range customers {
+		names[c.ID] = c.Name
+	}
+	newBody := document.CreateElement("tbody")
+	ts := newBody.(*dom.HTMLTableSectionElement)
+	for i, quote := range quotes {
+		quote := quote
+		row := ts.InsertRow(i)
+		row.SetID(createElementID("quoteRow", quote.ID))
+		row.InsertCell(0).SetTextContent(quote.Reference())
+		row.InsertCell(1).SetTextContent(names[quote.CustomerID])
+		row.InsertCell(2).SetTextContent(formatDay(quote.ValidUntil))
+		row.InsertCell(3).SetTextContent(formatDay(quote.DeadlineDate))
+		state := quote.State
+		if quote.Expired(time.Now()) {
+			state = "expired"
+		}
+		row.InsertCell(4).SetTextContent(state)
+		row.InsertCell(5).SetTextContent(formatTotals(quote.Totals))
+
+		actionCell := row.InsertCell(6)
+		printBtn := document.CreateElement("button").(*dom.HTMLButtonElement)
+		printBtn.Class().Add("btn")
+		printBtn.Class().Add("btn-secondary")
+		printBtn.Class().Add("mt-2")
+		printBtn.SetTextContent("Print")
+		actionCell.AppendChild(printBtn)
+		printBtn.AddEventListener("click", true, func(e dom.Event) {
+			dom.GetWindow().Open(fmt.Sprintf("/quotes/%s.html", quote.ID), "_blank", "")
+		})
+		if quote.State != jobs.QuoteOpen {
+			continue
+		}
+
+		itemsBtn := document.CreateElement("button").(*dom.HTMLButtonElement)
+		itemsBtn.Class().Add("btn")
+		itemsBtn.Class().Add("btn-outline-dark")
+		itemsBtn.Class().Add("mt-2")
+		itemsBtn.SetTextContent(fmt.Sprintf("Items (%d)", len(quote.Items)))
+		actionCell.AppendChild(itemsBtn)
+		itemsBtn.AddEventListener("click", true, func(e dom.Event) {
+			toggleQuoteItems(document, row, quote)
+		})
+
+		convertBtn := document.CreateElement("button").(*dom.HTMLButtonElement)
+		convertBtn.Class().Add("btn")
+		convertBtn.Class().Add("btn-success")
+		convertBtn.Class().Add("mt-2")
+		convertBtn.SetTextContent("Convert to Job")
+		actionCell.AppendChild(convertBtn)
+		convertBtn.AddEventListener("click", true, func(e dom.Event) {
+			convertQuote(document, quote)
+		})
+
+		declineBtn := document.CreateElement("button").(*dom.HTMLButtonElement)
+		declineBtn.Class().Add("btn")
+		declineBtn.Class().Add("btn-outline-danger")
+		declineBtn.Class().Add("mt-2")
+		declineBtn.SetTextContent("Declined")
+		actionCell.AppendChild(declineBtn)
+		declineBtn.AddEventListener("click", true, func(e dom.Event) {
+			if dom.GetWindow().Confirm("Mark the quote as declined by the customer?") {
+				updateQuote(document, quote.ID, &jobs.Quote{State: jobs.QuoteDeclined})
+			}
+		})
+	}
+	oldBody := document.GetElementByID("quotesTable").GetElementsByTagName("tbody")[0]
+	document.GetElementByID("quotesTable").ReplaceChild(newBody, oldBody)
+}
+
+// toggleQuoteItems shows the line items of quote in an editable table
+// in a row below its own, or hides them if they are already showing.
+func toggleQuoteItems(document dom.Document, row *dom.HTMLTableRowElement, quote *jobs.Quote) {
+	itemsRowID := createElementID("quoteItems", quote.ID)
+	if itemsRow := document.GetElementByID(itemsRowID); itemsRow != nil {
+		itemsRow.ParentNode().RemoveChild(itemsRow)
+		return
+	}
+	tableSection := row.ParentElement().(*dom.HTMLTableSectionElement)
+	itemsRow := tableSection.InsertRow(row.SectionRowIndex + 1)
+	itemsRow.SetID(itemsRowID)
+	cell := itemsRow.InsertCell(0)
+	cell.ColSpan = 7
+	appendItemsEditor(document, cell, quote.Items, func(items []*jobs.LineItem) {
+		updateQuote(document, quote.ID, &jobs.Quote{Items: items})
+	})
+}
+
+func submitQuote(document dom.Document) {
+	customerDropdown := document.GetElementByID("quoteCustomerDropdown").(*dom.HTMLSelectElement)
+	validUntilInput := document.GetElementByID("quoteValidUntilInput").(*dom.HTMLInputElement)
+	deadlineInput := document.GetElementByID("quoteDeadlineInput").(*dom.HTMLInputElement)
+	descriptionInput := document.GetElementByID("quoteDescriptionInput").(*dom.HTMLTextAreaElement)
+	quote := &jobs.Quote{
+		Description: descriptionInput.Value,
+	}
+	if customerID := customerDropdown.SelectedOptions()[0].Value; customerID != unknownCustomer {
+		quote.CustomerID = customerID
+	}
+	if validUntilInput.Value != "" {
+		quote.ValidUntil = jobs.GetFormattedDate(validUntilInput.Value)
+	}
+	if deadlineInput.Value != "" {
+		quote.DeadlineDate = jobs.GetFormattedDate(deadlineInput.Value)
+	}
+	go func() {
+		payload, err := json.Marshal(quote)
+		if err != nil {
+			log.Fatalf("PostQuote Marshal Error:%v", err)
+		}
+		resp, err := http.Post("/quotes", "application/json", bytes.NewBuffer(payload))
+		if err := jobs.CheckResponse(resp, err, http.StatusCreated); err != nil {
+			dom.GetWindow().Alert(fmt.Sprintf("Saving the new quote failed: %v", err))
+			return
+		}
+		descriptionInput.Value = ""
+		showQuotes(document)
+	}()
+}
+
+func updateQuote(document dom.Document, id string, quote *jobs.Quote) {
+	payload, err := json.Marshal(quote)
+	if err != nil {
+		log.Fatalf("UpdateQuote Marshal Error:%v", err)
+		return
+	}
+	go func(id string, payload []byte) {
+		url := fmt.Sprintf("/quotes/%s", id)
+		resp, err := http.Post(url, "application/json", bytes.NewBuffer(payload))
+		if err := jobs.CheckResponse(resp, err, http.StatusOK); err != nil {
+			dom.GetWindow().Alert(fmt.Sprintf("Saving the quote failed: %v", err))
+		}
+		showQuotes(document)
+	}(id, payload)
+}
+
+// convertQuote turns quote into a job, asking for a
+// deadline if the quote does not have one.
+func convertQuote(document dom.Document, quote *jobs.Quote) {
+	var payload []byte
+	if quote.DeadlineDate == nil {
+		deadline := dom.GetWindow().Prompt("Deadline of the job (YYYY-MM-DD)", "")
+		if deadline == "" {
+			return
+		}
+		t, err := time.Parse(jobs.JobsDateFormat, deadline)
+		if err != nil {
+			dom.GetWindow().Alert(fmt.Sprintf("%q is not a date", deadline))
+			return
+		}
+		payload, err = json.Marshal(map[string]time.Time{"deadline_date": t})
+		if err != nil {
+			log.Fatalf("ConvertQuote Marshal Error:%v", err)
+		}
+	}
+	go func(id string, payload []byte) {
+		url := fmt.Sprintf("/quotes/%s/convert", id)
+		resp, err := http.Post(url, "application/json", bytes.NewBuffer(payload))
+		if err := jobs.CheckResponse(resp, err, http.StatusCreated); err != nil {
+			dom.GetWindow().Alert(fmt.Sprintf("Converting the quote failed: %v", err))
+			return
+		}
+		hideQuotes(document)
+	}(quote.ID, payload)
+}
+
+func hideQuotes(document dom.Document) {
+	document.GetElementByID("quotesContainer").Class().Add("d-none")
+	document.GetElementByID("jobsContainer").Class().Remove("d-none")
+	document.GetElementByID("addRowBtnContainer").Class().Remove("d-none")
+	populateAllJobs(document)
+}
+
+// formatDay formats the job dates, or nothing if t is not set.
+func formatDay(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(jobs.JobsDateFormat)
+}
+
 func submitJob(document dom.Document) {
 	orderDate := document.GetElementByID("orderDateInput").(*dom.HTMLInputElement)
 	deadlineDate := document.GetElementByID("deadlineInput").(*dom.HTMLInputElement)
@@ -284,22 +1085,13 @@ func submitJob(document dom.Document) {
 	customerDropdown := document.GetElementByID("customerDropdown").(*dom.HTMLSelectElement)
 	customerElement := customerDropdown.Options()[customerDropdown.SelectedIndex]
 	description := document.GetElementByID("descriptionInput").(*dom.HTMLTextAreaElement)
-	job := jobs.NewJob(orderDate.Value, deadlineDate.Value, statusElement.Text, "",
+	job := jobs.NewJob(orderDate.Value, deadlineDate.Value, statusElement.Value, "",
 		description.Value)
-	customerName := customerElement.Value
+	if customerElement.Value != unknownCustomer {
+		job.CustomerID = customerElement.Value
+	}
 
-	go func(job *jobs.Job, customerName string) {
-		if customerName != "Unknown" {
-			resp, err := http.Get(fmt.Sprintf("/customers/search?name=%s", customerName))
-			if err != nil {
-				log.Fatal(err)
-			}
-			customer, err := jobs.NewCustomerSearchResponse(resp)
-			if err != nil {
-				log.Fatal(err)
-			}
-			job.CustomerID = customer.ID
-		}
+	go func(job *jobs.Job) {
 		payload, err := json.Marshal(job)
 		if err != nil {
 			log.Fatalf("PostJob:%v", err)
@@ -307,12 +1099,12 @@ func submitJob(document dom.Document) {
 		}
 
 		resp, err := http.Post("/jobs", "application/json", bytes.NewBuffer(payload))
-		if err != nil || resp.StatusCode != http.StatusCreated {
-			log.Fatalf("PostJob:%v\n", err)
+		if err := jobs.CheckResponse(resp, err, http.StatusCreated); err != nil {
+			dom.GetWindow().Alert(fmt.Sprintf("Saving the new job failed: %v", err))
 		}
 
-		populateAllJobs(document, "")
-	}(job, customerName)
+		populateAllJobs(document)
+	}(job)
 
 	hideUserInput(document)
 	filterCustomerDropdown := document.GetElementByID("filterCustomerDropdown").(*dom.HTMLSelectElement)
@@ -327,10 +1119,10 @@ func deleteJob(id string, document dom.Document) {
 			log.Fatalf("DeleteJob Request Error:%v\n", err)
 		}
 		resp, err := http.DefaultClient.Do(req)
-		if err != nil || resp.StatusCode != http.StatusOK {
-			log.Fatalf("DeleteJob Error:%v\n", err)
+		if err := jobs.CheckResponse(resp, err, http.StatusOK); err != nil {
+			dom.GetWindow().Alert(fmt.Sprintf("Deleting the job failed: %v", err))
 		}
-		populateAllJobs(document, "")
+		populateAllJobs(document)
 	}(id)
 }
 
@@ -343,13 +1135,42 @@ func updateJob(document dom.Document, id string, job *jobs.Job) {
 	go func(id string, payload []byte) {
 		url := fmt.Sprintf("/jobs/%s", id)
 		resp, err := http.Post(url, "application/json", bytes.NewBuffer(payload))
-		if err != nil || resp.StatusCode != http.StatusOK {
-			log.Fatalf("UpdateJob Request Error:%v\n", err)
+		if err := jobs.CheckResponse(resp, err, http.StatusOK); err != nil {
+			dom.GetWindow().Alert(fmt.Sprintf("Saving the job failed: %v", err))
 		}
-		populateAllJobs(document, "")
+		populateAllJobs(document)
 	}(id, payload)
 }
 
+// canInvoice reports whether job can be put on an invoice.
+func canInvoice(job *jobs.Job) bool {
+	status := jobs.GetJobStatus(job.Status)
+	return len(job.Items) > 0 && status != nil &&
+		job.Status != jobs.InvoicedStatus && status.CanMoveTo(jobs.InvoicedStatus)
+}
+
+// createInvoice invoices the job id and opens the printable invoice.
+func createInvoice(document dom.Document, id string) {
+	payload, err := json.Marshal(map[string][]string{"job_ids": {id}})
+	if err != nil {
+		log.Fatalf("CreateInvoice Marshal Error:%v", err)
+		return
+	}
+	go func(payload []byte) {
+		resp, err := http.Post("/invoices", "application/json", bytes.NewBuffer(payload))
+		if err := jobs.CheckResponse(resp, err, http.StatusCreated); err != nil {
+			dom.GetWindow().Alert(fmt.Sprintf("Invoicing the job failed: %v", err))
+			return
+		}
+		invoice, err := jobs.NewInvoiceResponse(resp)
+		if err != nil {
+			log.Fatal(err)
+		}
+		dom.GetWindow().Open(fmt.Sprintf("/invoices/%s.html", invoice.ID), "_blank", "")
+		populateAllJobs(document)
+	}(payload)
+}
+
 func hideUserInput(document dom.Document) {
 	userInput := document.GetElementByID("userInput")
 	jobsContainer := document.GetElementByID("jobsContainer")
@@ -358,7 +1179,7 @@ func hideUserInput(document dom.Document) {
 	jobsContainer.Class().Remove("d-none")
 	addRowContainer.Class().Remove("d-none")
 
-	populateAllJobs(document, "")
+	populateAllJobs(document)
 	orderDate := document.GetElementByID("orderDateInput").(*dom.HTMLInputElement)
 	orderDate.Value = ""
 	deadlineDate := document.GetElementByID("deadlineInput").(*dom.HTMLInputElement)
@@ -395,39 +1216,74 @@ func calculateWorkingDays(dateTo time.Time) int {
 }
 
 func applyRowStyle(row *dom.HTMLTableRowElement, job *jobs.Job) {
-	// this job is finished
-	if job.Status == jobs.JobStatusList[2] {
-		row.Class().Add("finished-row")
+	status := jobs.GetJobStatus(job.Status)
+	// the status has its own colour
+	if status != nil && status.Colour != "" {
+		row.Style().SetProperty("background-color", status.Colour, "")
 		return
 	}
 
-	// this job is shipped
-	if job.Status == jobs.JobStatusList[1] {
-		row.Class().Add("shipped-row")
+	// the job is finished
+	if status != nil && status.Terminal {
 		return
 	}
 
 	daysLeft := calculateWorkingDays(*job.DeadlineDate)
 
-	// the job is new and it is overdue
-	if job.Status == jobs.JobStatusList[0] && daysLeft == -1 {
+	// the job is overdue
+	if daysLeft == -1 {
 		row.Class().Add("overdue-row")
 		return
 	}
 
-	// the job is new and it is due next day
-	if job.Status == jobs.JobStatusList[0] && daysLeft == 1 {
+	// the job is due next day
+	if daysLeft == 1 {
 		row.Class().Add("danger-row")
 		return
 	}
 
-	// the job is new and there is less than a week left
-	if job.Status == jobs.JobStatusList[0] && daysLeft < 5 {
+	// there is less than a week left
+	if daysLeft < 5 {
 		row.Class().Add("warning-row")
 		return
 	}
 }
 
+// appendMarkdownEditor shows the text of textArea in parent rendered as
+// Markdown. Clicking it swaps it for textArea to edit the text, which
+// is rendered again once textArea loses focus.
+func appendMarkdownEditor(document dom.Document, parent dom.Element, textArea *dom.HTMLTextAreaElement) {
+	preview := document.CreateElement("div").(*dom.HTMLDivElement)
+	preview.Style().SetProperty("cursor", "text", "")
+	preview.Style().SetProperty("min-height", "2em", "")
+	render := func() {
+		if strings.TrimSpace(textArea.Value) == "" {
+			preview.SetInnerHTML(`<span class="text-muted">Click to write, Markdown works</span>`)
+			return
+		}
+		// RenderMarkdown escapes everything it does not render.
+		preview.SetInnerHTML(jobs.RenderMarkdown(textArea.Value))
+	}
+	render()
+	textArea.Class().Add("d-none")
+	parent.AppendChild(preview)
+	parent.AppendChild(textArea)
+	preview.AddEventListener("click", true, func(e dom.Event) {
+		// Following a link should not start editing.
+		if e.Target().TagName() == "A" {
+			return
+		}
+		preview.Class().Add("d-none")
+		textArea.Class().Remove("d-none")
+		textArea.Focus()
+	})
+	textArea.AddEventListener("blur", true, func(e dom.Event) {
+		render()
+		textArea.Class().Add("d-none")
+		preview.Class().Remove("d-none")
+	})
+}
+
 func createElementID(prefix, id string) string {
 	return fmt.Sprintf("%s%s%s", prefix, DIVIDER, id)
 }
@@ -2,12 +2,14 @@ package main
 
 import (
 	"bytes"
-	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
+	"time"
 
 	customers "github.com/addetz/order-manager/services"
 	"honnef.co/go/js/dom"
@@ -38,6 +40,36 @@ func main() {
 		hideUserInput(document)
 	})
 
+	showTrashBtn := document.GetElementByID("showTrashBtn")
+	showTrashBtn.AddEventListener("click", true, func(e dom.Event) {
+		showTrash(document)
+	})
+	closeTrashBtn := document.GetElementByID("closeTrashBtn")
+	closeTrashBtn.AddEventListener("click", true, func(e dom.Event) {
+		hideTrash(document)
+	})
+
+	showReceivablesBtn := document.GetElementByID("showReceivablesBtn")
+	showReceivablesBtn.AddEventListener("click", true, func(e dom.Event) {
+		showReceivables(document)
+	})
+	closeReceivablesBtn := document.GetElementByID("closeReceivablesBtn")
+	closeReceivablesBtn.AddEventListener("click", true, func(e dom.Event) {
+		hideReceivables(document)
+	})
+
+	customerSearchInput := document.GetElementByID("customerSearchInput")
+	customerSearchInput.AddEventListener("input", true, func(e dom.Event) {
+		populateAllCustomers(document)
+	})
+	exportBtn := document.GetElementByID("exportBtn")
+	exportBtn.AddEventListener("click", true, func(e dom.Event) {
+		v := url.Values{}
+		v.Set("q", document.GetElementByID("customerSearchInput").(*dom.HTMLInputElement).Value)
+		v.Set("format", document.GetElementByID("exportFormatDropdown").(*dom.HTMLSelectElement).Value)
+		dom.GetWindow().Location().Href = "/customers/export?" + v.Encode()
+	})
+
 	populateAllCustomers(document)
 }
 
@@ -54,8 +86,8 @@ func submitCustomer(document dom.Document) {
 
 	go func() {
 		resp, err := http.Post("/customers", "application/json", bytes.NewBuffer(payload))
-		if err != nil || resp.StatusCode != http.StatusCreated {
-			log.Fatalf("PostCustomer:%v\n", err)
+		if err := customers.CheckResponse(resp, err, http.StatusCreated); err != nil {
+			dom.GetWindow().Alert(fmt.Sprintf("Saving the new customer failed: %v", err))
 		}
 		populateAllCustomers(document)
 	}()
@@ -76,9 +108,11 @@ func hideUserInput(document dom.Document) {
 	addCustomerBtnContainer.Class().Remove("d-none")
 }
 
+// populateAllCustomers lists the customers matching the search box.
 func populateAllCustomers(document dom.Document) {
+	query := document.GetElementByID("customerSearchInput").(*dom.HTMLInputElement).Value
 	go func(callback func(document dom.Document, customers []*customers.Customer)) {
-		resp, err := http.Get("/customers")
+		resp, err := http.Get("/customers?q=" + url.QueryEscape(query))
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -103,7 +137,7 @@ func populateCustomersCallback(document dom.Document, customers []*customers.Cus
 func populateCustomer(document dom.Document,
 	tableSection *dom.HTMLTableSectionElement,
 	customer *customers.Customer) {
-	row := tableSection.InsertRow(0)
+	row := tableSection.InsertRow(-1)
 	row.SetID(createElementID("row", customer.ID))
 
 	// Name
@@ -121,18 +155,13 @@ func populateCustomer(document dom.Document,
 		updateCustomer(document, customerId, customer)
 	})
 
-	// Description
-	decodedDescription, err := base64.StdEncoding.DecodeString(customer.Note)
-	if err != nil {
-		log.Fatal(err)
-	}
+	// Note
 	noteCell := row.InsertCell(1)
-	noteCell.SetContentEditable("true")
 	noteTextArea := document.CreateElement("textarea").(*dom.HTMLTextAreaElement)
 	noteTextArea.SetID(createElementID("customerNote", customer.ID))
 	noteTextArea.Class().Add("form-control")
-	noteCell.AppendChild(noteTextArea)
-	noteTextArea.SetTextContent(string(decodedDescription))
+	noteTextArea.SetTextContent(customer.Note)
+	appendMarkdownEditor(document, noteCell, noteTextArea)
 	noteTextArea.AddEventListener("change", true, func(e dom.Event) {
 		customerId := extractCustomerIDFromElement(noteTextArea.ID())
 		newNote := noteTextArea.Value
@@ -142,6 +171,27 @@ func populateCustomer(document dom.Document,
 
 	// Delete button
 	actionCell := row.InsertCell(2)
+	detailsBtn := document.CreateElement("button").(*dom.HTMLButtonElement)
+	detailsBtn.Class().Add("btn")
+	detailsBtn.Class().Add("btn-outline-dark")
+	detailsBtn.Class().Add("mt-2")
+	detailsBtn.Class().Add("me-2")
+	detailsBtn.SetTextContent("Details")
+	actionCell.AppendChild(detailsBtn)
+	detailsBtn.AddEventListener("click", true, func(e dom.Event) {
+		toggleProfile(document, row, customer)
+	})
+	overviewBtn := document.CreateElement("button").(*dom.HTMLButtonElement)
+	overviewBtn.Class().Add("btn")
+	overviewBtn.Class().Add("btn-outline-primary")
+	overviewBtn.Class().Add("mt-2")
+	overviewBtn.Class().Add("me-2")
+	overviewBtn.SetTextContent("Overview 📈")
+	actionCell.AppendChild(overviewBtn)
+	overviewBtn.AddEventListener("click", true, func(e dom.Event) {
+		dom.GetWindow().Location().Href = "/customers/" + url.PathEscape(customer.ID)
+	})
+
 	deleteBtn := document.CreateElement("button").(*dom.HTMLButtonElement)
 	deleteBtn.SetID(createElementID("deleteBtn", customer.ID))
 	deleteBtn.Class().Add("btn")
@@ -151,13 +201,407 @@ func populateCustomer(document dom.Document,
 	actionCell.AppendChild(deleteBtn)
 	deleteBtn.AddEventListener("click", true, func(e dom.Event) {
 		customerId := extractCustomerIDFromElement(deleteBtn.ID())
-		answer := dom.GetWindow().Confirm("Are you sure you want to delete row?")
+		answer := dom.GetWindow().Confirm("Are you sure you want to move this row to the trash?")
 		if answer {
-			deleteCustomer(customerId, document)
+			deleteCustomer(customerId, "", document)
 		}
 	})
 }
 
+// profileFields are the inputs of the profile editor, by name.
+var profileFields = []struct {
+	name, label, kind string
+}{
+	{"emails", "Emails (comma separated)", "text"},
+	{"phones", "Phones (comma separated)", "text"},
+	{"contact_person", "Contact Person", "text"},
+	{"vat_number", "VAT Number", "text"},
+	{"payment_terms_days", "Payment Terms (days)", "number"},
+	{"billing.line1", "Billing Address", "text"},
+	{"billing.line2", "", "text"},
+	{"billing.postcode", "Postcode", "text"},
+	{"billing.city", "City", "text"},
+	{"billing.country", "Country", "text"},
+	{"shipping.line1", "Shipping Address (if different)", "text"},
+	{"shipping.line2", "", "text"},
+	{"shipping.postcode", "Postcode", "text"},
+	{"shipping.city", "City", "text"},
+	{"shipping.country", "Country", "text"},
+}
+
+// toggleProfile shows the contact details of customer in a form in a
+// row below its own, or hides them if they are already showing.
+func toggleProfile(document dom.Document, row *dom.HTMLTableRowElement, customer *customers.Customer) {
+	profileRowID := createElementID("profile", customer.ID)
+	if profileRow := document.GetElementByID(profileRowID); profileRow != nil {
+		profileRow.ParentNode().RemoveChild(profileRow)
+		return
+	}
+	tableSection := row.ParentElement().(*dom.HTMLTableSectionElement)
+	profileRow := tableSection.InsertRow(row.SectionRowIndex + 1)
+	profileRow.SetID(profileRowID)
+	cell := profileRow.InsertCell(0)
+	cell.ColSpan = 3
+
+	values := profileValues(customer)
+	form := document.CreateElement("div")
+	form.Class().Add("row")
+	for _, f := range profileFields {
+		col := document.CreateElement("div")
+		col.Class().Add("col-lg-6")
+		col.Class().Add("mb-2")
+		group := document.CreateElement("div")
+		group.Class().Add("input-group")
+		if f.label != "" {
+			span := document.CreateElement("span")
+			span.Class().Add("input-group-text")
+			span.SetTextContent(f.label)
+			group.AppendChild(span)
+		}
+		input := document.CreateElement("input").(*dom.HTMLInputElement)
+		input.Class().Add("form-control")
+		input.SetAttribute("name", f.name)
+		input.SetAttribute("type", f.kind)
+		input.Value = values[f.name]
+		group.AppendChild(input)
+		col.AppendChild(group)
+		form.AppendChild(col)
+	}
+	cell.AppendChild(form)
+
+	saveBtn := document.CreateElement("button").(*dom.HTMLButtonElement)
+	saveBtn.Class().Add("btn")
+	saveBtn.Class().Add("btn-success")
+	saveBtn.SetTextContent("Save Details")
+	cell.AppendChild(saveBtn)
+	saveBtn.AddEventListener("click", true, func(e dom.Event) {
+		value := func(name string) string {
+			input := form.QuerySelector(fmt.Sprintf("input[name='%s']", name)).(*dom.HTMLInputElement)
+			return strings.TrimSpace(input.Value)
+		}
+		profile, err := readProfile(value)
+		if err != nil {
+			dom.GetWindow().Alert(err.Error())
+			return
+		}
+		updateCustomer(document, customer.ID, profile)
+	})
+}
+
+// profileValues returns the values of the profileFields of c.
+func profileValues(c *customers.Customer) map[string]string {
+	values := map[string]string{
+		"emails":         strings.Join(c.Emails, ", "),
+		"phones":         strings.Join(c.Phones, ", "),
+		"contact_person": c.ContactPerson,
+		"vat_number":     c.VATNumber,
+	}
+	if c.PaymentTermsDays != nil {
+		values["payment_terms_days"] = strconv.Itoa(*c.PaymentTermsDays)
+	}
+	for prefix, a := range map[string]*customers.Address{"billing": c.BillingAddress, "shipping": c.ShippingAddress} {
+		if a == nil {
+			continue
+		}
+		values[prefix+".line1"] = a.Line1
+		values[prefix+".line2"] = a.Line2
+		values[prefix+".postcode"] = a.Postcode
+		values[prefix+".city"] = a.City
+		values[prefix+".country"] = a.Country
+	}
+	return values
+}
+
+// readProfile builds the update of a customer's contact details from
+// the values of the profileFields. Addresses left empty are not changed.
+func readProfile(value func(name string) string) (*customers.Customer, error) {
+	list := func(name string) []string {
+		items := make([]string, 0)
+		for _, item := range strings.Split(value(name), ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		return items
+	}
+	address := func(prefix string) *customers.Address {
+		a := &customers.Address{
+			Line1:    value(prefix + ".line1"),
+			Line2:    value(prefix + ".line2"),
+			Postcode: value(prefix + ".postcode"),
+			City:     value(prefix + ".city"),
+			Country:  value(prefix + ".country"),
+		}
+		if *a == (customers.Address{}) {
+			return nil
+		}
+		return a
+	}
+	profile := &customers.Customer{
+		Emails:          list("emails"),
+		Phones:          list("phones"),
+		ContactPerson:   value("contact_person"),
+		VATNumber:       value("vat_number"),
+		BillingAddress:  address("billing"),
+		ShippingAddress: address("shipping"),
+	}
+	if terms := value("payment_terms_days"); terms != "" {
+		days, err := strconv.Atoi(terms)
+		if err != nil {
+			return nil, fmt.Errorf("payment terms %q is not a number of days", terms)
+		}
+		profile.PaymentTermsDays = &days
+	}
+	return profile, nil
+}
+
+func showTrash(document dom.Document) {
+	go func() {
+		resp, err := http.Get("/customers/trash")
+		if err != nil {
+			log.Fatal(err)
+		}
+		deleted, err := customers.NewCustomersResponse(resp)
+		if err != nil {
+			log.Fatal(err)
+		}
+		populateTrash(document, deleted)
+		document.GetElementByID("trashContainer").Class().Remove("d-none")
+		document.GetElementByID("customerContainer").Class().Add("d-none")
+		document.GetElementByID("addCustomerBtnContainer").Class().Add("d-none")
+	}()
+}
+
+func populateTrash(document dom.Document, deleted []*customers.Customer) {
+	newBody := document.CreateElement("tbody")
+	ts := newBody.(*dom.HTMLTableSectionElement)
+	for i, customer := range deleted {
+		row := ts.InsertRow(i)
+		row.InsertCell(0).SetTextContent(customer.Name)
+		row.InsertCell(1).SetTextContent(customer.Note)
+		row.InsertCell(2).SetTextContent(customer.DeletedAt.Local().Format("2006-01-02 15:04"))
+
+		actionCell := row.InsertCell(3)
+		restoreBtn := document.CreateElement("button").(*dom.HTMLButtonElement)
+		restoreBtn.SetID(createElementID("restoreBtn", customer.ID))
+		restoreBtn.Class().Add("btn")
+		restoreBtn.Class().Add("btn-success")
+		restoreBtn.Class().Add("mt-2")
+		restoreBtn.SetTextContent("Restore")
+		actionCell.AppendChild(restoreBtn)
+		restoreBtn.AddEventListener("click", true, func(e dom.Event) {
+			customerId := extractCustomerIDFromElement(restoreBtn.ID())
+			restoreCustomer(document, customerId)
+		})
+
+		purgeBtn := document.CreateElement("button").(*dom.HTMLButtonElement)
+		purgeBtn.SetID(createElementID("purgeBtn", customer.ID))
+		purgeBtn.Class().Add("btn")
+		purgeBtn.Class().Add("btn-danger")
+		purgeBtn.Class().Add("mt-2")
+		purgeBtn.SetTextContent("Delete Forever")
+		actionCell.AppendChild(purgeBtn)
+		purgeBtn.AddEventListener("click", true, func(e dom.Event) {
+			customerId := extractCustomerIDFromElement(purgeBtn.ID())
+			answer := dom.GetWindow().Confirm("This cannot be undone. Delete the customer forever?")
+			if answer {
+				purgeCustomer(document, customerId)
+			}
+		})
+	}
+	oldBody := document.GetElementByID("trashTable").GetElementsByTagName("tbody")[0]
+	document.GetElementByID("trashTable").ReplaceChild(newBody, oldBody)
+}
+
+func restoreCustomer(document dom.Document, id string) {
+	go func(id string) {
+		url := fmt.Sprintf("/customers/%s/restore", id)
+		resp, err := http.Post(url, "application/json", nil)
+		if err := customers.CheckResponse(resp, err, http.StatusOK); err != nil {
+			dom.GetWindow().Alert(fmt.Sprintf("Restoring the customer failed: %v", err))
+		}
+		showTrash(document)
+	}(id)
+}
+
+func purgeCustomer(document dom.Document, id string) {
+	go func(id string) {
+		url := fmt.Sprintf("/customers/trash/%s", id)
+		req, err := http.NewRequest("DELETE", url, nil)
+		if err != nil {
+			log.Fatalf("PurgeCustomer Request Error:%v\n", err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err := customers.CheckResponse(resp, err, http.StatusOK); err != nil {
+			dom.GetWindow().Alert(fmt.Sprintf("Deleting the customer failed: %v", err))
+		}
+		showTrash(document)
+	}(id)
+}
+
+func hideTrash(document dom.Document) {
+	document.GetElementByID("trashContainer").Class().Add("d-none")
+	document.GetElementByID("customerContainer").Class().Remove("d-none")
+	document.GetElementByID("addCustomerBtnContainer").Class().Remove("d-none")
+	populateAllCustomers(document)
+}
+
+func showReceivables(document dom.Document) {
+	go func() {
+		resp, err := http.Get("/receivables")
+		if err != nil {
+			log.Fatal(err)
+		}
+		receivables, err := customers.NewReceivablesResponse(resp)
+		if err != nil {
+			log.Fatal(err)
+		}
+		populateReceivables(document, receivables)
+		document.GetElementByID("receivablesContainer").Class().Remove("d-none")
+		document.GetElementByID("customerContainer").Class().Add("d-none")
+		document.GetElementByID("addCustomerBtnContainer").Class().Add("d-none")
+	}()
+}
+
+// populateReceivables lists the unpaid invoices of each customer under
+// a row with the customer's balance. Overdue invoices are highlighted.
+func populateReceivables(document dom.Document, receivables []*customers.CustomerBalance) {
+	newBody := document.CreateElement("tbody")
+	ts := newBody.(*dom.HTMLTableSectionElement)
+	for _, cb := range receivables {
+		row := ts.InsertRow(-1)
+		row.Class().Add("table-secondary")
+		row.InsertCell(0).SetTextContent(cb.CustomerName)
+		row.InsertCell(1).SetTextContent(fmt.Sprintf("%d invoices", len(cb.Invoices)))
+		row.InsertCell(2)
+		row.InsertCell(3)
+		row.InsertCell(4).SetTextContent(customers.FormatCents(cb.Total))
+		row.InsertCell(5).SetTextContent(customers.FormatCents(cb.Paid))
+		row.InsertCell(6).SetTextContent(customers.FormatCents(cb.Outstanding))
+		if cb.PaymentOverdue {
+			row.InsertCell(7).SetTextContent(fmt.Sprintf("%s overdue", customers.FormatCents(cb.Overdue)))
+		} else {
+			row.InsertCell(7)
+		}
+
+		for _, ib := range cb.Invoices {
+			row := ts.InsertRow(-1)
+			if ib.PaymentOverdue {
+				row.Class().Add("table-danger")
+			}
+			row.InsertCell(0)
+			link := document.CreateElement("a").(*dom.HTMLAnchorElement)
+			link.Href = fmt.Sprintf("/invoices/%s.html", ib.InvoiceID)
+			link.Target = "_blank"
+			link.SetTextContent(ib.Reference)
+			row.InsertCell(1).AppendChild(link)
+			row.InsertCell(2).SetTextContent(ib.IssuedAt.Local().Format(customers.JobsDateFormat))
+			row.InsertCell(3).SetTextContent(ib.DueDate.Local().Format(customers.JobsDateFormat))
+			row.InsertCell(4).SetTextContent(customers.FormatCents(ib.Total))
+			row.InsertCell(5).SetTextContent(customers.FormatCents(ib.Paid))
+			row.InsertCell(6).SetTextContent(customers.FormatCents(ib.Outstanding))
+
+			actionCell := row.InsertCell(7)
+			payBtn := document.CreateElement("button").(*dom.HTMLButtonElement)
+			payBtn.SetID(createElementID("payBtn", ib.InvoiceID))
+			payBtn.Class().Add("btn")
+			payBtn.Class().Add("btn-success")
+			payBtn.Class().Add("mt-2")
+			payBtn.SetTextContent("Record Payment")
+			actionCell.AppendChild(payBtn)
+			outstanding := ib.Outstanding
+			payBtn.AddEventListener("click", true, func(e dom.Event) {
+				invoiceId := extractCustomerIDFromElement(payBtn.ID())
+				recordPayment(document, invoiceId, outstanding)
+			})
+		}
+	}
+	oldBody := document.GetElementByID("receivablesTable").GetElementsByTagName("tbody")[0]
+	document.GetElementByID("receivablesTable").ReplaceChild(newBody, oldBody)
+}
+
+// recordPayment asks for the details of a payment made today
+// against the invoice id, which defaults to paying it in full.
+func recordPayment(document dom.Document, id string, outstanding int64) {
+	window := dom.GetWindow()
+	amountText := window.Prompt("Amount paid", customers.FormatCents(outstanding))
+	if amountText == "" {
+		return
+	}
+	amount, err := customers.ParseCents(amountText)
+	if err != nil {
+		window.Alert(err.Error())
+		return
+	}
+	method := window.Prompt("Payment method, e.g. bank transfer, card or cash", "bank transfer")
+	if method == "" {
+		return
+	}
+	reference := window.Prompt("Reference, e.g. the bank transaction", "")
+
+	today := time.Now().Format(customers.JobsDateFormat)
+	payment := &customers.Payment{
+		InvoiceID: id,
+		Amount:    amount,
+		Date:      customers.GetFormattedDate(today),
+		Method:    method,
+		Reference: reference,
+	}
+	payload, err := json.Marshal(payment)
+	if err != nil {
+		log.Fatalf("RecordPayment Marshal Error:%v", err)
+		return
+	}
+	go func(payload []byte) {
+		resp, err := http.Post("/payments", "application/json", bytes.NewBuffer(payload))
+		if err := customers.CheckResponse(resp, err, http.StatusCreated); err != nil {
+			dom.GetWindow().Alert(fmt.Sprintf("Recording the payment failed: %v", err))
+		}
+		showReceivables(document)
+	}(payload)
+}
+
+func hideReceivables(document dom.Document) {
+	document.GetElementByID("receivablesContainer").Class().Add("d-none")
+	document.GetElementByID("customerContainer").Class().Remove("d-none")
+	document.GetElementByID("addCustomerBtnContainer").Class().Remove("d-none")
+}
+
+// appendMarkdownEditor shows the text of textArea in parent rendered as
+// Markdown. Clicking it swaps it for textArea to edit the text, which
+// is rendered again once textArea loses focus.
+func appendMarkdownEditor(document dom.Document, parent dom.Element, textArea *dom.HTMLTextAreaElement) {
+	preview := document.CreateElement("div").(*dom.HTMLDivElement)
+	preview.Style().SetProperty("cursor", "text", "")
+	preview.Style().SetProperty("min-height", "2em", "")
+	render := func() {
+		if strings.TrimSpace(textArea.Value) == "" {
+			preview.SetInnerHTML(`<span class="text-muted">Click to write, Markdown works</span>`)
+			return
+		}
+		// RenderMarkdown escapes everything it does not render.
+		preview.SetInnerHTML(customers.RenderMarkdown(textArea.Value))
+	}
+	render()
+	textArea.Class().Add("d-none")
+	parent.AppendChild(preview)
+	parent.AppendChild(textArea)
+	preview.AddEventListener("click", true, func(e dom.Event) {
+		// Following a link should not start editing.
+		if e.Target().TagName() == "A" {
+			return
+		}
+		preview.Class().Add("d-none")
+		textArea.Class().Remove("d-none")
+		textArea.Focus()
+	})
+	textArea.AddEventListener("blur", true, func(e dom.Event) {
+		render()
+		textArea.Class().Add("d-none")
+		preview.Class().Remove("d-none")
+	})
+}
+
 func createElementID(prefix, id string) string {
 	return fmt.Sprintf("%s%s%s", prefix, DIVIDER, id)
 }
@@ -175,24 +619,110 @@ func updateCustomer(document dom.Document, id string, customer *customers.Custom
 	go func(id string, payload []byte) {
 		url := fmt.Sprintf("/customers/%s", id)
 		resp, err := http.Post(url, "application/json", bytes.NewBuffer(payload))
-		if err != nil || resp.StatusCode != http.StatusOK {
-			log.Fatalf("UpdateCustomer Request Error:%v\n", err)
+		if err := customers.CheckResponse(resp, err, http.StatusOK); err != nil {
+			dom.GetWindow().Alert(fmt.Sprintf("Saving the customer failed: %v", err))
 		}
 		populateAllCustomers(document)
 	}(id, payload)
 }
 
-func deleteCustomer(id string, document dom.Document) {
+// deleteCustomer deletes the customer id, with query saying
+// what to do with the customer's jobs, if any.
+func deleteCustomer(id string, query string, document dom.Document) {
 	go func(id string) {
-		url := fmt.Sprintf("/customers/%s", id)
+		url := fmt.Sprintf("/customers/%s%s", id, query)
 		req, err := http.NewRequest("DELETE", url, nil)
 		if err != nil {
 			log.Fatalf("DeleteCustomer Request Error:%v\n", err)
 		}
 		resp, err := http.DefaultClient.Do(req)
-		if err != nil || resp.StatusCode != http.StatusOK {
-			log.Fatalf("DeleteCustomer Error:%v\n", err)
+		if err == nil && resp.StatusCode == http.StatusConflict {
+			inUse, err := customers.NewCustomerInUseResponse(resp)
+			if err == nil && len(inUse.Jobs) > 0 {
+				showJobsChoice(document, inUse)
+				return
+			}
+			dom.GetWindow().Alert("Deleting the customer failed, please reload the page and try again.")
+			return
+		}
+		if err := customers.CheckResponse(resp, err, http.StatusOK); err != nil {
+			dom.GetWindow().Alert(fmt.Sprintf("Deleting the customer failed: %v", err))
 		}
 		populateAllCustomers(document)
 	}(id)
 }
+
+// showJobsChoice asks what to do with the jobs of a customer
+// that could not be deleted because it still has some.
+func showJobsChoice(document dom.Document, inUse *customers.CustomerInUseError) {
+	resp, err := http.Get("/customers")
+	if err != nil {
+		log.Fatal(err)
+	}
+	allCustomers, err := customers.NewCustomersResponse(resp)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	choiceID := createElementID("jobsChoice", inUse.CustomerID)
+	if old := document.GetElementByID(choiceID); old != nil {
+		old.ParentNode().RemoveChild(old)
+	}
+	row := document.GetElementByID(createElementID("row", inUse.CustomerID)).(*dom.HTMLTableRowElement)
+	tableSection := row.ParentElement().(*dom.HTMLTableSectionElement)
+	choiceRow := tableSection.InsertRow(row.SectionRowIndex + 1)
+	choiceRow.SetID(choiceID)
+	choiceCell := choiceRow.InsertCell(0)
+	choiceCell.ColSpan = 3
+
+	message := document.CreateElement("p")
+	message.SetTextContent(fmt.Sprintf("This customer still has %d jobs. "+
+		"Move them to another customer or leave them without one before deleting.", len(inUse.Jobs)))
+	choiceCell.AppendChild(message)
+
+	reassignSelect := document.CreateElement("select").(*dom.HTMLSelectElement)
+	reassignSelect.Class().Add("form-control")
+	for _, c := range allCustomers {
+		if c.ID == inUse.CustomerID {
+			continue
+		}
+		o := document.CreateElement("option").(*dom.HTMLOptionElement)
+		o.Value = c.ID
+		o.SetTextContent(c.Name)
+		reassignSelect.AppendChild(o)
+	}
+	choiceCell.AppendChild(reassignSelect)
+
+	reassignBtn := document.CreateElement("button").(*dom.HTMLButtonElement)
+	reassignBtn.Class().Add("btn")
+	reassignBtn.Class().Add("btn-warning")
+	reassignBtn.Class().Add("mt-2")
+	reassignBtn.SetTextContent("Move Jobs & Delete")
+	reassignBtn.Disabled = len(reassignSelect.Options()) == 0
+	choiceCell.AppendChild(reassignBtn)
+	reassignBtn.AddEventListener("click", true, func(e dom.Event) {
+		reassignTo := reassignSelect.Value
+		deleteCustomer(inUse.CustomerID, fmt.Sprintf("?jobs=reassign&reassignTo=%s", url.QueryEscape(reassignTo)), document)
+	})
+
+	detachBtn := document.CreateElement("button").(*dom.HTMLButtonElement)
+	detachBtn.Class().Add("btn")
+	detachBtn.Class().Add("btn-danger")
+	detachBtn.Class().Add("mt-2")
+	detachBtn.Class().Add("mx-2")
+	detachBtn.SetTextContent("Leave Jobs Without Customer & Delete")
+	choiceCell.AppendChild(detachBtn)
+	detachBtn.AddEventListener("click", true, func(e dom.Event) {
+		deleteCustomer(inUse.CustomerID, "?jobs=detach", document)
+	})
+
+	cancelBtn := document.CreateElement("button").(*dom.HTMLButtonElement)
+	cancelBtn.Class().Add("btn")
+	cancelBtn.Class().Add("btn-secondary")
+	cancelBtn.Class().Add("mt-2")
+	cancelBtn.SetTextContent("Cancel")
+	choiceCell.AppendChild(cancelBtn)
+	cancelBtn.AddEventListener("click", true, func(e dom.Event) {
+		choiceRow.ParentNode().RemoveChild(choiceRow)
+	})
+}
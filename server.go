@@ -1,16 +1,26 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	_ "embed"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
+	"path"
+	"strconv"
+	"strings"
 	"time"
 
 	jobs "github.com/addetz/order-manager/services"
+	"github.com/addetz/order-manager/services/documents"
+	"github.com/addetz/order-manager/services/export"
+	"github.com/addetz/order-manager/services/sqlite"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 )
@@ -45,14 +55,41 @@ const (
 
 func main() {
 	filePath := flag.String("filepath", ".", "executable path")
-	cs := jobs.NewCustomerService(*filePath)
-	js := jobs.NewJobService(*filePath)
+	storeType := flag.String("store", "json", "storage backend: json or sqlite")
+	backupInterval := flag.Duration("backup-interval", time.Hour, "time between automatic backups, 0 to only back up on start")
+	backupKeep := flag.Int("backup-keep", 24, "number of most recent backups to keep")
+	backupDays := flag.Int("backup-days", 30, "number of days to keep a daily backup for")
+	trashDays := flag.Int("trash-days", 30, "days deleted jobs and customers stay in the trash, 0 to keep them forever")
+	paymentTerms := flag.Int("payment-terms", 30, "days customers have to pay an invoice before the payment is overdue")
+	businessName := flag.String("business-name", "", "name printed on invoices, quotes and labels, if any")
+	reloadInterval := flag.Duration("reload-interval", 2*time.Second, "how often the json store checks its data files for outside changes, 0 to never")
+	flag.Parse()
+	statuses, err := jobs.LoadJobStatuses(*filePath)
+	if err != nil {
+		log.Fatal("Error loading job statuses:", err)
+	}
+	jobs.JobStatusList = statuses
+	store := openStore(*storeType, *filePath, *reloadInterval)
+	audit := jobs.NewFileAuditLog(fmt.Sprintf("%s/%s", *filePath, jobs.JOBS_MANAGER_AUDIT_FILE))
+	js := jobs.NewJobService(store, store, audit)
+	cs := jobs.NewCustomerService(store, audit, js)
+	is := jobs.NewInvoiceService(store, audit, js, cs)
+	ps := jobs.NewPaymentService(store, audit, store, js, *paymentTerms)
+	qs := jobs.NewQuoteService(store, audit, js, cs)
+	ss := jobs.NewSearchService(store, store)
+	ims := jobs.NewImportService(js, cs)
+	business := documents.Business{Name: *businessName}
+	bs := jobs.NewBackupService(store, fmt.Sprintf("%s/%s", *filePath, jobs.JOBS_MANAGER_BACKUPS_DIR),
+		jobs.RetentionPolicy{KeepLast: *backupKeep, KeepDays: *backupDays})
+	bs.Schedule(*backupInterval)
+	schedulePurge(js, cs, *trashDays)
 
 	// Read port if one is set
 	port := readPort()
 
 	// Initialise echo
 	e := echo.New()
+	e.HTTPErrorHandler = handleError
 	e.Use(middleware.Logger())
 	e.Use(middleware.Recover())
 
@@ -100,76 +137,538 @@ func main() {
 	})
 
 	// List operations
+	// See jobs.ParseJobQuery for the filters. The headers say how many
+	// jobs match in all and where the next page starts.
 	e.GET("/jobs", func(c echo.Context) error {
-		customerID := c.QueryParam("customerID")
-		log.Println(customerID)
-		if customerID == "unknown" {
-			return c.JSON(http.StatusOK, js.FilterJobs(""))
+		query, err := jobs.ParseJobQuery(c.QueryParams())
+		if err != nil {
+			return err
+		}
+		page, err := js.QueryJobs(query)
+		if err != nil {
+			return err
 		}
-		if customerID != "" {
-			return c.JSON(http.StatusOK, js.FilterJobs(customerID))
+		c.Response().Header().Set(jobs.TotalCountHeader, strconv.Itoa(page.Total))
+		if page.NextCursor != "" {
+			c.Response().Header().Set(jobs.NextCursorHeader, page.NextCursor)
 		}
-		return c.JSON(http.StatusOK, js.ListJobs())
+		return c.JSON(http.StatusOK, page.Jobs)
 	})
 
+	e.GET("/statuses", func(c echo.Context) error {
+		return c.JSON(http.StatusOK, jobs.JobStatusList)
+	})
+
+	// q searches the names and contact details of the customers.
 	e.GET("/customers", func(c echo.Context) error {
-		return c.JSON(http.StatusOK, cs.ListCustomers())
+		customers, err := cs.FindCustomers(c.QueryParam("q"))
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, customers)
+	})
+
+	// Exports take the same filters as the lists, and a format
+	// of csv or xlsx. They hold every match rather than a page.
+	exportSheet := func(c echo.Context, name string, sheet *export.Sheet) error {
+		format := c.QueryParam("format")
+		if format == "" {
+			format = export.FormatCSV
+		}
+		contentType, ok := export.ContentType(format)
+		if !ok {
+			return echo.NewHTTPError(http.StatusBadRequest,
+				fmt.Sprintf("format %q is neither %s nor %s", format, export.FormatCSV, export.FormatXLSX))
+		}
+		var buf bytes.Buffer
+		if err := export.Write(&buf, format, sheet); err != nil {
+			return err
+		}
+		c.Response().Header().Set(echo.HeaderContentDisposition,
+			fmt.Sprintf("attachment; filename=%q", fmt.Sprintf("%s-%s.%s", name, time.Now().Format(jobs.JobsDateFormat), format)))
+		return c.Blob(http.StatusOK, contentType, buf.Bytes())
+	}
+
+	e.GET("/jobs/export", func(c echo.Context) error {
+		query, err := jobs.ParseJobQuery(c.QueryParams())
+		if err != nil {
+			return err
+		}
+		query.Offset, query.Cursor, query.Limit = 0, "", 0
+		page, err := js.QueryJobs(query)
+		if err != nil {
+			return err
+		}
+		customers, err := store.ListCustomers()
+		if err != nil {
+			return err
+		}
+		return exportSheet(c, "jobs", export.Jobs(page.Jobs, customers))
+	})
+
+	e.GET("/customers/export", func(c echo.Context) error {
+		customers, err := cs.FindCustomers(c.QueryParam("q"))
+		if err != nil {
+			return err
+		}
+		return exportSheet(c, "customers", export.Customers(customers))
 	})
 
 	// Create operations
 	e.POST("/jobs", func(c echo.Context) error {
-		job := jobs.NewJob("", "", "", "", "")
-		json.NewDecoder(c.Request().Body).Decode(job)
-		log.Printf("\n\n%v\n\n", job)
-		js.AddJob(job)
-		return c.JSON(http.StatusCreated, nil)
+		job := &jobs.Job{}
+		if err := decodeBody(c, job); err != nil {
+			return err
+		}
+		if err := js.AddJob(requestContext(c), job); err != nil {
+			return err
+		}
+		return c.JSON(http.StatusCreated, job)
 	})
 
 	e.POST("/customers", func(c echo.Context) error {
 		cust := &jobs.Customer{}
-		json.NewDecoder(c.Request().Body).Decode(cust)
-		cs.AddCustomer(cust)
-		return c.JSON(http.StatusCreated, nil)
+		if err := decodeBody(c, cust); err != nil {
+			return err
+		}
+		if err := cs.AddCustomer(requestContext(c), cust); err != nil {
+			return err
+		}
+		return c.JSON(http.StatusCreated, cust)
+	})
+
+	// The body is a CSV file, sent as is or as the file field of a
+	// form. See jobs.ParseImportOptions for the query parameters.
+	// Nothing is imported if any row has a problem, and the report
+	// lists them.
+	e.POST("/import", func(c echo.Context) error {
+		opts, err := jobs.ParseImportOptions(c.QueryParams())
+		if err != nil {
+			return err
+		}
+		body := c.Request().Body
+		if strings.HasPrefix(c.Request().Header.Get(echo.HeaderContentType), echo.MIMEMultipartForm) {
+			fh, err := c.FormFile("file")
+			if err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("no file to import: %v", err))
+			}
+			f, err := fh.Open()
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			body = f
+		}
+		report, err := ims.Import(requestContext(c), body, opts)
+		switch {
+		case err != nil:
+			return err
+		case len(report.Errors) > 0 && !opts.DryRun:
+			return c.JSON(http.StatusUnprocessableEntity, report)
+		case opts.DryRun:
+			return c.JSON(http.StatusOK, report)
+		}
+		return c.JSON(http.StatusCreated, report)
 	})
 
 	//Update operations
 	e.POST("/jobs/:id", func(c echo.Context) error {
 		id := c.Param("id")
 		job := &jobs.Job{}
-		json.NewDecoder(c.Request().Body).Decode(job)
-		js.UpdateJob(id, job)
-		return c.JSON(http.StatusOK, nil)
+		if err := decodeBody(c, job); err != nil {
+			return err
+		}
+		updated, err := js.UpdateJob(requestContext(c), id, job)
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, updated)
 	})
 
 	e.POST("/customers/:id", func(c echo.Context) error {
 		id := c.Param("id")
 		cust := &jobs.Customer{}
-		json.NewDecoder(c.Request().Body).Decode(cust)
-		cs.UpdateCustomer(id, cust)
-		return c.JSON(http.StatusOK, nil)
+		if err := decodeBody(c, cust); err != nil {
+			return err
+		}
+		updated, err := cs.UpdateCustomer(requestContext(c), id, cust)
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, updated)
 	})
 
 	// Delete operations
 	e.DELETE("/customers/:id", func(c echo.Context) error {
 		id := c.Param("id")
-		cs.DeleteCustomer(id)
+		opts := jobs.DeleteCustomerOptions{
+			Jobs:       jobs.OnDeleteJobs(c.QueryParam("jobs")),
+			ReassignTo: c.QueryParam("reassignTo"),
+		}
+		if err := cs.DeleteCustomer(requestContext(c), id, opts); err != nil {
+			return err
+		}
 		return c.JSON(http.StatusOK, nil)
 	})
 
 	e.DELETE("/jobs/:id", func(c echo.Context) error {
 		id := c.Param("id")
-		js.DeleteJob(id)
+		if err := js.DeleteJob(requestContext(c), id); err != nil {
+			return err
+		}
 		return c.JSON(http.StatusOK, nil)
 	})
 
-	//Search customer
+	// Trash
+	e.GET("/jobs/trash", func(c echo.Context) error {
+		jobsList, err := js.ListDeletedJobs()
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, jobsList)
+	})
+
+	e.POST("/jobs/:id/restore", func(c echo.Context) error {
+		if err := js.RestoreJob(requestContext(c), c.Param("id")); err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, nil)
+	})
+
+	e.DELETE("/jobs/trash/:id", func(c echo.Context) error {
+		if err := js.PurgeJob(requestContext(c), c.Param("id")); err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, nil)
+	})
+
+	e.GET("/customers/trash", func(c echo.Context) error {
+		customers, err := cs.ListDeletedCustomers()
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, customers)
+	})
+
+	e.POST("/customers/:id/restore", func(c echo.Context) error {
+		if err := cs.RestoreCustomer(requestContext(c), c.Param("id")); err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, nil)
+	})
+
+	e.DELETE("/customers/trash/:id", func(c echo.Context) error {
+		if err := cs.PurgeCustomer(requestContext(c), c.Param("id")); err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, nil)
+	})
+
+	// History
+	e.GET("/jobs/:id/history", func(c echo.Context) error {
+		history, err := js.History(c.Param("id"))
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, history)
+	})
+
+	e.GET("/customers/:id/history", func(c echo.Context) error {
+		history, err := cs.History(c.Param("id"))
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, history)
+	})
+
+	// Search customers by name
 	e.GET("/customers/search", func(c echo.Context) error {
-		customerName := c.QueryParam("name")
-		customer, err := cs.SearchCustomer(customerName)
+		customers, err := cs.SearchCustomers(c.QueryParam("name"))
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, customers)
+	})
+
+	// Full-text search of the jobs and customers, best match first.
+	// limit defaults to 20.
+	e.GET("/search", func(c echo.Context) error {
+		limit := 20
+		if s := c.QueryParam("limit"); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil || n < 1 {
+				return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("limit %q is not a positive number", s))
+			}
+			limit = n
+		}
+		results, err := ss.Search(c.QueryParam("q"), limit)
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, results)
+	})
+
+	// Invoices
+	e.GET("/invoices", func(c echo.Context) error {
+		invoices, err := is.ListInvoices(c.QueryParam("customerID"))
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, invoices)
+	})
+
+	e.POST("/invoices", func(c echo.Context) error {
+		req := struct {
+			JobIDs []string `json:"job_ids"`
+		}{}
+		if err := decodeBody(c, &req); err != nil {
+			return err
+		}
+		invoice, err := is.CreateInvoice(requestContext(c), req.JobIDs)
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusCreated, invoice)
+	})
+
+	// The invoice id is followed by .pdf or .html
+	// to get a printable copy instead of JSON.
+	e.GET("/invoices/:id", func(c echo.Context) error {
+		id := c.Param("id")
+		ext := path.Ext(id)
+		invoice, err := is.GetInvoice(strings.TrimSuffix(id, ext))
+		if err != nil {
+			return err
+		}
+		var buf bytes.Buffer
+		switch ext {
+		case "":
+			return c.JSON(http.StatusOK, invoice)
+		case ".html":
+			if err := documents.WriteInvoiceHTML(&buf, business, invoice); err != nil {
+				return err
+			}
+			return c.Blob(http.StatusOK, "text/html; charset=utf-8", buf.Bytes())
+		case ".pdf":
+			if err := documents.WriteInvoicePDF(&buf, business, invoice); err != nil {
+				return err
+			}
+			c.Response().Header().Set(echo.HeaderContentDisposition,
+				fmt.Sprintf("inline; filename=%q", invoice.Reference()+".pdf"))
+			return c.Blob(http.StatusOK, "application/pdf", buf.Bytes())
+		default:
+			return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("no %s copy of invoices", ext))
+		}
+	})
+
+	// Shipping labels
+	label := func(c echo.Context, write func(w io.Writer, b documents.Business, j *jobs.Job, cust *jobs.Customer) error) error {
+		job, err := js.GetJob(c.Param("id"))
+		if err != nil {
+			return err
+		}
+		customer, err := store.GetCustomer(job.CustomerID)
+		if err != nil {
+			return err
+		}
+		if customer.ShipTo() == nil {
+			return echo.NewHTTPError(http.StatusUnprocessableEntity,
+				fmt.Sprintf("customer %s has no shipping or billing address", customer.Name))
+		}
+		var buf bytes.Buffer
+		if err := write(&buf, business, job, customer); err != nil {
+			return err
+		}
+		return c.Blob(http.StatusOK, http.DetectContentType(buf.Bytes()), buf.Bytes())
+	}
+
+	e.GET("/jobs/:id/label.html", func(c echo.Context) error {
+		return label(c, documents.WriteShippingLabelHTML)
+	})
+
+	e.GET("/jobs/:id/label.pdf", func(c echo.Context) error {
+		return label(c, documents.WriteShippingLabelPDF)
+	})
+
+	// Quotes
+	e.GET("/quotes", func(c echo.Context) error {
+		quotes, err := qs.ListQuotes(c.QueryParam("customerID"))
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, quotes)
+	})
+
+	e.POST("/quotes", func(c echo.Context) error {
+		quote := &jobs.Quote{}
+		if err := decodeBody(c, quote); err != nil {
+			return err
+		}
+		if err := qs.AddQuote(requestContext(c), quote); err != nil {
+			return err
+		}
+		return c.JSON(http.StatusCreated, quote)
+	})
+
+	e.POST("/quotes/:id", func(c echo.Context) error {
+		quote := &jobs.Quote{}
+		if err := decodeBody(c, quote); err != nil {
+			return err
+		}
+		updated, err := qs.UpdateQuote(requestContext(c), c.Param("id"), quote)
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, updated)
+	})
+
+	// The body may set a deadline_date for the job
+	// other than the one of the quote.
+	e.POST("/quotes/:id/convert", func(c echo.Context) error {
+		req := struct {
+			DeadlineDate *time.Time `json:"deadline_date"`
+		}{}
+		if c.Request().ContentLength != 0 {
+			if err := decodeBody(c, &req); err != nil {
+				return err
+			}
+		}
+		job, err := qs.ConvertQuote(requestContext(c), c.Param("id"), req.DeadlineDate)
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusCreated, job)
+	})
+
+	// Like invoices, quotes can be printed as .html or .pdf.
+	e.GET("/quotes/:id", func(c echo.Context) error {
+		id := c.Param("id")
+		ext := path.Ext(id)
+		quote, err := qs.GetQuote(strings.TrimSuffix(id, ext))
 		if err != nil {
-			return c.JSON(http.StatusBadRequest, err)
+			return err
 		}
-		return c.JSON(http.StatusOK, customer)
+		if ext == "" {
+			return c.JSON(http.StatusOK, quote)
+		}
+		// Quotes are still printed for customers in the trash.
+		customer, err := store.GetCustomer(quote.CustomerID)
+		if err != nil {
+			return err
+		}
+		var buf bytes.Buffer
+		switch ext {
+		case ".html":
+			if err := documents.WriteQuoteHTML(&buf, business, quote, customer); err != nil {
+				return err
+			}
+			return c.Blob(http.StatusOK, "text/html; charset=utf-8", buf.Bytes())
+		case ".pdf":
+			if err := documents.WriteQuotePDF(&buf, business, quote, customer); err != nil {
+				return err
+			}
+			c.Response().Header().Set(echo.HeaderContentDisposition,
+				fmt.Sprintf("inline; filename=%q", quote.Reference()+".pdf"))
+			return c.Blob(http.StatusOK, "application/pdf", buf.Bytes())
+		default:
+			return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("no %s copy of quotes", ext))
+		}
+	})
+
+	// Payments
+	e.GET("/payments", func(c echo.Context) error {
+		payments, err := ps.ListPayments(c.QueryParam("invoiceID"), c.QueryParam("customerID"))
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, payments)
+	})
+
+	e.POST("/payments", func(c echo.Context) error {
+		payment := &jobs.Payment{}
+		if err := decodeBody(c, payment); err != nil {
+			return err
+		}
+		if err := ps.AddPayment(requestContext(c), payment); err != nil {
+			return err
+		}
+		return c.JSON(http.StatusCreated, payment)
+	})
+
+	e.DELETE("/payments/:id", func(c echo.Context) error {
+		if err := ps.DeletePayment(requestContext(c), c.Param("id")); err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, nil)
+	})
+
+	e.GET("/receivables", func(c echo.Context) error {
+		receivables, err := ps.Receivables()
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, receivables)
+	})
+
+	e.GET("/customers/:id/balance", func(c echo.Context) error {
+		balance, err := ps.CustomerBalance(c.Param("id"))
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, balance)
+	})
+
+	// Browsers get the customer page, everyone else its summary as JSON.
+	e.GET("/customers/:id", func(c echo.Context) error {
+		balance, err := ps.CustomerBalance(c.Param("id"))
+		if err != nil {
+			return err
+		}
+		summary, err := cs.Summary(c.Param("id"), balance)
+		if err != nil {
+			return err
+		}
+		if !strings.Contains(c.Request().Header.Get(echo.HeaderAccept), echo.MIMETextHTML) {
+			return c.JSON(http.StatusOK, summary)
+		}
+		var buf bytes.Buffer
+		if err := documents.WriteCustomerHTML(&buf, business, summary); err != nil {
+			return err
+		}
+		return c.Blob(http.StatusOK, "text/html; charset=utf-8", buf.Bytes())
+	})
+
+	e.GET("/jobs/:id/balance", func(c echo.Context) error {
+		balance, err := ps.JobBalance(c.Param("id"))
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, balance)
+	})
+
+	// Backups
+	e.GET("/admin/backups", func(c echo.Context) error {
+		backups, err := bs.ListBackups()
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, backups)
+	})
+
+	e.POST("/admin/backups", func(c echo.Context) error {
+		backup, err := bs.CreateBackup("manual")
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusCreated, backup)
+	})
+
+	e.POST("/admin/backups/:id/restore", func(c echo.Context) error {
+		id := c.Param("id")
+		if err := bs.RestoreBackup(id); err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, nil)
 	})
 
 	log.Printf("Listening on localhost:%s...\n", port)
@@ -179,6 +678,135 @@ func main() {
 
 }
 
+// openStore opens the storage backend selected by storeType
+// with its data files stored in filePath. The json data files
+// are reloaded every reloadInterval if they change on disk.
+func openStore(storeType, filePath string, reloadInterval time.Duration) jobs.Store {
+	switch storeType {
+	case "json":
+		store, err := jobs.NewFileStore(filePath)
+		if err != nil {
+			log.Fatal("Error opening data files:", err)
+		}
+		if reloadInterval > 0 {
+			store.Watch(reloadInterval)
+		}
+		return store
+	case "sqlite":
+		store, err := sqlite.Open(fmt.Sprintf("%s/%s", filePath, sqlite.JOBS_MANAGER_DB_FILE))
+		if err != nil {
+			log.Fatal("Error opening database:", err)
+		}
+		if err := store.ImportJSON(filePath); err != nil {
+			log.Fatal("Error importing JSON files:", err)
+		}
+		return store
+	default:
+		log.Fatalf("Unknown store %q, expected json or sqlite", storeType)
+		return nil
+	}
+}
+
+// schedulePurge permanently deletes the jobs and customers that have
+// been in the trash for more than days, now and then once a day
+func schedulePurge(js *jobs.JobService, cs *jobs.CustomerService, days int) {
+	if days <= 0 {
+		return
+	}
+	purge := func() {
+		ctx := jobs.WithActor(context.Background(), "auto-purge")
+		cutoff := time.Now().AddDate(0, 0, -days)
+		if n, err := js.PurgeDeletedJobs(ctx, cutoff); err != nil {
+			log.Println("Error purging jobs:", err)
+		} else if n > 0 {
+			log.Printf("Purged %d jobs from the trash\n", n)
+		}
+		if n, err := cs.PurgeDeletedCustomers(ctx, cutoff); err != nil {
+			log.Println("Error purging customers:", err)
+		} else if n > 0 {
+			log.Printf("Purged %d customers from the trash\n", n)
+		}
+	}
+	purge()
+	go func() {
+		for range time.Tick(24 * time.Hour) {
+			purge()
+		}
+	}()
+}
+
+// requestContext returns the context of the request of c, recording
+// who made it for the audit log. Clients can name themselves with
+// the X-Actor header, otherwise they are known by their IP address.
+func requestContext(c echo.Context) context.Context {
+	actor := c.Request().Header.Get("X-Actor")
+	if actor == "" {
+		actor = c.RealIP()
+	}
+	return jobs.WithActor(c.Request().Context(), actor)
+}
+
+// decodeBody reads the JSON request body of c into v
+func decodeBody(c echo.Context, v any) error {
+	if err := json.NewDecoder(c.Request().Body).Decode(v); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
+	}
+	return nil
+}
+
+// apiError is the body of every error response. Code is meant
+// for programs and Message for people, Fields lists the problems
+// with the request when it failed validation. CustomerID and Jobs
+// name the customer that could not be deleted and its jobs.
+type apiError struct {
+	Code       string             `json:"code"`
+	Message    string             `json:"message"`
+	Fields     []*jobs.FieldError `json:"fields,omitempty"`
+	CustomerID string             `json:"customer_id,omitempty"`
+	Jobs       []*jobs.Job        `json:"jobs,omitempty"`
+}
+
+// handleError answers every failed request with an apiError,
+// picking the status code from the kind of error
+func handleError(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+	status := http.StatusInternalServerError
+	body := &apiError{Message: err.Error()}
+	var he *echo.HTTPError
+	var verr *jobs.ValidationError
+	var inUse *jobs.CustomerInUseError
+	switch {
+	case errors.As(err, &verr):
+		status = http.StatusUnprocessableEntity
+		body.Fields = verr.Fields
+	case errors.As(err, &inUse):
+		status = http.StatusConflict
+		body.CustomerID = inUse.CustomerID
+		body.Jobs = inUse.Jobs
+	case errors.Is(err, jobs.ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, jobs.ErrConflict):
+		status = http.StatusConflict
+	case errors.As(err, &he):
+		status = he.Code
+		body.Message = fmt.Sprint(he.Message)
+	}
+	body.Code = strings.ReplaceAll(strings.ToLower(http.StatusText(status)), " ", "_")
+	if status == http.StatusInternalServerError {
+		log.Println("Error handling request:", err)
+	}
+	if c.Request().Method == http.MethodHead {
+		err = c.NoContent(status)
+	} else {
+		err = c.JSON(status, body)
+	}
+	if err != nil {
+		log.Println("Error sending error response:", err)
+	}
+}
+
 // readPort reads the SERVER_PORT environment variable if one is set
 // or returns a default if none is found
 func readPort() string {
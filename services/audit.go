@@ -0,0 +1,211 @@
+package jobs
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+)
+
+const JOBS_MANAGER_AUDIT_FILE = "jobsManager-audit.log"
+
+const (
+	AuditEntityJob      = "job"
+	AuditEntityCustomer = "customer"
+	AuditEntityInvoice  = "invoice"
+	AuditEntityPayment  = "payment"
+	AuditEntityQuote    = "quote"
+
+	AuditActionCreate  = "create"
+	AuditActionUpdate  = "update"
+	AuditActionDelete  = "delete"
+	AuditActionRestore = "restore"
+	AuditActionPurge   = "purge"
+)
+
+// FieldChange is the value of a single field before and after a change.
+// Before is nil for created records and After is nil for deleted ones.
+type FieldChange struct {
+	Field  string `json:"field"`
+	Before any    `json:"before"`
+	After  any    `json:"after"`
+}
+
+// AuditEntry records who changed what on a job or customer.
+type AuditEntry struct {
+	Time     time.Time      `json:"time"`
+	Actor    string         `json:"actor"`
+	Entity   string         `json:"entity"`
+	EntityID string         `json:"entity_id"`
+	Action   string         `json:"action"`
+	Changes  []*FieldChange `json:"changes"`
+}
+
+// AuditLog is an append-only record of changes.
+type AuditLog interface {
+	Append(e *AuditEntry) error
+	// History returns the entries of a single record, oldest first.
+	History(entity, id string) ([]*AuditEntry, error)
+}
+
+type actorKey struct{}
+
+// WithActor returns a context recording who is making changes.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext returns who is making changes, as set by WithActor.
+func ActorFromContext(ctx context.Context) string {
+	if actor, ok := ctx.Value(actorKey{}).(string); ok && actor != "" {
+		return actor
+	}
+	return "unknown"
+}
+
+// recordChange appends an entry with the field level differences
+// between before and after to audit. It does nothing if audit is nil
+// or nothing changed. The change is already saved, so if it cannot be
+// audited the error is only logged: failing the request would have
+// clients retry a change that was made.
+func recordChange(ctx context.Context, audit AuditLog, entity, id, action string, before, after any) {
+	if audit == nil {
+		return
+	}
+	changes, err := diffFields(before, after)
+	if err != nil {
+		log.Printf("Error auditing %s of %s %s, which was saved: %v\n", action, entity, id, err)
+		return
+	}
+	if len(changes) == 0 {
+		return
+	}
+	err = audit.Append(&AuditEntry{
+		Time:     time.Now().UTC(),
+		Actor:    ActorFromContext(ctx),
+		Entity:   entity,
+		EntityID: id,
+		Action:   action,
+		Changes:  changes,
+	})
+	if err != nil {
+		log.Printf("Error auditing %s of %s %s, which was saved: %v\n", action, entity, id, err)
+	}
+}
+
+// diffFields compares the JSON representations of before and after,
+// which may be nil, field by field.
+func diffFields(before, after any) ([]*FieldChange, error) {
+	beforeFields, err := jsonFields(before)
+	if err != nil {
+		return nil, err
+	}
+	afterFields, err := jsonFields(after)
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]bool)
+	for f := range beforeFields {
+		names[f] = true
+	}
+	for f := range afterFields {
+		names[f] = true
+	}
+	changes := make([]*FieldChange, 0)
+	for f := range names {
+		if reflect.DeepEqual(beforeFields[f], afterFields[f]) {
+			continue
+		}
+		changes = append(changes, &FieldChange{
+			Field:  f,
+			Before: beforeFields[f],
+			After:  afterFields[f],
+		})
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Field < changes[j].Field
+	})
+	return changes, nil
+}
+
+func jsonFields(v any) (map[string]any, error) {
+	fields := make(map[string]any)
+	if v == nil || reflect.ValueOf(v).IsNil() {
+		return fields, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// FileAuditLog is an AuditLog that appends entries
+// to a file, one JSON document per line.
+type FileAuditLog struct {
+	mu   sync.Mutex
+	path string
+}
+
+func NewFileAuditLog(path string) *FileAuditLog {
+	return &FileAuditLog{path: path}
+}
+
+func (al *FileAuditLog) Append(e *AuditEntry) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	f, err := os.OpenFile(al.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (al *FileAuditLog) History(entity, id string) ([]*AuditEntry, error) {
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	entries := make([]*AuditEntry, 0)
+	f, err := os.Open(al.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		e := &AuditEntry{}
+		if err := json.Unmarshal(scanner.Bytes(), e); err != nil {
+			// A crash may leave a partial last line behind.
+			continue
+		}
+		if e.Entity == entity && e.EntityID == id {
+			entries = append(entries, e)
+		}
+	}
+	return entries, scanner.Err()
+}
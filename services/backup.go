@@ -0,0 +1,211 @@
+package jobs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const JOBS_MANAGER_BACKUPS_DIR = "backups"
+
+const backupInfoFile = "backup.json"
+const backupIDFormat = "20060102-150405"
+
+// Backup is a snapshot of all the data taken at a point in time.
+type Backup struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Reason    string    `json:"reason"`
+}
+
+// RetentionPolicy decides which backups are kept when pruning.
+// The KeepLast most recent backups are always kept, plus the most
+// recent backup of each of the last KeepDays days.
+type RetentionPolicy struct {
+	KeepLast int
+	KeepDays int
+}
+
+// BackupService takes snapshots of a store into timestamped
+// directories and restores them. It is safe for concurrent use.
+type BackupService struct {
+	mu        sync.Mutex
+	store     Snapshotter
+	dir       string
+	retention RetentionPolicy
+}
+
+func NewBackupService(store Snapshotter, dir string, retention RetentionPolicy) *BackupService {
+	return &BackupService{
+		store:     store,
+		dir:       dir,
+		retention: retention,
+	}
+}
+
+// CreateBackup snapshots the store and prunes old backups.
+func (bs *BackupService) CreateBackup(reason string) (*Backup, error) {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	b, err := bs.createBackup(reason)
+	if err != nil {
+		return nil, err
+	}
+	if err := bs.prune(); err != nil {
+		return b, err
+	}
+	return b, nil
+}
+
+// ListBackups returns all backups, most recent first.
+func (bs *BackupService) ListBackups() ([]*Backup, error) {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	return bs.listBackups()
+}
+
+// RestoreBackup replaces the data in the store with the backup id.
+// The current data is backed up first so a restore can be undone.
+func (bs *BackupService) RestoreBackup(id string) error {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	b, err := bs.readBackup(id)
+	if err != nil {
+		return err
+	}
+	if _, err := bs.createBackup(fmt.Sprintf("before restoring %s", b.ID)); err != nil {
+		return err
+	}
+	return bs.store.Restore(filepath.Join(bs.dir, b.ID))
+}
+
+// Schedule takes a backup now and then every interval until the
+// program exits. Failures are logged, since there is nobody to report
+// them to.
+func (bs *BackupService) Schedule(interval time.Duration) {
+	if _, err := bs.CreateBackup("startup"); err != nil {
+		log.Println("Error creating backup:", err)
+	}
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		for range time.Tick(interval) {
+			if _, err := bs.CreateBackup("scheduled"); err != nil {
+				log.Println("Error creating backup:", err)
+			}
+		}
+	}()
+}
+
+func (bs *BackupService) createBackup(reason string) (*Backup, error) {
+	now := time.Now().UTC()
+	b := &Backup{
+		ID:        now.Format(backupIDFormat),
+		CreatedAt: now,
+		Reason:    reason,
+	}
+	// Several backups may be taken within the same second,
+	// e.g. when restoring right after starting up.
+	for i := 1; ; i++ {
+		if _, err := os.Stat(filepath.Join(bs.dir, b.ID)); errors.Is(err, os.ErrNotExist) {
+			break
+		}
+		b.ID = fmt.Sprintf("%s-%d", now.Format(backupIDFormat), i)
+	}
+
+	backupDir := filepath.Join(bs.dir, b.ID)
+	if err := os.MkdirAll(backupDir, 0755); err != nil {
+		return nil, fmt.Errorf("creating backup %s: %w", b.ID, err)
+	}
+	if err := bs.store.Snapshot(backupDir); err != nil {
+		os.RemoveAll(backupDir)
+		return nil, fmt.Errorf("creating backup %s: %w", b.ID, err)
+	}
+	info, err := json.Marshal(b)
+	if err != nil {
+		return nil, err
+	}
+	// The info file is written last, so a backup without
+	// one is incomplete and is ignored.
+	if err := writeFileAtomic(filepath.Join(backupDir, backupInfoFile), info); err != nil {
+		os.RemoveAll(backupDir)
+		return nil, fmt.Errorf("creating backup %s: %w", b.ID, err)
+	}
+	return b, nil
+}
+
+func (bs *BackupService) readBackup(id string) (*Backup, error) {
+	// Only ever look directly inside the backups directory.
+	if id != filepath.Base(id) || id == "." || id == ".." {
+		return nil, fmt.Errorf("backup %s %w", id, ErrNotFound)
+	}
+	info, err := os.ReadFile(filepath.Join(bs.dir, id, backupInfoFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("backup %s %w", id, ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+	b := &Backup{}
+	if err := json.Unmarshal(info, b); err != nil {
+		return nil, fmt.Errorf("reading backup %s: %w", id, err)
+	}
+	b.ID = id
+	return b, nil
+}
+
+func (bs *BackupService) listBackups() ([]*Backup, error) {
+	entries, err := os.ReadDir(bs.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return []*Backup{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	backups := make([]*Backup, 0, len(entries))
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		b, err := bs.readBackup(e.Name())
+		if err != nil {
+			continue
+		}
+		backups = append(backups, b)
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].CreatedAt.After(backups[j].CreatedAt)
+	})
+	return backups, nil
+}
+
+func (bs *BackupService) prune() error {
+	backups, err := bs.listBackups()
+	if err != nil {
+		return err
+	}
+	cutoff := time.Now().UTC().AddDate(0, 0, -bs.retention.KeepDays)
+	days := make(map[string]bool)
+	for i, b := range backups {
+		day := b.CreatedAt.Format(JobsDateFormat)
+		keep := i < bs.retention.KeepLast
+		if b.CreatedAt.After(cutoff) && !days[day] {
+			days[day] = true
+			keep = true
+		}
+		if keep {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(bs.dir, b.ID)); err != nil {
+			return fmt.Errorf("pruning backup %s: %w", b.ID, err)
+		}
+	}
+	return nil
+}
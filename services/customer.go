@@ -1,81 +1,531 @@
 package jobs
 
 import (
+	"context"
 	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/google/uuid"
 )
 
 type Customer struct {
-	ID   string `json:"id"`
-	Name string `json:"name"`
-	Note string `json:"note"`
+	ID     string   `json:"id"`
+	Name   string   `json:"name"`
+	Note   string   `json:"note"`
+	Emails []string `json:"emails,omitempty"`
+	Phones []string `json:"phones,omitempty"`
+	// ContactPerson is who to ask for at the customer.
+	ContactPerson  string   `json:"contact_person,omitempty"`
+	BillingAddress *Address `json:"billing_address,omitempty"`
+	// ShippingAddress is only set when it is not the billing address.
+	ShippingAddress *Address `json:"shipping_address,omitempty"`
+	VATNumber       string   `json:"vat_number,omitempty"`
+	// PaymentTermsDays is how many days the customer has to pay
+	// invoices. The default terms apply when it is nil.
+	PaymentTermsDays *int `json:"payment_terms_days,omitempty"`
+	// DeletedAt is set while the customer is in the trash.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
 }
 
+// Address is a postal address.
+type Address struct {
+	Line1    string `json:"line1"`
+	Line2    string `json:"line2,omitempty"`
+	City     string `json:"city"`
+	Postcode string `json:"postcode"`
+	Country  string `json:"country,omitempty"`
+}
+
+// Lines returns the address as it is written on an envelope.
+func (a *Address) Lines() []string {
+	if a == nil {
+		return nil
+	}
+	lines := make([]string, 0, 4)
+	for _, l := range []string{a.Line1, a.Line2, strings.TrimSpace(a.Postcode + " " + a.City), a.Country} {
+		if strings.TrimSpace(l) != "" {
+			lines = append(lines, l)
+		}
+	}
+	return lines
+}
+
+// ShipTo returns where goods for c are sent.
+func (c *Customer) ShipTo() *Address {
+	if c.ShippingAddress != nil {
+		return c.ShippingAddress
+	}
+	return c.BillingAddress
+}
+
+// Matches reports whether query is found, ignoring case,
+// in the name or any of the contact details of c.
+func (c *Customer) Matches(query string) bool {
+	query = strings.ToLower(strings.TrimSpace(query))
+	fields := []string{c.Name, c.ContactPerson, c.VATNumber}
+	fields = append(fields, c.Emails...)
+	fields = append(fields, c.Phones...)
+	fields = append(fields, c.BillingAddress.Lines()...)
+	fields = append(fields, c.ShippingAddress.Lines()...)
+	for _, f := range fields {
+		if strings.Contains(strings.ToLower(f), query) {
+			return true
+		}
+	}
+	return false
+}
+
+// CustomerJobs is what CustomerService needs to know about jobs
+// to keep them consistent with their customers. Customers are removed
+// through RemoveIfNoJobs and ReassignJobs, so that no job can be given
+// a customer while it is being removed.
+type CustomerJobs interface {
+	FilterJobs(customerID string) ([]*Job, error)
+	RemoveIfNoJobs(customerID string, remove func() error) error
+	ReassignJobs(ctx context.Context, fromCustomerID, toCustomerID string, remove func() error) error
+}
+
+// OnDeleteJobs says what happens to the jobs of a customer being deleted.
+type OnDeleteJobs string
+
+const (
+	// BlockIfJobs refuses to delete customers who still have jobs.
+	BlockIfJobs OnDeleteJobs = "block"
+	// ReassignJobs hands the jobs over to another customer.
+	ReassignJobs OnDeleteJobs = "reassign"
+	// DetachJobs leaves the jobs without a customer.
+	DetachJobs OnDeleteJobs = "detach"
+)
+
+type DeleteCustomerOptions struct {
+	// Jobs defaults to BlockIfJobs.
+	Jobs OnDeleteJobs
+	// ReassignTo is the customer that gets the jobs with ReassignJobs.
+	ReassignTo string
+}
+
+// CustomerInUseError is returned when deleting a customer who still has jobs.
+type CustomerInUseError struct {
+	CustomerID string `json:"customer_id"`
+	Jobs       []*Job `json:"jobs"`
+}
+
+func (e *CustomerInUseError) Error() string {
+	return fmt.Sprintf("customer %s still has %d jobs", e.CustomerID, len(e.Jobs))
+}
+
+func (e *CustomerInUseError) Is(target error) bool {
+	return target == ErrConflict
+}
+
+// CustomerService is safe for concurrent use. Changes are serialised so
+// that concurrent updates of the same customer do not overwrite each other.
+// Every change is recorded in the audit log, if there is one.
 type CustomerService struct {
-	customers map[string]*Customer
-	filepath  string
+	mu    sync.Mutex
+	store CustomerStore
+	audit AuditLog
+	jobs  CustomerJobs
+}
+
+func NewCustomerService(store CustomerStore, audit AuditLog, jobs CustomerJobs) *CustomerService {
+	return &CustomerService{
+		store: store,
+		audit: audit,
+		jobs:  jobs,
+	}
+}
+
+func (cs *CustomerService) ListCustomers() ([]*Customer, error) {
+	return cs.FindCustomers("")
 }
 
-func NewCustomerService(filepath string) *CustomerService {
-	cs := &CustomerService{
-		customers: make(map[string]*Customer, 0),
-		filepath:  filepath,
+// FindCustomers returns the customers matching query, see
+// Customer.Matches, or all of them if it is empty, sorted by name.
+func (cs *CustomerService) FindCustomers(query string) ([]*Customer, error) {
+	all, err := cs.store.ListCustomers()
+	if err != nil {
+		return nil, err
 	}
-	for _, c := range openCustomersFile(filepath) {
-		cs.customers[c.ID] = c
+	csList := make([]*Customer, 0)
+	for _, c := range all {
+		if c.DeletedAt == nil && (query == "" || c.Matches(query)) {
+			csList = append(csList, c)
+		}
 	}
-	return cs
+	sort.Slice(csList, func(i, j int) bool {
+		a, b := strings.ToLower(csList[i].Name), strings.ToLower(csList[j].Name)
+		if a != b {
+			return a < b
+		}
+		return csList[i].ID < csList[j].ID
+	})
+	return csList, nil
 }
 
-func (cs *CustomerService) ListCustomers() []*Customer {
+// ListDeletedCustomers returns the customers in the trash,
+// most recently deleted first.
+func (cs *CustomerService) ListDeletedCustomers() ([]*Customer, error) {
+	all, err := cs.store.ListCustomers()
+	if err != nil {
+		return nil, err
+	}
 	csList := make([]*Customer, 0)
-	for _, c := range cs.customers {
-		csList = append(csList, c)
+	for _, c := range all {
+		if c.DeletedAt != nil {
+			csList = append(csList, c)
+		}
 	}
-	return csList
+	sort.Slice(csList, func(i, j int) bool {
+		return csList[i].DeletedAt.After(*csList[j].DeletedAt)
+	})
+	return csList, nil
+}
+
+// GetCustomer returns the customer id, unless it is in the trash.
+func (cs *CustomerService) GetCustomer(id string) (*Customer, error) {
+	return cs.getCustomer(id)
 }
 
-func (cs *CustomerService) AddCustomer(cust *Customer) {
+// AddCustomer saves the new customer cust, which must pass validation,
+// and sets its ID.
+func (cs *CustomerService) AddCustomer(ctx context.Context, cust *Customer) error {
+	if err := validateCustomer(cust); err != nil {
+		return err
+	}
 	id := uuid.New().String()
 	cust.ID = id
-	cs.customers[id] = cust
-	cs.exportCustomers()
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if err := cs.store.PutCustomer(cust); err != nil {
+		return err
+	}
+	recordChange(ctx, cs.audit, AuditEntityCustomer, id, AuditActionCreate, nil, cust)
+	return nil
 }
 
-func (cs *CustomerService) DeleteCustomer(id string) {
-	delete(cs.customers, id)
-	cs.exportCustomers()
+// AddCustomers saves the new customers of csList, which must all
+// pass validation, and sets their IDs. Either all of them are saved
+// or, if any of them cannot be, none are.
+func (cs *CustomerService) AddCustomers(ctx context.Context, csList []*Customer) error {
+	for _, c := range csList {
+		if err := validateCustomer(c); err != nil {
+			return err
+		}
+	}
+	for _, c := range csList {
+		c.ID = uuid.New().String()
+	}
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if err := cs.store.PutCustomers(csList); err != nil {
+		return err
+	}
+	for _, c := range csList {
+		recordChange(ctx, cs.audit, AuditEntityCustomer, c.ID, AuditActionCreate, nil, c)
+	}
+	return nil
 }
 
-func (cs *CustomerService) UpdateCustomer(id string, newCust *Customer) error {
-	curr, ok := cs.customers[id]
-	if !ok {
-		return fmt.Errorf("customer %s not found", id)
+// DeleteCustomer moves the customer id to the trash. By default customers
+// who still have jobs are not deleted and a *CustomerInUseError listing the
+// jobs is returned, opts can ask for the jobs to be reassigned or detached.
+func (cs *CustomerService) DeleteCustomer(ctx context.Context, id string, opts DeleteCustomerOptions) error {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	curr, err := cs.getCustomer(id)
+	if err != nil {
+		return err
+	}
+	before := curr.clone()
+	now := time.Now().UTC()
+	curr.DeletedAt = &now
+	err = cs.releaseJobs(ctx, id, opts, func() error {
+		return cs.store.PutCustomer(curr)
+	})
+	if err != nil {
+		return err
 	}
+	recordChange(ctx, cs.audit, AuditEntityCustomer, id, AuditActionDelete, before, curr)
+	return nil
+}
+
+// RestoreCustomer takes the customer id back out of the trash.
+func (cs *CustomerService) RestoreCustomer(ctx context.Context, id string) error {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	curr, err := cs.getDeletedCustomer(id)
+	if err != nil {
+		return err
+	}
+	before := curr.clone()
+	curr.DeletedAt = nil
+	if err := cs.store.PutCustomer(curr); err != nil {
+		return err
+	}
+	recordChange(ctx, cs.audit, AuditEntityCustomer, id, AuditActionRestore, before, curr)
+	return nil
+}
+
+// PurgeCustomer permanently deletes the customer id, which must be in the trash.
+func (cs *CustomerService) PurgeCustomer(ctx context.Context, id string) error {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	return cs.purgeCustomer(ctx, id)
+}
+
+// PurgeDeletedCustomers permanently deletes the customers moved
+// to the trash before cutoff and returns how many.
+func (cs *CustomerService) PurgeDeletedCustomers(ctx context.Context, cutoff time.Time) (int, error) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	all, err := cs.store.ListCustomers()
+	if err != nil {
+		return 0, err
+	}
+	purged := 0
+	for _, c := range all {
+		if c.DeletedAt == nil || !c.DeletedAt.Before(cutoff) {
+			continue
+		}
+		if err := cs.purgeCustomer(ctx, c.ID); err != nil {
+			return purged, err
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// releaseJobs makes sure the customer id has no jobs left, as opts says,
+// and calls remove to delete the customer. If remove fails, the jobs
+// are given back to the customer.
+func (cs *CustomerService) releaseJobs(ctx context.Context, id string, opts DeleteCustomerOptions, remove func() error) error {
+	if cs.jobs == nil {
+		return remove()
+	}
+	switch opts.Jobs {
+	case "", BlockIfJobs:
+		return cs.jobs.RemoveIfNoJobs(id, remove)
+	case ReassignJobs:
+		if opts.ReassignTo == id {
+			return fmt.Errorf("cannot reassign the jobs of customer %s to itself: %w", id, ErrConflict)
+		}
+		if _, err := cs.getCustomer(opts.ReassignTo); err != nil {
+			return err
+		}
+		return cs.jobs.ReassignJobs(ctx, id, opts.ReassignTo, remove)
+	case DetachJobs:
+		return cs.jobs.ReassignJobs(ctx, id, "", remove)
+	default:
+		verr := &ValidationError{Entity: AuditEntityCustomer}
+		verr.add("jobs", "%q is none of %s, %s or %s", opts.Jobs, BlockIfJobs, ReassignJobs, DetachJobs)
+		return verr
+	}
+}
+
+func (cs *CustomerService) purgeCustomer(ctx context.Context, id string) error {
+	before, err := cs.getDeletedCustomer(id)
+	if err != nil {
+		return err
+	}
+	// Jobs in the trash may still point at the customer.
+	err = cs.releaseJobs(ctx, id, DeleteCustomerOptions{Jobs: DetachJobs}, func() error {
+		return cs.store.DeleteCustomer(id)
+	})
+	if err != nil {
+		return err
+	}
+	recordChange(ctx, cs.audit, AuditEntityCustomer, id, AuditActionPurge, before, nil)
+	return nil
+}
+
+func (cs *CustomerService) getCustomer(id string) (*Customer, error) {
+	c, err := cs.store.GetCustomer(id)
+	if err != nil {
+		return nil, err
+	}
+	if c.DeletedAt != nil {
+		return nil, fmt.Errorf("customer %s %w", id, ErrNotFound)
+	}
+	return c, nil
+}
+
+func (cs *CustomerService) getDeletedCustomer(id string) (*Customer, error) {
+	c, err := cs.store.GetCustomer(id)
+	if err != nil {
+		return nil, err
+	}
+	if c.DeletedAt == nil {
+		return nil, fmt.Errorf("customer %s is not in the trash: %w", id, ErrNotFound)
+	}
+	return c, nil
+}
+
+// UpdateCustomer changes the fields set in newCust on the
+// customer id and returns the updated customer.
+func (cs *CustomerService) UpdateCustomer(ctx context.Context, id string, newCust *Customer) (*Customer, error) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	curr, err := cs.getCustomer(id)
+	if err != nil {
+		return nil, err
+	}
+	before := curr.clone()
 
 	if newCust.Name != "" {
 		curr.Name = newCust.Name
 	}
 
 	if newCust.Note != "" {
-		curr.Name = newCust.Note
+		curr.Note = newCust.Note
 	}
 
-	cs.customers[id] = curr
-	cs.exportCustomers()
-	return nil
+	if newCust.Emails != nil {
+		curr.Emails = newCust.Emails
+	}
+	if newCust.Phones != nil {
+		curr.Phones = newCust.Phones
+	}
+	if newCust.ContactPerson != "" {
+		curr.ContactPerson = newCust.ContactPerson
+	}
+	if newCust.BillingAddress != nil {
+		curr.BillingAddress = newCust.BillingAddress
+	}
+	if newCust.ShippingAddress != nil {
+		curr.ShippingAddress = newCust.ShippingAddress
+	}
+	if newCust.VATNumber != "" {
+		curr.VATNumber = newCust.VATNumber
+	}
+	if newCust.PaymentTermsDays != nil {
+		curr.PaymentTermsDays = newCust.PaymentTermsDays
+	}
+
+	if err := validateCustomer(curr); err != nil {
+		return nil, err
+	}
+	if err := cs.store.PutCustomer(curr); err != nil {
+		return nil, err
+	}
+	recordChange(ctx, cs.audit, AuditEntityCustomer, id, AuditActionUpdate, before, curr)
+	return curr, nil
+}
+
+// History returns the changes made to the customer id, oldest first.
+func (cs *CustomerService) History(id string) ([]*AuditEntry, error) {
+	if cs.audit == nil {
+		return []*AuditEntry{}, nil
+	}
+	return cs.audit.History(AuditEntityCustomer, id)
+}
+
+// SearchCustomers returns the customers whose name contains name,
+// ignoring case. Exact matches come first, then names starting with
+// name, then the rest, each in alphabetical order.
+func (cs *CustomerService) SearchCustomers(name string) ([]*Customer, error) {
+	customers, err := cs.ListCustomers()
+	if err != nil {
+		return nil, err
+	}
+	query := strings.ToLower(strings.TrimSpace(name))
+	rank := func(c *Customer) int {
+		n := strings.ToLower(c.Name)
+		switch {
+		case n == query:
+			return 0
+		case strings.HasPrefix(n, query):
+			return 1
+		default:
+			return 2
+		}
+	}
+	found := make([]*Customer, 0)
+	for _, c := range customers {
+		if strings.Contains(strings.ToLower(c.Name), query) {
+			found = append(found, c)
+		}
+	}
+	sort.SliceStable(found, func(i, j int) bool {
+		if ri, rj := rank(found[i]), rank(found[j]); ri != rj {
+			return ri < rj
+		}
+		return strings.ToLower(found[i].Name) < strings.ToLower(found[j].Name)
+	})
+	return found, nil
+}
+
+// validateCustomer checks that c has a name and
+// that its contact details look right.
+func validateCustomer(c *Customer) error {
+	verr := &ValidationError{Entity: AuditEntityCustomer}
+	if strings.TrimSpace(c.Name) == "" {
+		verr.add("name", "is required")
+	}
+	for i, email := range c.Emails {
+		at := strings.Index(email, "@")
+		if at <= 0 || at == len(email)-1 || strings.ContainsAny(email, " ,;") {
+			verr.add(fmt.Sprintf("emails[%d]", i), "%q is not an email address", email)
+		}
+	}
+	for i, phone := range c.Phones {
+		if !isPhoneNumber(phone) {
+			verr.add(fmt.Sprintf("phones[%d]", i), "%q is not a phone number", phone)
+		}
+	}
+	validateAddress("billing_address", c.BillingAddress, verr)
+	validateAddress("shipping_address", c.ShippingAddress, verr)
+	if c.PaymentTermsDays != nil && *c.PaymentTermsDays < 0 {
+		verr.add("payment_terms_days", "cannot be negative")
+	}
+	return verr.err()
 }
 
-func (cs *CustomerService) SearchCustomer(name string) (*Customer, error) {
-	for _, c := range cs.customers {
-		if c.Name == name {
-			return c, nil
+// isPhoneNumber accepts digits with the usual separators.
+func isPhoneNumber(s string) bool {
+	digits := 0
+	for _, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+			digits++
+		case strings.ContainsRune("+-() ./", r):
+		default:
+			return false
 		}
 	}
-	return nil, fmt.Errorf("no customer named %s found", name)
+	return digits > 0
 }
 
-func (cs *CustomerService) exportCustomers() {
-	writeCustomersFile(cs.filepath, cs.ListCustomers())
+func validateAddress(field string, a *Address, verr *ValidationError) {
+	if a == nil {
+		return
+	}
+	if strings.TrimSpace(a.Line1) == "" {
+		verr.add(field+".line1", "is required")
+	}
+	if strings.TrimSpace(a.City) == "" {
+		verr.add(field+".city", "is required")
+	}
+}
+
+func (c *Customer) clone() *Customer {
+	cp := *c
+	cp.Emails = append([]string(nil), c.Emails...)
+	cp.Phones = append([]string(nil), c.Phones...)
+	if c.BillingAddress != nil {
+		a := *c.BillingAddress
+		cp.BillingAddress = &a
+	}
+	if c.ShippingAddress != nil {
+		a := *c.ShippingAddress
+		cp.ShippingAddress = &a
+	}
+	if c.PaymentTermsDays != nil {
+		days := *c.PaymentTermsDays
+		cp.PaymentTermsDays = &days
+	}
+	return &cp
 }
@@ -0,0 +1,113 @@
+package jobs
+
+import (
+	"math"
+	"time"
+)
+
+// StatusJobs are the jobs in a status.
+type StatusJobs struct {
+	Status *JobStatus `json:"status"`
+	Jobs   []*Job     `json:"jobs"`
+}
+
+// CustomerSummary is the profile of a customer with
+// the history of their jobs and what they spent.
+type CustomerSummary struct {
+	Customer *Customer `json:"customer"`
+	// JobsByStatus groups the jobs in workflow order, leaving out
+	// the statuses the customer has no jobs in.
+	JobsByStatus []*StatusJobs `json:"jobs_by_status"`
+	JobCount     int           `json:"job_count"`
+	// Ordered adds up the totals of all the jobs that were not cancelled,
+	// Invoiced and Paid those of the invoices. All are in cents.
+	Ordered     int64 `json:"ordered"`
+	Invoiced    int64 `json:"invoiced"`
+	Paid        int64 `json:"paid"`
+	Outstanding int64 `json:"outstanding"`
+	// AverageLeadTimeDays is how long shipped jobs took from order to
+	// shipping, on average. It is nil until a job has been shipped.
+	AverageLeadTimeDays *float64   `json:"average_lead_time_days"`
+	FirstOrderDate      *time.Time `json:"first_order_date"`
+	LastOrderDate       *time.Time `json:"last_order_date"`
+}
+
+// Summary returns the summary of the customer id, whose invoices add up
+// to balance. The jobs are the ones FilterJobs finds for the customer.
+func (cs *CustomerService) Summary(id string, balance *CustomerBalance) (*CustomerSummary, error) {
+	c, err := cs.getCustomer(id)
+	if err != nil {
+		return nil, err
+	}
+	jobsList := make([]*Job, 0)
+	if cs.jobs != nil {
+		if jobsList, err = cs.jobs.FilterJobs(id); err != nil {
+			return nil, err
+		}
+	}
+	s := &CustomerSummary{
+		Customer:     c,
+		JobsByStatus: groupByStatus(jobsList),
+		JobCount:     len(jobsList),
+	}
+	if balance != nil {
+		s.Invoiced = balance.Total
+		s.Paid = balance.Paid
+		s.Outstanding = balance.Outstanding
+	}
+	var leadTime time.Duration
+	shipped := 0
+	for _, j := range jobsList {
+		if j.Status != CancelledStatus {
+			s.Ordered += j.Totals.Total
+		}
+		if j.OrderDate == nil {
+			continue
+		}
+		if s.FirstOrderDate == nil || j.OrderDate.Before(*s.FirstOrderDate) {
+			s.FirstOrderDate = j.OrderDate
+		}
+		if s.LastOrderDate == nil || j.OrderDate.After(*s.LastOrderDate) {
+			s.LastOrderDate = j.OrderDate
+		}
+		if t := j.EnteredAt(ShippedStatus); t != nil {
+			leadTime += t.Sub(*j.OrderDate)
+			shipped++
+		}
+	}
+	if shipped > 0 {
+		days := leadTime.Hours() / 24 / float64(shipped)
+		days = math.Round(days*10) / 10
+		s.AverageLeadTimeDays = &days
+	}
+	return s, nil
+}
+
+// groupByStatus groups jobsList by status, in workflow order. Jobs in
+// statuses that are no longer configured come last, in their own groups.
+func groupByStatus(jobsList []*Job) []*StatusJobs {
+	groups := make(map[string]*StatusJobs)
+	unknown := make([]*StatusJobs, 0)
+	for _, j := range jobsList {
+		g, ok := groups[j.Status]
+		if !ok {
+			status := GetJobStatus(j.Status)
+			if status == nil {
+				status = &JobStatus{Key: j.Status, Label: j.Status}
+			}
+			g = &StatusJobs{Status: status, Jobs: make([]*Job, 0)}
+			groups[j.Status] = g
+			if getStatusIndex(j.Status) < 0 {
+				unknown = append(unknown, g)
+			}
+		}
+		g.Jobs = append(g.Jobs, j)
+	}
+	byStatus := make([]*StatusJobs, 0, len(groups))
+	for _, s := range JobStatusList {
+		if g, ok := groups[s.Key]; ok {
+			byStatus = append(byStatus, g)
+		}
+	}
+	return append(byStatus, unknown...)
+}
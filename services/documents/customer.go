@@ -0,0 +1,15 @@
+package documents
+
+import (
+	"io"
+
+	jobs "github.com/addetz/order-manager/services"
+)
+
+// WriteCustomerHTML writes the page of the customer summarised by s to w.
+func WriteCustomerHTML(w io.Writer, b Business, s *jobs.CustomerSummary) error {
+	return templates.ExecuteTemplate(w, "customer.html", struct {
+		Business Business
+		Summary  *jobs.CustomerSummary
+	}{b, s})
+}
@@ -0,0 +1,63 @@
+// Package documents renders printable documents, such as invoices,
+// as HTML and as PDF.
+//
+// It is kept apart from the jobs package so that the frontend
+// does not have to compile the PDF writer.
+package documents
+
+import (
+	"embed"
+	"html/template"
+	"strconv"
+	"time"
+
+	jobs "github.com/addetz/order-manager/services"
+)
+
+// Business is who the documents are from. Documents leave
+// out the name if it is empty.
+type Business struct {
+	Name string
+}
+
+// title returns the title of the document s from b.
+func (b Business) title(s string) string {
+	if b.Name == "" {
+		return s
+	}
+	return s + " " + b.Name
+}
+
+//go:embed *.html
+var templateFiles embed.FS
+
+var templates = template.Must(template.New("").Funcs(template.FuncMap{
+	"money":    jobs.FormatCents,
+	"number":   formatNumber,
+	"date":     formatDate,
+	"day":      formatDay,
+	"markdown": markdown,
+}).ParseFS(templateFiles, "*.html"))
+
+// markdown renders descriptions and notes, which RenderMarkdown
+// makes safe to put in the page as they are.
+func markdown(s string) template.HTML {
+	return template.HTML(jobs.RenderMarkdown(s))
+}
+
+func formatNumber(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func formatDate(t time.Time) string {
+	return t.Local().Format(jobs.JobsDateFormat)
+}
+
+// formatDay formats dates like the job dates, which are
+// days rather than points in time.
+func formatDay(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(jobs.JobsDateFormat)
+}
@@ -0,0 +1,39 @@
+package documents
+
+import (
+	"fmt"
+	"io"
+
+	jobs "github.com/addetz/order-manager/services"
+)
+
+// WriteInvoiceHTML writes inv to w as a printable web page.
+func WriteInvoiceHTML(w io.Writer, b Business, inv *jobs.Invoice) error {
+	return templates.ExecuteTemplate(w, "invoice.html", struct {
+		Business Business
+		Invoice  *jobs.Invoice
+	}{b, inv})
+}
+
+// WriteInvoicePDF writes inv to w as an A4 PDF.
+func WriteInvoicePDF(w io.Writer, b Business, inv *jobs.Invoice) error {
+	doc := newPDFDocument(b.title(inv.Reference()), inv.IssuedAt)
+	lines := []string{
+		"Date: " + formatDate(inv.IssuedAt),
+		"Bill to: " + inv.CustomerName,
+	}
+	lines = append(lines, inv.BillTo.Lines()...)
+	if inv.CustomerVATNumber != "" {
+		lines = append(lines, "VAT number: "+inv.CustomerVATNumber)
+	}
+	if inv.PaymentTermsDays != nil {
+		lines = append(lines, fmt.Sprintf("Payment terms: %d days", *inv.PaymentTermsDays))
+	}
+	doc.header(b, "Invoice "+inv.Reference(), lines...)
+	items := make([]*jobs.LineItem, len(inv.Items))
+	for i, item := range inv.Items {
+		items[i] = &item.LineItem
+	}
+	doc.items(items, inv.Totals)
+	return doc.Output(w)
+}
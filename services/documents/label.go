@@ -0,0 +1,77 @@
+package documents
+
+import (
+	"io"
+
+	jobs "github.com/addetz/order-manager/services"
+	"github.com/go-pdf/fpdf"
+)
+
+// label is what goes on the shipping label of a job.
+type label struct {
+	Business  Business
+	Customer  *jobs.Customer
+	Address   *jobs.Address
+	Phone     string
+	Reference string
+}
+
+func newLabel(b Business, j *jobs.Job, c *jobs.Customer) *label {
+	l := &label{
+		Business: b,
+		Customer: c,
+		Address:  c.ShipTo(),
+		// The first 8 characters of the ID are enough to tell jobs apart.
+		Reference: j.ID,
+	}
+	if len(l.Reference) > 8 {
+		l.Reference = l.Reference[:8]
+	}
+	if len(c.Phones) > 0 {
+		l.Phone = c.Phones[0]
+	}
+	return l
+}
+
+// WriteShippingLabelHTML writes the label for sending the goods of job j
+// to the shipping address of its customer c to w as a printable web page.
+func WriteShippingLabelHTML(w io.Writer, b Business, j *jobs.Job, c *jobs.Customer) error {
+	return templates.ExecuteTemplate(w, "label.html", newLabel(b, j, c))
+}
+
+// WriteShippingLabelPDF writes the label for j to w as a 100x150mm PDF,
+// the size of most label printers.
+func WriteShippingLabelPDF(w io.Writer, b Business, j *jobs.Job, c *jobs.Customer) error {
+	l := newLabel(b, j, c)
+	pdf := fpdf.NewCustom(&fpdf.InitType{
+		OrientationStr: "P",
+		UnitStr:        "mm",
+		Size:           fpdf.SizeType{Wd: 100, Ht: 150},
+	})
+	pdf.SetTitle("Shipping label "+c.Name, true)
+	pdf.SetMargins(8, 8, 8)
+	doc := &pdfDocument{Fpdf: pdf, tr: pdf.UnicodeTranslatorFromDescriptor("")}
+	doc.AddPage()
+
+	if b.Name != "" {
+		doc.SetFont("Helvetica", "", 10)
+		doc.CellFormat(0, 6, doc.tr("From: "+b.Name), "", 1, "L", false, 0, "")
+		doc.Ln(8)
+	}
+	doc.SetFont("Helvetica", "B", 16)
+	lines := []string{c.Name}
+	if c.ContactPerson != "" {
+		lines = append(lines, "Attn: "+c.ContactPerson)
+	}
+	lines = append(lines, l.Address.Lines()...)
+	for _, line := range lines {
+		doc.CellFormat(0, 8, doc.truncate(doc.tr(line), 84), "", 1, "L", false, 0, "")
+	}
+	doc.Ln(8)
+	doc.SetFont("Helvetica", "", 10)
+	if l.Phone != "" {
+		doc.CellFormat(0, 6, doc.tr("Phone: "+l.Phone), "", 1, "L", false, 0, "")
+	}
+	doc.CellFormat(0, 6, "Order: "+l.Reference, "", 1, "L", false, 0, "")
+	return doc.Output(w)
+}
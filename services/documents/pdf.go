@@ -0,0 +1,112 @@
+package documents
+
+import (
+	"fmt"
+	"time"
+
+	jobs "github.com/addetz/order-manager/services"
+	"github.com/go-pdf/fpdf"
+)
+
+// pdfDocument is an A4 PDF being written, with the translator
+// the text has to go through to print with the core fonts.
+type pdfDocument struct {
+	*fpdf.Fpdf
+	tr func(string) string
+}
+
+func newPDFDocument(title string, created time.Time) *pdfDocument {
+	pdf := fpdf.New("P", "mm", "A4", "")
+	pdf.SetTitle(title, true)
+	pdf.SetCreationDate(created)
+	// The core fonts only know the Windows-1252 characters.
+	doc := &pdfDocument{Fpdf: pdf, tr: pdf.UnicodeTranslatorFromDescriptor("")}
+	doc.AddPage()
+	return doc
+}
+
+// header writes who the document is from, if b has a name,
+// its heading and then lines.
+func (doc *pdfDocument) header(b Business, heading string, lines ...string) {
+	if b.Name != "" {
+		doc.SetFont("Helvetica", "B", 18)
+		doc.CellFormat(0, 10, doc.tr(b.Name), "", 1, "L", false, 0, "")
+	}
+	doc.SetFont("Helvetica", "B", 14)
+	doc.CellFormat(0, 10, doc.tr(heading), "", 1, "L", false, 0, "")
+	doc.SetFont("Helvetica", "", 11)
+	for _, line := range lines {
+		doc.CellFormat(0, 6, doc.tr(line), "", 1, "L", false, 0, "")
+	}
+	doc.Ln(6)
+}
+
+// items writes a table of the line items and their totals.
+func (doc *pdfDocument) items(items []*jobs.LineItem, totals jobs.Totals) {
+	widths := []float64{62, 18, 22, 18, 22, 24, 24}
+	headers := []string{"Product", "Quantity", "Unit Price", "Discount", "Subtotal", "Tax", "Total"}
+	doc.SetFont("Helvetica", "B", 10)
+	for i, h := range headers {
+		align := "R"
+		if i == 0 {
+			align = "L"
+		}
+		doc.CellFormat(widths[i], 7, h, "B", 0, align, false, 0, "")
+	}
+	doc.Ln(-1)
+
+	doc.SetFont("Helvetica", "", 10)
+	for _, item := range items {
+		discount := ""
+		if item.Discount != 0 {
+			discount = formatNumber(item.Discount) + "%"
+		}
+		cells := []string{
+			doc.tr(item.Description),
+			formatNumber(item.Quantity),
+			jobs.FormatCents(item.UnitPrice),
+			discount,
+			jobs.FormatCents(item.Subtotal),
+			fmt.Sprintf("%s (%s%%)", jobs.FormatCents(item.Tax), formatNumber(item.TaxRate)),
+			jobs.FormatCents(item.Total),
+		}
+		for i, c := range cells {
+			align := "R"
+			if i == 0 {
+				align = "L"
+				c = doc.truncate(c, widths[i]-2)
+			}
+			doc.CellFormat(widths[i], 7, c, "B", 0, align, false, 0, "")
+		}
+		doc.Ln(-1)
+	}
+
+	doc.Ln(4)
+	labelWidth := widths[0] + widths[1] + widths[2] + widths[3] + widths[4] + widths[5]
+	rows := []struct {
+		label  string
+		amount int64
+	}{
+		{"Subtotal", totals.Subtotal},
+		{"Tax", totals.Tax},
+		{"Total", totals.Total},
+	}
+	for i, t := range rows {
+		if i == len(rows)-1 {
+			doc.SetFont("Helvetica", "B", 11)
+		}
+		doc.CellFormat(labelWidth, 7, t.label, "", 0, "R", false, 0, "")
+		doc.CellFormat(widths[6], 7, jobs.FormatCents(t.amount), "", 1, "R", false, 0, "")
+	}
+}
+
+// truncate shortens s until it fits in width.
+func (doc *pdfDocument) truncate(s string, width float64) string {
+	if doc.GetStringWidth(s) <= width {
+		return s
+	}
+	for len(s) > 0 && doc.GetStringWidth(s+"...") > width {
+		s = s[:len(s)-1]
+	}
+	return s + "..."
+}
@@ -0,0 +1,37 @@
+package documents
+
+import (
+	"io"
+
+	jobs "github.com/addetz/order-manager/services"
+)
+
+// WriteQuoteHTML writes q, made out to c, to w as a printable web page.
+func WriteQuoteHTML(w io.Writer, b Business, q *jobs.Quote, c *jobs.Customer) error {
+	return templates.ExecuteTemplate(w, "quote.html", struct {
+		Business Business
+		Quote    *jobs.Quote
+		Customer *jobs.Customer
+	}{b, q, c})
+}
+
+// WriteQuotePDF writes q, made out to c, to w as an A4 PDF.
+func WriteQuotePDF(w io.Writer, b Business, q *jobs.Quote, c *jobs.Customer) error {
+	doc := newPDFDocument(b.title(q.Reference()), q.CreatedAt)
+	lines := []string{
+		"Date: " + formatDate(q.CreatedAt),
+		"For: " + c.Name,
+		"Valid until: " + formatDay(q.ValidUntil),
+	}
+	if q.DeadlineDate != nil {
+		lines = append(lines, "Delivery by: "+formatDay(q.DeadlineDate))
+	}
+	doc.header(b, "Quote "+q.Reference(), lines...)
+	if q.Description != "" {
+		doc.SetFont("Helvetica", "", 10)
+		doc.MultiCell(0, 5, doc.tr(q.Description), "", "L", false)
+		doc.Ln(4)
+	}
+	doc.items(q.Items, q.Totals)
+	return doc.Output(w)
+}
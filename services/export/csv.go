@@ -0,0 +1,42 @@
+package export
+
+import (
+	"encoding/csv"
+	"io"
+	"strings"
+)
+
+// WriteCSV writes s to w as CSV, column names first. The file starts
+// with a byte order mark so that Excel reads it as UTF-8.
+func WriteCSV(w io.Writer, s *Sheet) error {
+	if _, err := io.WriteString(w, "\uFEFF"); err != nil {
+		return err
+	}
+	cw := csv.NewWriter(w)
+	if err := cw.Write(s.Columns); err != nil {
+		return err
+	}
+	record := make([]string, len(s.Columns))
+	for _, row := range s.Rows {
+		for i, c := range row {
+			record[i] = c.String()
+			if c.kind == textCell {
+				record[i] = escapeFormula(record[i])
+			}
+		}
+		if err := cw.Write(record[:len(row)]); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// escapeFormula keeps spreadsheets from running text that looks like a
+// formula, such as a description starting with "=", by quoting it.
+func escapeFormula(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
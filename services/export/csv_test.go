@@ -0,0 +1,49 @@
+package export
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestEscapeFormula(t *testing.T) {
+	tests := []struct {
+		s, want string
+	}{
+		{"=SUM(A1)", "'=SUM(A1)"},
+		{"+44 20 7946 0000", "'+44 20 7946 0000"},
+		{"-2 leads", "'-2 leads"},
+		{"@cmd", "'@cmd"},
+		{"\t=1", "'\t=1"},
+		{"\r=1", "'\r=1"},
+		{"Cables = 2", "Cables = 2"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := escapeFormula(tt.s); got != tt.want {
+			t.Errorf("escapeFormula(%q) = %q, want %q", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	day := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+	s := &Sheet{
+		Columns: []string{"Description", "Total", "Ordered"},
+		Rows: [][]Cell{
+			{Text("=HYPERLINK(\"x\")"), Money(-1250), Day(&day)},
+			{Text("Cables, 2m"), Money(0), Day(nil)},
+		},
+	}
+	var buf bytes.Buffer
+	if err := WriteCSV(&buf, s); err != nil {
+		t.Fatal(err)
+	}
+	// Only text is escaped, negative amounts stay numbers.
+	want := "\uFEFFDescription,Total,Ordered\n" +
+		"\"'=HYPERLINK(\"\"x\"\")\",-12.50,2024-03-01\n" +
+		"\"Cables, 2m\",0.00,\n"
+	if got := buf.String(); got != want {
+		t.Errorf("wrote\n%q\nwant\n%q", got, want)
+	}
+}
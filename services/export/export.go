@@ -0,0 +1,186 @@
+// Package export writes jobs and customers as spreadsheets, either
+// as CSV or as Excel workbooks, for the books to be done elsewhere.
+//
+// It is kept apart from the jobs package so that the frontend
+// does not have to compile the spreadsheet writers.
+package export
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	jobs "github.com/addetz/order-manager/services"
+)
+
+// The formats spreadsheets can be written in.
+const (
+	FormatCSV  = "csv"
+	FormatXLSX = "xlsx"
+)
+
+// ContentType returns the media type of format, and false if
+// format is not one of the formats spreadsheets can be written in.
+func ContentType(format string) (string, bool) {
+	switch format {
+	case FormatCSV:
+		return "text/csv; charset=utf-8", true
+	case FormatXLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", true
+	}
+	return "", false
+}
+
+// Write writes s to w in format.
+func Write(w io.Writer, format string, s *Sheet) error {
+	switch format {
+	case FormatCSV:
+		return WriteCSV(w, s)
+	case FormatXLSX:
+		return WriteXLSX(w, s)
+	}
+	return fmt.Errorf("%q is neither %s nor %s", format, FormatCSV, FormatXLSX)
+}
+
+// Sheet is a table with a row of column names on top.
+type Sheet struct {
+	Name    string
+	Columns []string
+	Rows    [][]Cell
+}
+
+type cellKind int
+
+const (
+	textCell cellKind = iota
+	moneyCell
+	dayCell
+	numberCell
+)
+
+// Cell is a value in a sheet. Money and days are kept apart from
+// text, so that spreadsheets can add them up and sort them.
+type Cell struct {
+	kind   cellKind
+	text   string
+	cents  int64
+	day    time.Time
+	number float64
+}
+
+// Text returns a cell holding s.
+func Text(s string) Cell {
+	return Cell{kind: textCell, text: s}
+}
+
+// Money returns a cell holding an amount in cents.
+func Money(cents int64) Cell {
+	return Cell{kind: moneyCell, cents: cents}
+}
+
+// Day returns a cell holding the day t, or an empty cell if t is nil.
+func Day(t *time.Time) Cell {
+	if t == nil {
+		return Text("")
+	}
+	return Cell{kind: dayCell, day: *t}
+}
+
+// Number returns a cell holding f, or an empty cell if f is nil.
+func Number(f *float64) Cell {
+	if f == nil {
+		return Text("")
+	}
+	return Cell{kind: numberCell, number: *f}
+}
+
+// String returns the cell as it is written in a CSV file.
+func (c Cell) String() string {
+	switch c.kind {
+	case moneyCell:
+		return jobs.FormatCents(c.cents)
+	case dayCell:
+		return c.day.Format(jobs.JobsDateFormat)
+	case numberCell:
+		return strconv.FormatFloat(c.number, 'f', -1, 64)
+	}
+	return c.text
+}
+
+// Jobs returns a sheet of jobsList, naming their customers from customers.
+func Jobs(jobsList []*jobs.Job, customers []*jobs.Customer) *Sheet {
+	names := make(map[string]string, len(customers))
+	for _, c := range customers {
+		names[c.ID] = c.Name
+	}
+	s := &Sheet{
+		Name: "Jobs",
+		Columns: []string{"ID", "Order Date", "Deadline", "Status", "Customer",
+			"Description", "Items", "Subtotal", "Tax", "Total"},
+		Rows: make([][]Cell, 0, len(jobsList)),
+	}
+	for _, j := range jobsList {
+		items := make([]string, len(j.Items))
+		for i, li := range j.Items {
+			items[i] = fmt.Sprintf("%s × %s", strconv.FormatFloat(li.Quantity, 'f', -1, 64), li.Description)
+		}
+		s.Rows = append(s.Rows, []Cell{
+			Text(j.ID),
+			Day(j.OrderDate),
+			Day(j.DeadlineDate),
+			Text(statusName(j.Status)),
+			Text(names[j.CustomerID]),
+			Text(j.Description),
+			Text(strings.Join(items, "\n")),
+			Money(j.Totals.Subtotal),
+			Money(j.Totals.Tax),
+			Money(j.Totals.Total),
+		})
+	}
+	return s
+}
+
+// Customers returns a sheet of customers and their details.
+func Customers(customers []*jobs.Customer) *Sheet {
+	s := &Sheet{
+		Name: "Customers",
+		Columns: []string{"ID", "Name", "Contact Person", "Emails", "Phones",
+			"Billing Address", "Shipping Address", "VAT Number", "Payment Terms (Days)", "Note"},
+		Rows: make([][]Cell, 0, len(customers)),
+	}
+	for _, c := range customers {
+		var terms *float64
+		if c.PaymentTermsDays != nil {
+			days := float64(*c.PaymentTermsDays)
+			terms = &days
+		}
+		s.Rows = append(s.Rows, []Cell{
+			Text(c.ID),
+			Text(c.Name),
+			Text(c.ContactPerson),
+			Text(strings.Join(c.Emails, ", ")),
+			Text(strings.Join(c.Phones, ", ")),
+			Text(strings.Join(c.BillingAddress.Lines(), ", ")),
+			Text(strings.Join(c.ShippingAddress.Lines(), ", ")),
+			Text(c.VATNumber),
+			Number(terms),
+			Text(c.Note),
+		})
+	}
+	return s
+}
+
+// statusName returns the label of the status with the key status,
+// without the emoji that only make sense on screen.
+func statusName(status string) string {
+	s := jobs.GetJobStatus(status)
+	if s == nil {
+		return status
+	}
+	return strings.TrimRightFunc(s.Label, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
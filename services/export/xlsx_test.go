@@ -0,0 +1,157 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"testing"
+	"time"
+)
+
+// xlsxCell is a cell of a worksheet as WriteXLSX writes it.
+type xlsxCell struct {
+	Ref   string `xml:"r,attr"`
+	Style int    `xml:"s,attr"`
+	Type  string `xml:"t,attr"`
+	Value string `xml:"v"`
+	Text  string `xml:"is>t"`
+}
+
+type xlsxWorksheet struct {
+	Rows []struct {
+		Ref   int        `xml:"r,attr"`
+		Cells []xlsxCell `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+func TestWriteXLSX(t *testing.T) {
+	day := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+	terms := 30.0
+	s := &Sheet{
+		Name:    "Jobs & <Co>",
+		Columns: []string{"Description", "Total", "Ordered", "Terms", "Note"},
+		Rows: [][]Cell{
+			{Text(`XLR <3m> & "jack" leads`), Money(-1250), Day(&day), Number(&terms), Text("")},
+		},
+	}
+	var buf bytes.Buffer
+	if err := WriteXLSX(&buf, s); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("workbook is not a zip file: %v", err)
+	}
+	parts := make(map[string][]byte)
+	for _, f := range zr.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts[f.Name] = content
+	}
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml",
+		"xl/_rels/workbook.xml.rels", "xl/styles.xml", "xl/worksheets/sheet1.xml"} {
+		content, ok := parts[name]
+		if !ok {
+			t.Errorf("workbook has no %s", name)
+			continue
+		}
+		// Every part has to be well formed, or Excel refuses the file.
+		dec := xml.NewDecoder(bytes.NewReader(content))
+		for {
+			if _, err := dec.Token(); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Errorf("%s is not XML: %v", name, err)
+				break
+			}
+		}
+	}
+
+	var workbook struct {
+		Sheets []struct {
+			Name string `xml:"name,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if err := xml.Unmarshal(parts["xl/workbook.xml"], &workbook); err != nil {
+		t.Fatal(err)
+	}
+	if len(workbook.Sheets) != 1 || workbook.Sheets[0].Name != s.Name {
+		t.Errorf("workbook has sheets %+v, want the one sheet %q", workbook.Sheets, s.Name)
+	}
+
+	var sheet xlsxWorksheet
+	if err := xml.Unmarshal(parts["xl/worksheets/sheet1.xml"], &sheet); err != nil {
+		t.Fatal(err)
+	}
+	want := [][]xlsxCell{
+		{
+			{Ref: "A1", Style: headerStyle, Type: "inlineStr", Text: "Description"},
+			{Ref: "B1", Style: headerStyle, Type: "inlineStr", Text: "Total"},
+			{Ref: "C1", Style: headerStyle, Type: "inlineStr", Text: "Ordered"},
+			{Ref: "D1", Style: headerStyle, Type: "inlineStr", Text: "Terms"},
+			{Ref: "E1", Style: headerStyle, Type: "inlineStr", Text: "Note"},
+		},
+		{
+			{Ref: "A2", Style: plainStyle, Type: "inlineStr", Text: `XLR <3m> & "jack" leads`},
+			{Ref: "B2", Style: moneyStyle, Value: "-12.50"},
+			{Ref: "C2", Style: dayStyle, Value: "45352"},
+			{Ref: "D2", Style: plainStyle, Value: "30"},
+			// Empty text is left out.
+		},
+	}
+	if len(sheet.Rows) != len(want) {
+		t.Fatalf("sheet has %d rows, want %d", len(sheet.Rows), len(want))
+	}
+	for r, row := range sheet.Rows {
+		if row.Ref != r+1 {
+			t.Errorf("row %d is numbered %d", r+1, row.Ref)
+		}
+		if len(row.Cells) != len(want[r]) {
+			t.Errorf("row %d has cells %+v, want %+v", r+1, row.Cells, want[r])
+			continue
+		}
+		for i, c := range row.Cells {
+			if c != want[r][i] {
+				t.Errorf("cell %s is %+v, want %+v", want[r][i].Ref, c, want[r][i])
+			}
+		}
+	}
+}
+
+func TestColumnName(t *testing.T) {
+	for i, want := range map[int]string{
+		0: "A", 1: "B", 25: "Z", 26: "AA", 27: "AB", 51: "AZ", 52: "BA", 701: "ZZ", 702: "AAA",
+	} {
+		if got := columnName(i); got != want {
+			t.Errorf("columnName(%d) = %q, want %q", i, got, want)
+		}
+	}
+}
+
+func TestSerialDay(t *testing.T) {
+	tests := []struct {
+		day  time.Time
+		want int
+	}{
+		{time.Date(1899, time.December, 31, 0, 0, 0, 0, time.UTC), 1},
+		{time.Date(1900, time.March, 1, 0, 0, 0, 0, time.UTC), 61},
+		{time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC), 45352},
+		// The day is the one on the calendar where t is,
+		// whatever the time of day.
+		{time.Date(2024, time.March, 1, 23, 30, 0, 0, time.FixedZone("UTC+2", 2*60*60)), 45352},
+		{time.Date(2024, time.March, 1, 0, 30, 0, 0, time.FixedZone("UTC-8", -8*60*60)), 45352},
+	}
+	for _, tt := range tests {
+		if got := serialDay(tt.day); got != tt.want {
+			t.Errorf("serialDay(%s) = %d, want %d", tt.day, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package jobs
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// fileState identifies the contents of a data file.
+type fileState struct {
+	modTime time.Time
+	size    int64
+	sum     [sha256.Size]byte
+}
+
+// Watch polls the data files every interval and reloads the ones
+// changed by someone else, e.g. fixed by hand or synced from another
+// machine. It returns a function that stops watching.
+//
+// A change made through the store while a file has been changed on
+// disk, but not reloaded yet, is refused with ErrConflict and the
+// file is reloaded straight away instead.
+func (fs *FileStore) Watch(interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				fs.reloadChanged()
+			}
+		}
+	}()
+	return func() {
+		close(done)
+	}
+}
+
+func (fs *FileStore) reloadChanged() {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	for _, name := range dataFileNames {
+		changed, err := fs.changedOnDisk(name)
+		if err != nil {
+			log.Printf("Error checking %s for changes: %v\n", name, err)
+			continue
+		}
+		if !changed {
+			continue
+		}
+		if err := fs.reload(name); err != nil {
+			fs.reportBroken(name, err)
+			continue
+		}
+		delete(fs.broken, name)
+		log.Printf("Reloaded %s after it changed on disk\n", name)
+	}
+}
+
+// reportBroken logs that the data file name could not be reloaded,
+// unless that was already logged for its current state.
+func (fs *FileStore) reportBroken(name string, err error) {
+	info, statErr := os.Stat(filepath.Join(fs.dir, name))
+	if statErr == nil {
+		state := fileState{modTime: info.ModTime(), size: info.Size()}
+		if fs.broken[name] == state {
+			return
+		}
+		fs.broken[name] = state
+	}
+	log.Printf("Error reloading %s: %v\n", name, err)
+}
+
+// checkUnchanged returns ErrConflict if the data file name
+// was changed on disk since we last read or wrote it.
+func (fs *FileStore) checkUnchanged(name string) error {
+	changed, err := fs.changedOnDisk(name)
+	if err != nil {
+		return err
+	}
+	if changed {
+		return fmt.Errorf("%s was changed on disk, reloading it, please try again: %w", name, ErrConflict)
+	}
+	return nil
+}
+
+// reloadOnConflict reloads the data file name if err is
+// the ErrConflict returned when exporting it.
+func (fs *FileStore) reloadOnConflict(err error, name string) {
+	if !errors.Is(err, ErrConflict) {
+		return
+	}
+	if err := fs.reload(name); err != nil {
+		fs.reportBroken(name, err)
+		return
+	}
+	delete(fs.broken, name)
+}
+
+// changedOnDisk reports whether the data file name no longer holds what
+// we last read or wrote. A missing file counts as unchanged, it will
+// simply be written again.
+func (fs *FileStore) changedOnDisk(name string) (bool, error) {
+	fullPath := filepath.Join(fs.dir, name)
+	info, err := os.Stat(fullPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	known := fs.known[name]
+	if info.ModTime().Equal(known.modTime) && info.Size() == known.size {
+		return false, nil
+	}
+	// Only the contents matter, e.g. a sync tool may touch the file
+	// without changing it.
+	data, err := os.ReadFile(fullPath)
+	if err != nil {
+		return false, err
+	}
+	if sha256.Sum256(data) != known.sum {
+		return true, nil
+	}
+	fs.known[name] = fileState{modTime: info.ModTime(), size: info.Size(), sum: known.sum}
+	return false, nil
+}
+
+// reload replaces the records of the data file name with its
+// contents on disk. A file that cannot be decoded, e.g. because it is
+// still being edited, is left alone and keeps counting as changed.
+func (fs *FileStore) reload(name string) error {
+	fullPath := filepath.Join(fs.dir, name)
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(fullPath)
+	if err != nil {
+		return err
+	}
+	switch name {
+	case JOBS_MANAGER_JOBS_FILE:
+		jobsList := make([]*Job, 0)
+		if _, err := decodeDataFile(fullPath, data, &jobsList); err != nil {
+			return err
+		}
+		fs.jobs = make(map[string]*Job, len(jobsList))
+		for _, j := range jobsList {
+			fs.jobs[j.ID] = j
+		}
+	case JOBS_MANAGER_CUSTOMERS_FILE:
+		csList := make([]*Customer, 0)
+		if _, err := decodeDataFile(fullPath, data, &csList); err != nil {
+			return err
+		}
+		fs.customers = make(map[string]*Customer, len(csList))
+		for _, c := range csList {
+			fs.customers[c.ID] = c
+		}
+	case JOBS_MANAGER_INVOICES_FILE:
+		invList := make([]*Invoice, 0)
+		if _, err := decodeDataFile(fullPath, data, &invList); err != nil {
+			return err
+		}
+		fs.invoices = make(map[string]*Invoice, len(invList))
+		for _, inv := range invList {
+			fs.invoices[inv.ID] = inv
+		}
+	case JOBS_MANAGER_PAYMENTS_FILE:
+		payList := make([]*Payment, 0)
+		if _, err := decodeDataFile(fullPath, data, &payList); err != nil {
+			return err
+		}
+		fs.payments = make(map[string]*Payment, len(payList))
+		for _, p := range payList {
+			fs.payments[p.ID] = p
+		}
+	case JOBS_MANAGER_QUOTES_FILE:
+		qList := make([]*Quote, 0)
+		if _, err := decodeDataFile(fullPath, data, &qList); err != nil {
+			return err
+		}
+		fs.quotes = make(map[string]*Quote, len(qList))
+		for _, q := range qList {
+			fs.quotes[q.ID] = q
+		}
+	default:
+		return fmt.Errorf("unknown data file %s", name)
+	}
+	fs.known[name] = fileState{modTime: info.ModTime(), size: info.Size(), sum: sha256.Sum256(data)}
+	return nil
+}
+
+// remember records the current contents of the data file name
+// as the ones we last read or wrote.
+func (fs *FileStore) remember(name string) {
+	fullPath := filepath.Join(fs.dir, name)
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		log.Printf("Error checking %s: %v\n", name, err)
+		return
+	}
+	data, err := os.ReadFile(fullPath)
+	if err != nil {
+		log.Printf("Error checking %s: %v\n", name, err)
+		return
+	}
+	fs.known[name] = fileState{modTime: info.ModTime(), size: info.Size(), sum: sha256.Sum256(data)}
+}
@@ -1,79 +1,705 @@
 package jobs
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+	"sort"
 )
 
 const JOBS_MANAGER_CUSTOMERS_FILE = "jobsManager-customers.json"
 const JOBS_MANAGER_JOBS_FILE = "jobsManager-jobs.json"
+const JOBS_MANAGER_INVOICES_FILE = "jobsManager-invoices.json"
+const JOBS_MANAGER_PAYMENTS_FILE = "jobsManager-payments.json"
+const JOBS_MANAGER_QUOTES_FILE = "jobsManager-quotes.json"
 
-func openJobsFile(filepath string) []*Job {
-	fullPath := fmt.Sprintf("%s/%s", filepath, JOBS_MANAGER_JOBS_FILE)
-	if _, err := os.Stat(fullPath); errors.Is(err, os.ErrNotExist) {
-		createEmptyFile(fullPath)
-		writeJobsFile(filepath, []*Job{})
-		return []*Job{}
+// dataFileNames lists all the JSON data files.
+var dataFileNames = []string{
+	JOBS_MANAGER_JOBS_FILE,
+	JOBS_MANAGER_CUSTOMERS_FILE,
+	JOBS_MANAGER_INVOICES_FILE,
+	JOBS_MANAGER_PAYMENTS_FILE,
+	JOBS_MANAGER_QUOTES_FILE,
+}
+
+// FileStore is a Store that keeps everything in memory and
+// rewrites the JSON data files in dir on every change.
+// If a file cannot be written the change is rolled back in memory too.
+// Changes, and so file writes, are serialised by the MemoryStore lock.
+// Data files changed on disk by someone else are never overwritten,
+// see Watch.
+type FileStore struct {
+	*MemoryStore
+	dir string
+	// known holds the state of each data file as we last read or wrote it.
+	known map[string]fileState
+	// broken holds the state of data files that could not be reloaded,
+	// so that the error is only logged once.
+	broken map[string]fileState
+}
+
+func NewFileStore(dir string) (*FileStore, error) {
+	fs := &FileStore{
+		MemoryStore: NewMemoryStore(),
+		dir:         dir,
+		known:       make(map[string]fileState),
+		broken:      make(map[string]fileState),
 	}
-	file, err := os.ReadFile(fullPath)
+	jobsList, err := openJobsFile(dir)
 	if err != nil {
-		log.Fatal("Error opening file:", err)
+		return nil, err
 	}
-	datas := make([]*Job, 0)
-	if err := json.Unmarshal(file, &datas); err != nil {
-		log.Fatal("Error unmarshalling file:", err)
+	csList, err := openCustomersFile(dir)
+	if err != nil {
+		return nil, err
+	}
+	invList, err := openInvoicesFile(dir)
+	if err != nil {
+		return nil, err
+	}
+	payList, err := openPaymentsFile(dir)
+	if err != nil {
+		return nil, err
+	}
+	qList, err := openQuotesFile(dir)
+	if err != nil {
+		return nil, err
+	}
+	fs.replace(&Data{Jobs: jobsList, Customers: csList, Invoices: invList, Payments: payList, Quotes: qList})
+	for _, name := range dataFileNames {
+		fs.remember(name)
+	}
+	return fs, nil
+}
+
+func (fs *FileStore) PutJob(j *Job) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	prev, existed := fs.jobs[j.ID]
+	if err := fs.putJob(j); err != nil {
+		return err
+	}
+	if err := fs.exportJobs(); err != nil {
+		if existed {
+			fs.jobs[j.ID] = prev
+		} else {
+			delete(fs.jobs, j.ID)
+		}
+		fs.reloadOnConflict(err, JOBS_MANAGER_JOBS_FILE)
+		return err
+	}
+	return nil
+}
+
+// PutJobs saves all of jobsList with a single write of the jobs file.
+func (fs *FileStore) PutJobs(jobsList []*Job) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	// prev holds the jobs replaced, and nil for the new ones.
+	prev := make(map[string]*Job, len(jobsList))
+	for _, j := range jobsList {
+		if _, ok := prev[j.ID]; !ok {
+			prev[j.ID] = fs.jobs[j.ID]
+		}
+		if err := fs.putJob(j); err != nil {
+			return err
+		}
+	}
+	if err := fs.exportJobs(); err != nil {
+		for id, j := range prev {
+			if j != nil {
+				fs.jobs[id] = j
+			} else {
+				delete(fs.jobs, id)
+			}
+		}
+		fs.reloadOnConflict(err, JOBS_MANAGER_JOBS_FILE)
+		return err
+	}
+	return nil
+}
+
+func (fs *FileStore) DeleteJob(id string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	prev := fs.jobs[id]
+	if err := fs.deleteJob(id); err != nil {
+		return err
+	}
+	if err := fs.exportJobs(); err != nil {
+		fs.jobs[id] = prev
+		fs.reloadOnConflict(err, JOBS_MANAGER_JOBS_FILE)
+		return err
+	}
+	return nil
+}
+
+func (fs *FileStore) PutCustomer(c *Customer) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	prev, existed := fs.customers[c.ID]
+	if err := fs.putCustomer(c); err != nil {
+		return err
+	}
+	if err := fs.exportCustomers(); err != nil {
+		if existed {
+			fs.customers[c.ID] = prev
+		} else {
+			delete(fs.customers, c.ID)
+		}
+		fs.reloadOnConflict(err, JOBS_MANAGER_CUSTOMERS_FILE)
+		return err
+	}
+	return nil
+}
+
+// PutCustomers saves all of csList with a single write of the customers file.
+func (fs *FileStore) PutCustomers(csList []*Customer) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	// prev holds the customers replaced, and nil for the new ones.
+	prev := make(map[string]*Customer, len(csList))
+	for _, c := range csList {
+		if _, ok := prev[c.ID]; !ok {
+			prev[c.ID] = fs.customers[c.ID]
+		}
+		if err := fs.putCustomer(c); err != nil {
+			return err
+		}
+	}
+	if err := fs.exportCustomers(); err != nil {
+		for id, c := range prev {
+			if c != nil {
+				fs.customers[id] = c
+			} else {
+				delete(fs.customers, id)
+			}
+		}
+		fs.reloadOnConflict(err, JOBS_MANAGER_CUSTOMERS_FILE)
+		return err
+	}
+	return nil
+}
+
+func (fs *FileStore) DeleteCustomer(id string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	prev := fs.customers[id]
+	if err := fs.deleteCustomer(id); err != nil {
+		return err
+	}
+	if err := fs.exportCustomers(); err != nil {
+		fs.customers[id] = prev
+		fs.reloadOnConflict(err, JOBS_MANAGER_CUSTOMERS_FILE)
+		return err
+	}
+	return nil
+}
+
+func (fs *FileStore) PutInvoice(inv *Invoice) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	prev, existed := fs.invoices[inv.ID]
+	if err := fs.putInvoice(inv); err != nil {
+		return err
+	}
+	if err := fs.exportInvoices(); err != nil {
+		if existed {
+			fs.invoices[inv.ID] = prev
+		} else {
+			delete(fs.invoices, inv.ID)
+		}
+		fs.reloadOnConflict(err, JOBS_MANAGER_INVOICES_FILE)
+		return err
+	}
+	return nil
+}
+
+func (fs *FileStore) PutPayment(p *Payment) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	prev, existed := fs.payments[p.ID]
+	if err := fs.putPayment(p); err != nil {
+		return err
+	}
+	if err := fs.exportPayments(); err != nil {
+		if existed {
+			fs.payments[p.ID] = prev
+		} else {
+			delete(fs.payments, p.ID)
+		}
+		fs.reloadOnConflict(err, JOBS_MANAGER_PAYMENTS_FILE)
+		return err
+	}
+	return nil
+}
+
+func (fs *FileStore) DeletePayment(id string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	prev := fs.payments[id]
+	if err := fs.deletePayment(id); err != nil {
+		return err
+	}
+	if err := fs.exportPayments(); err != nil {
+		fs.payments[id] = prev
+		fs.reloadOnConflict(err, JOBS_MANAGER_PAYMENTS_FILE)
+		return err
+	}
+	return nil
+}
+
+func (fs *FileStore) PutQuote(q *Quote) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	prev, existed := fs.quotes[q.ID]
+	if err := fs.putQuote(q); err != nil {
+		return err
+	}
+	if err := fs.exportQuotes(); err != nil {
+		if existed {
+			fs.quotes[q.ID] = prev
+		} else {
+			delete(fs.quotes, q.ID)
+		}
+		fs.reloadOnConflict(err, JOBS_MANAGER_QUOTES_FILE)
+		return err
+	}
+	return nil
+}
+
+// Restore replaces all the records with the ones in the
+// JSON data files in dir and rewrites our own data files, even
+// if they were changed on disk.
+func (fs *FileStore) Restore(dir string) error {
+	data, err := ReadJSONFiles(dir)
+	if err != nil {
+		return err
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	for _, name := range dataFileNames {
+		fs.remember(name)
+	}
+	prev := &MemoryStore{jobs: fs.jobs, customers: fs.customers,
+		invoices: fs.invoices, payments: fs.payments, quotes: fs.quotes}
+	fs.replace(data)
+	if err := fs.exportAll(); err != nil {
+		fs.jobs, fs.customers, fs.invoices, fs.payments, fs.quotes =
+			prev.jobs, prev.customers, prev.invoices, prev.payments, prev.quotes
+		if rerr := fs.exportAll(); rerr != nil {
+			return fmt.Errorf("%v, and writing back the data from before failed: %w", err, rerr)
+		}
+		return err
+	}
+	return nil
+}
+
+func (fs *FileStore) exportAll() error {
+	if err := fs.exportJobs(); err != nil {
+		return err
+	}
+	if err := fs.exportCustomers(); err != nil {
+		return err
+	}
+	if err := fs.exportInvoices(); err != nil {
+		return err
+	}
+	if err := fs.exportPayments(); err != nil {
+		return err
+	}
+	return fs.exportQuotes()
+}
+
+// exportJobs and exportCustomers must be called with fs.mu held.
+// They return ErrConflict rather than overwrite a file changed on disk.
+func (fs *FileStore) exportJobs() error {
+	if err := fs.checkUnchanged(JOBS_MANAGER_JOBS_FILE); err != nil {
+		return err
+	}
+	jobsList, err := fs.listJobs()
+	if err != nil {
+		return err
+	}
+	sortJobs(jobsList)
+	if err := writeJobsFile(fs.dir, jobsList); err != nil {
+		return err
+	}
+	fs.remember(JOBS_MANAGER_JOBS_FILE)
+	return nil
+}
+
+func (fs *FileStore) exportCustomers() error {
+	if err := fs.checkUnchanged(JOBS_MANAGER_CUSTOMERS_FILE); err != nil {
+		return err
+	}
+	csList, err := fs.listCustomers()
+	if err != nil {
+		return err
+	}
+	if err := writeCustomersFile(fs.dir, csList); err != nil {
+		return err
+	}
+	fs.remember(JOBS_MANAGER_CUSTOMERS_FILE)
+	return nil
+}
+
+func (fs *FileStore) exportInvoices() error {
+	if err := fs.checkUnchanged(JOBS_MANAGER_INVOICES_FILE); err != nil {
+		return err
+	}
+	invList, err := fs.listInvoices()
+	if err != nil {
+		return err
 	}
+	if err := writeInvoicesFile(fs.dir, invList); err != nil {
+		return err
+	}
+	fs.remember(JOBS_MANAGER_INVOICES_FILE)
+	return nil
+}
+
+func (fs *FileStore) exportPayments() error {
+	if err := fs.checkUnchanged(JOBS_MANAGER_PAYMENTS_FILE); err != nil {
+		return err
+	}
+	payList, err := fs.listPayments()
+	if err != nil {
+		return err
+	}
+	if err := writePaymentsFile(fs.dir, payList); err != nil {
+		return err
+	}
+	fs.remember(JOBS_MANAGER_PAYMENTS_FILE)
+	return nil
+}
+
+func (fs *FileStore) exportQuotes() error {
+	if err := fs.checkUnchanged(JOBS_MANAGER_QUOTES_FILE); err != nil {
+		return err
+	}
+	qList, err := fs.listQuotes()
+	if err != nil {
+		return err
+	}
+	if err := writeQuotesFile(fs.dir, qList); err != nil {
+		return err
+	}
+	fs.remember(JOBS_MANAGER_QUOTES_FILE)
+	return nil
+}
+
+// ReadJSONFiles reads the JSON data files in dir without creating
+// or migrating them on disk. Missing files are treated as empty.
+func ReadJSONFiles(dir string) (*Data, error) {
+	data := &Data{
+		Jobs:      make([]*Job, 0),
+		Customers: make([]*Customer, 0),
+		Invoices:  make([]*Invoice, 0),
+		Payments:  make([]*Payment, 0),
+		Quotes:    make([]*Quote, 0),
+	}
+	if _, err := readDataFile(filepath.Join(dir, JOBS_MANAGER_JOBS_FILE), &data.Jobs); err != nil {
+		return nil, err
+	}
+	if _, err := readDataFile(filepath.Join(dir, JOBS_MANAGER_CUSTOMERS_FILE), &data.Customers); err != nil {
+		return nil, err
+	}
+	if _, err := readDataFile(filepath.Join(dir, JOBS_MANAGER_INVOICES_FILE), &data.Invoices); err != nil {
+		return nil, err
+	}
+	if _, err := readDataFile(filepath.Join(dir, JOBS_MANAGER_PAYMENTS_FILE), &data.Payments); err != nil {
+		return nil, err
+	}
+	if _, err := readDataFile(filepath.Join(dir, JOBS_MANAGER_QUOTES_FILE), &data.Quotes); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// SchemaVersion is the version of the data files written by this build.
+// Bump it, and add a migration, whenever the persisted shape of a
+// record changes.
+const SchemaVersion = 4
+
+// dataFile is the envelope the records of every data file are wrapped in.
+type dataFile struct {
+	Version int             `json:"version"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// migration upgrades data files from the previous schema version to
+// version. upgrade holds the changes to the records of each data file,
+// keyed by file name. Files without an entry only get their version bumped.
+type migration struct {
+	version int
+	upgrade map[string]func(records []map[string]any) error
+}
 
-	return datas
+// migrations must be kept in version order.
+var migrations = []migration{
+	// Version 0 files are bare arrays of records,
+	// version 1 wraps them in a dataFile.
+	{version: 1},
+	// Version 2 stores status keys instead of their labels.
+	{version: 2, upgrade: map[string]func(records []map[string]any) error{
+		JOBS_MANAGER_JOBS_FILE: migrateJobStatuses,
+	}},
+	// Version 3 records when jobs entered each status.
+	{version: 3, upgrade: map[string]func(records []map[string]any) error{
+		JOBS_MANAGER_JOBS_FILE: migrateStatusTimes,
+	}},
+	// Version 4 stores descriptions and notes as plain text instead of base64.
+	{version: 4, upgrade: map[string]func(records []map[string]any) error{
+		JOBS_MANAGER_JOBS_FILE:      migratePlainText("description"),
+		JOBS_MANAGER_CUSTOMERS_FILE: migratePlainText("note"),
+		JOBS_MANAGER_QUOTES_FILE:    migratePlainText("description"),
+	}},
 }
 
-func createEmptyFile(title string) {
-	file, err := os.Create(title) //create a new file
+// migrateRecords runs all the migrations newer than version on the
+// records of the data file name.
+func migrateRecords(name string, version int, records []map[string]any) error {
+	for _, m := range migrations {
+		if m.version <= version {
+			continue
+		}
+		upgrade, ok := m.upgrade[name]
+		if !ok {
+			continue
+		}
+		if err := upgrade(records); err != nil {
+			return fmt.Errorf("migrating %s to version %d: %w", name, m.version, err)
+		}
+	}
+	return nil
+}
+
+// readDataFile reads the records of the data file at fullPath into v,
+// migrating them to the current schema version if needed. It returns
+// the version the file was written with.
+func readDataFile(fullPath string, v any) (int, error) {
+	file, err := os.ReadFile(fullPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return SchemaVersion, nil
+	}
 	if err != nil {
-		log.Fatal(err)
-		return
+		return 0, fmt.Errorf("opening %s: %w", fullPath, err)
+	}
+	return decodeDataFile(fullPath, file, v)
+}
+
+// decodeDataFile is readDataFile for the contents
+// file already read from fullPath.
+func decodeDataFile(fullPath string, file []byte, v any) (int, error) {
+	file = bytes.TrimSpace(file)
+	if len(file) == 0 {
+		return 0, nil
+	}
+
+	df := dataFile{Version: 0, Data: file}
+	if file[0] != '[' {
+		if err := json.Unmarshal(file, &df); err != nil {
+			return 0, fmt.Errorf("unmarshalling %s: %w", fullPath, err)
+		}
+	}
+	if df.Version > SchemaVersion {
+		return 0, fmt.Errorf("%s has schema version %d, this build only understands up to %d",
+			fullPath, df.Version, SchemaVersion)
+	}
+
+	if df.Version < SchemaVersion {
+		records := make([]map[string]any, 0)
+		dec := json.NewDecoder(bytes.NewReader(df.Data))
+		dec.UseNumber()
+		if err := dec.Decode(&records); err != nil {
+			return 0, fmt.Errorf("unmarshalling %s: %w", fullPath, err)
+		}
+		if err := migrateRecords(filepath.Base(fullPath), df.Version, records); err != nil {
+			return 0, fmt.Errorf("%s: %w", fullPath, err)
+		}
+		data, err := json.Marshal(records)
+		if err != nil {
+			return 0, err
+		}
+		df.Data = data
+	}
+
+	if err := json.Unmarshal(df.Data, v); err != nil {
+		return 0, fmt.Errorf("unmarshalling %s: %w", fullPath, err)
 	}
-	defer file.Close()
+	return df.Version, nil
 }
 
-func openCustomersFile(filepath string) []*Customer {
-	fullPath := fmt.Sprintf("%s/%s", filepath, JOBS_MANAGER_CUSTOMERS_FILE)
-	if _, err := os.Stat(JOBS_MANAGER_CUSTOMERS_FILE); errors.Is(err, os.ErrNotExist) {
-		createEmptyFile(fullPath)
-		writeCustomersFile(filepath, []*Customer{})
-		return []*Customer{}
+// openDataFile reads the data file name in dir into v and calls write
+// to create it if it is missing. Files written with an older schema
+// version are migrated and rewritten, and the original is kept next
+// to them as <name>.v<version>.bak.
+func openDataFile(dir, name string, v any, write func() error) error {
+	fullPath := filepath.Join(dir, name)
+	if _, err := os.Stat(fullPath); errors.Is(err, os.ErrNotExist) {
+		return write()
+	}
+	version, err := readDataFile(fullPath, v)
+	if err != nil {
+		return err
 	}
-	file, err := os.ReadFile(JOBS_MANAGER_CUSTOMERS_FILE)
+	if version == SchemaVersion {
+		return nil
+	}
+	original, err := os.ReadFile(fullPath)
 	if err != nil {
-		log.Fatal("Error opening file:", err)
+		return err
+	}
+	backupPath := fmt.Sprintf("%s.v%d.bak", fullPath, version)
+	if err := writeFileAtomic(backupPath, original); err != nil {
+		return err
 	}
+	log.Printf("Migrated %s from schema version %d to %d, original kept in %s",
+		fullPath, version, SchemaVersion, backupPath)
+	return write()
+}
+
+func openJobsFile(dir string) ([]*Job, error) {
+	datas := make([]*Job, 0)
+	err := openDataFile(dir, JOBS_MANAGER_JOBS_FILE, &datas, func() error {
+		return writeJobsFile(dir, datas)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return datas, nil
+}
+
+func openCustomersFile(dir string) ([]*Customer, error) {
 	datas := make([]*Customer, 0)
-	if err := json.Unmarshal(file, &datas); err != nil {
-		log.Fatal("Error unmarshalling file:", err)
+	err := openDataFile(dir, JOBS_MANAGER_CUSTOMERS_FILE, &datas, func() error {
+		return writeCustomersFile(dir, datas)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return datas, nil
+}
+
+func openInvoicesFile(dir string) ([]*Invoice, error) {
+	datas := make([]*Invoice, 0)
+	err := openDataFile(dir, JOBS_MANAGER_INVOICES_FILE, &datas, func() error {
+		return writeInvoicesFile(dir, datas)
+	})
+	if err != nil {
+		return nil, err
 	}
+	return datas, nil
+}
 
-	return datas
+func openPaymentsFile(dir string) ([]*Payment, error) {
+	datas := make([]*Payment, 0)
+	err := openDataFile(dir, JOBS_MANAGER_PAYMENTS_FILE, &datas, func() error {
+		return writePaymentsFile(dir, datas)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return datas, nil
 }
 
-func writeJobsFile(filepath string, rows []*Job) {
-	fullPath := fmt.Sprintf("%s/%s", filepath, JOBS_MANAGER_JOBS_FILE)
-	bytes, err := json.Marshal(rows)
+func openQuotesFile(dir string) ([]*Quote, error) {
+	datas := make([]*Quote, 0)
+	err := openDataFile(dir, JOBS_MANAGER_QUOTES_FILE, &datas, func() error {
+		return writeQuotesFile(dir, datas)
+	})
 	if err != nil {
-		log.Fatal("Error marshal rows:", err)
+		return nil, err
+	}
+	return datas, nil
+}
+
+func writeJobsFile(dir string, rows []*Job) error {
+	return writeDataFile(filepath.Join(dir, JOBS_MANAGER_JOBS_FILE), rows)
+}
+
+func writeCustomersFile(dir string, rows []*Customer) error {
+	return writeDataFile(filepath.Join(dir, JOBS_MANAGER_CUSTOMERS_FILE), rows)
+}
+
+func writeInvoicesFile(dir string, rows []*Invoice) error {
+	sort.Slice(rows, func(i, j int) bool {
+		return rows[i].Number < rows[j].Number
+	})
+	return writeDataFile(filepath.Join(dir, JOBS_MANAGER_INVOICES_FILE), rows)
+}
+
+func writePaymentsFile(dir string, rows []*Payment) error {
+	sort.Slice(rows, func(i, j int) bool {
+		return rows[i].RecordedAt.Before(rows[j].RecordedAt)
+	})
+	return writeDataFile(filepath.Join(dir, JOBS_MANAGER_PAYMENTS_FILE), rows)
+}
+
+func writeQuotesFile(dir string, rows []*Quote) error {
+	sort.Slice(rows, func(i, j int) bool {
+		return rows[i].Number < rows[j].Number
+	})
+	return writeDataFile(filepath.Join(dir, JOBS_MANAGER_QUOTES_FILE), rows)
+}
 
+// writeDataFile writes rows to fullPath wrapped in a dataFile
+// with the current schema version.
+func writeDataFile(fullPath string, rows any) error {
+	data, err := json.Marshal(rows)
+	if err != nil {
+		return fmt.Errorf("marshalling %s: %w", filepath.Base(fullPath), err)
+	}
+	file, err := json.Marshal(dataFile{Version: SchemaVersion, Data: data})
+	if err != nil {
+		return fmt.Errorf("marshalling %s: %w", filepath.Base(fullPath), err)
 	}
-	os.WriteFile(fullPath, bytes, os.ModePerm)
+	return writeFileAtomic(fullPath, file)
 }
 
-func writeCustomersFile(filepath string, rows []*Customer) {
-	fullPath := fmt.Sprintf("%s/%s", filepath, JOBS_MANAGER_CUSTOMERS_FILE)
-	bytes, err := json.Marshal(rows)
+// writeFileAtomic writes data to a temporary file next to fullPath,
+// syncs it to disk and renames it over fullPath. A crash half way
+// through leaves either the old or the new file, never a truncated one.
+func writeFileAtomic(fullPath string, data []byte) (err error) {
+	dir := filepath.Dir(fullPath)
+	tmp, err := os.CreateTemp(dir, filepath.Base(fullPath)+".tmp-*")
 	if err != nil {
-		log.Fatal("Error marshal rows:", err)
+		return fmt.Errorf("writing %s: %w", fullPath, err)
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+			err = fmt.Errorf("writing %s: %w", fullPath, err)
+		}
+	}()
+
+	if _, err = tmp.Write(data); err != nil {
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp.Name(), fullPath); err != nil {
+		return err
+	}
 
+	// Make the rename itself durable. Not every platform lets
+	// us sync a directory, so this is best effort.
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
 	}
-	os.WriteFile(fullPath, bytes, os.ModePerm)
+	return nil
 }
@@ -0,0 +1,159 @@
+package jobs
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMigrateDataFiles(t *testing.T) {
+	encode := func(s string) string {
+		return base64.StdEncoding.EncodeToString([]byte(s))
+	}
+	description, note := "Cables\n**two** of them", "Pays *late*"
+	job := func(status, description string, entered bool) string {
+		j := `{"id":"j1","order_date":"2024-03-01T00:00:00Z","deadline_date":"2024-03-15T00:00:00Z",` +
+			`"status":"` + status + `","customer_id":"c1","description":"` + strings.ReplaceAll(description, "\n", `\n`) + `"`
+		if entered {
+			j += `,"entered_status_at":{"` + status + `":"2024-03-01T00:00:00Z"}`
+		}
+		return j + "}"
+	}
+	customer := func(note string) string {
+		return `{"id":"c1","name":"Acme","note":"` + note + `"}`
+	}
+	quote := func(description string) string {
+		return `{"id":"q1","number":1,"customer_id":"c1","description":"` + strings.ReplaceAll(description, "\n", `\n`) + `"}`
+	}
+	envelope := func(version int, record string) string {
+		return fmt.Sprintf(`{"version":%d,"data":[%s]}`, version, record)
+	}
+
+	tests := []struct {
+		name    string
+		file    string
+		version int
+		content string
+		// want is the file as this build writes it.
+		want string
+	}{
+		{"jobs v0", JOBS_MANAGER_JOBS_FILE, 0, "[" + job("New ⭐️", encode(description), false) + "]",
+			envelope(4, job("new", description, true))},
+		{"jobs v1", JOBS_MANAGER_JOBS_FILE, 1, envelope(1, job("Completed & Shipped ✅", encode(description), false)),
+			envelope(4, job("shipped", description, true))},
+		{"jobs v2", JOBS_MANAGER_JOBS_FILE, 2, envelope(2, job("new", encode(description), false)),
+			envelope(4, job("new", description, true))},
+		{"jobs v3", JOBS_MANAGER_JOBS_FILE, 3, envelope(3, job("new", encode(description), true)),
+			envelope(4, job("new", description, true))},
+		{"customers v0", JOBS_MANAGER_CUSTOMERS_FILE, 0, "[" + customer(encode(note)) + "]",
+			envelope(4, customer(note))},
+		{"customers v1", JOBS_MANAGER_CUSTOMERS_FILE, 1, envelope(1, customer(encode(note))),
+			envelope(4, customer(note))},
+		{"customers v2", JOBS_MANAGER_CUSTOMERS_FILE, 2, envelope(2, customer(encode(note))),
+			envelope(4, customer(note))},
+		{"customers v3", JOBS_MANAGER_CUSTOMERS_FILE, 3, envelope(3, customer(encode(note))),
+			envelope(4, customer(note))},
+		{"quotes v3", JOBS_MANAGER_QUOTES_FILE, 3, envelope(3, quote(encode(description))),
+			envelope(4, quote(description))},
+		// Plain text that happens to be valid base64 is left
+		// alone once the file is at the current version.
+		{"customers v4", JOBS_MANAGER_CUSTOMERS_FILE, 4, envelope(4, customer("TWFu")),
+			envelope(4, customer("TWFu"))},
+	}
+	if SchemaVersion != 4 {
+		t.Fatalf("SchemaVersion is %d, add fixtures for the files written before it", SchemaVersion)
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			fullPath := filepath.Join(dir, tt.file)
+			want := decodeTestFile(t, fullPath, []byte(tt.want), SchemaVersion)
+			if got := decodeTestFile(t, fullPath, []byte(tt.content), tt.version); got != want {
+				t.Errorf("decoded\n%s\nwant\n%s", got, want)
+			}
+
+			if err := os.WriteFile(fullPath, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := NewFileStore(dir); err != nil {
+				t.Fatal(err)
+			}
+			written, err := os.ReadFile(fullPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := decodeTestFile(t, fullPath, written, SchemaVersion); got != want {
+				t.Errorf("rewrote the file with\n%s\nwant\n%s", got, want)
+			}
+			backupPath := fmt.Sprintf("%s.v%d.bak", fullPath, tt.version)
+			backup, err := os.ReadFile(backupPath)
+			if tt.version == SchemaVersion {
+				if err == nil {
+					t.Errorf("backed up %s, which is at the current version", tt.file)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("no backup of the original: %v", err)
+			}
+			if string(backup) != tt.content {
+				t.Errorf("backup holds\n%s\nwant the original\n%s", backup, tt.content)
+			}
+		})
+	}
+}
+
+// decodeTestFile decodes the data file file, checks that it was written
+// with version and returns its records as this build marshals them.
+func decodeTestFile(t *testing.T, fullPath string, file []byte, version int) string {
+	t.Helper()
+	var records any
+	switch filepath.Base(fullPath) {
+	case JOBS_MANAGER_JOBS_FILE:
+		records = &[]*Job{}
+	case JOBS_MANAGER_CUSTOMERS_FILE:
+		records = &[]*Customer{}
+	case JOBS_MANAGER_QUOTES_FILE:
+		records = &[]*Quote{}
+	}
+	got, err := decodeDataFile(fullPath, file, records)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != version {
+		t.Errorf("decoded %s as version %d, want %d", filepath.Base(fullPath), got, version)
+	}
+	data, err := json.Marshal(records)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestRejectFutureDataFiles(t *testing.T) {
+	dir := t.TempDir()
+	fullPath := filepath.Join(dir, JOBS_MANAGER_JOBS_FILE)
+	content := fmt.Sprintf(`{"version":%d,"data":[]}`, SchemaVersion+1)
+	if err := os.WriteFile(fullPath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	jobsList := make([]*Job, 0)
+	if _, err := decodeDataFile(fullPath, []byte(content), &jobsList); err == nil {
+		t.Error("decoded a file from a newer version")
+	}
+	if _, err := NewFileStore(dir); err == nil {
+		t.Error("opened a store with a file from a newer version")
+	}
+	written, err := os.ReadFile(fullPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(written) != content {
+		t.Errorf("changed the newer file to %s", written)
+	}
+}
@@ -0,0 +1,603 @@
+package jobs
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// The kinds of records that can be imported.
+const (
+	ImportJobs      = "jobs"
+	ImportCustomers = "customers"
+)
+
+// ImportOptions say how to read an imported CSV file.
+type ImportOptions struct {
+	// Kind is ImportJobs or ImportCustomers.
+	Kind string
+	// Columns maps fields to the names of the columns they are read
+	// from. The other fields are read from the columns named like them.
+	Columns map[string]string
+	// MonthFirst reads dates like 03/04/2024 as the 4th of March,
+	// rather than as the 3rd of April.
+	MonthFirst bool
+	// DryRun checks the file without importing anything.
+	DryRun bool
+}
+
+// ParseImportOptions reads ImportOptions from the query parameters of
+// POST /import: kind, dryRun, dates (dmy or mdy) and a map.<field>
+// parameter naming the column of every field that is not found by name.
+func ParseImportOptions(v url.Values) (*ImportOptions, error) {
+	verr := &ValidationError{Entity: "import"}
+	opts := &ImportOptions{Kind: v.Get("kind"), Columns: make(map[string]string)}
+	fields := importFields[opts.Kind]
+	if fields == nil {
+		verr.add("kind", "%q is neither %s nor %s", opts.Kind, ImportJobs, ImportCustomers)
+	}
+	if s := v.Get("dryRun"); s != "" {
+		dryRun, err := strconv.ParseBool(s)
+		if err != nil {
+			verr.add("dryRun", "%q is neither true nor false", s)
+		}
+		opts.DryRun = dryRun
+	}
+	switch dates := v.Get("dates"); dates {
+	case "", "dmy":
+	case "mdy":
+		opts.MonthFirst = true
+	default:
+		verr.add("dates", "%q is neither dmy nor mdy", dates)
+	}
+	for param := range v {
+		field := strings.TrimPrefix(param, "map.")
+		if field == param || fields == nil {
+			continue
+		}
+		if findImportField(fields, field) == nil {
+			verr.add(param, "is not a field of %s", opts.Kind)
+			continue
+		}
+		opts.Columns[field] = v.Get(param)
+	}
+	return opts, verr.err()
+}
+
+// ImportRowError lists the problems with a row of an imported file.
+type ImportRowError struct {
+	// Line is where the row starts in the file, counting from 1.
+	Line   int           `json:"line"`
+	Fields []*FieldError `json:"fields"`
+}
+
+// ImportReport says how an import went. Nothing is imported
+// unless every row is fine and it is not a dry run.
+type ImportReport struct {
+	Kind   string `json:"kind"`
+	DryRun bool   `json:"dry_run"`
+	// Columns are the names of the columns the fields were read from.
+	Columns map[string]string `json:"columns"`
+	Rows    int               `json:"rows"`
+	Errors  []*ImportRowError `json:"errors"`
+	// IDs are the IDs of the records imported, in the order of the rows.
+	IDs []string `json:"ids"`
+}
+
+// importField is a field read from a column of an imported file.
+type importField struct {
+	name string
+	// aliases are the other names its column goes by,
+	// such as the ones in exported spreadsheets.
+	aliases []string
+	// required fields must have a column.
+	required bool
+}
+
+var importFields = map[string][]*importField{
+	ImportJobs: {
+		{name: "order_date", aliases: []string{"ordered", "date"}, required: true},
+		{name: "deadline_date", aliases: []string{"deadline", "due", "due_date"}, required: true},
+		{name: "status"},
+		{name: "customer", aliases: []string{"customer_id", "customer_name", "client"}},
+		{name: "description", aliases: []string{"notes"}},
+		{name: "item", aliases: []string{"item_description"}},
+		{name: "quantity", aliases: []string{"qty"}},
+		{name: "unit_price", aliases: []string{"price", "amount", "subtotal"}},
+		{name: "tax_rate", aliases: []string{"vat_rate"}},
+	},
+	ImportCustomers: {
+		{name: "name", aliases: []string{"customer", "customer_name"}, required: true},
+		{name: "note", aliases: []string{"notes"}},
+		{name: "contact_person", aliases: []string{"contact"}},
+		{name: "emails", aliases: []string{"email"}},
+		{name: "phones", aliases: []string{"phone"}},
+		{name: "vat_number", aliases: []string{"vat"}},
+		{name: "payment_terms_days", aliases: []string{"payment_terms"}},
+		{name: "billing_line1"},
+		{name: "billing_line2"},
+		{name: "billing_city"},
+		{name: "billing_postcode"},
+		{name: "billing_country"},
+		{name: "shipping_line1"},
+		{name: "shipping_line2"},
+		{name: "shipping_city"},
+		{name: "shipping_postcode"},
+		{name: "shipping_country"},
+	},
+}
+
+func findImportField(fields []*importField, name string) *importField {
+	for _, f := range fields {
+		if f.name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// ImportService imports jobs and customers from CSV files, through
+// the job and customer services so that the records are validated
+// and audited like the ones entered by hand. It is safe for
+// concurrent use, and runs one import at a time.
+type ImportService struct {
+	mu        sync.Mutex
+	jobs      *JobService
+	customers *CustomerService
+}
+
+func NewImportService(jobs *JobService, customers *CustomerService) *ImportService {
+	return &ImportService{jobs: jobs, customers: customers}
+}
+
+// importRow is a row of an imported file.
+type importRow struct {
+	line    int
+	values  []string
+	columns map[string]int
+	// decimalComma is whether the file was separated by semicolons,
+	// which is how the spreadsheets that write 12,50 for 12.50 do it.
+	decimalComma bool
+}
+
+// get returns the value of field in the row, or "" if it has none.
+func (row *importRow) get(field string) string {
+	i, ok := row.columns[field]
+	if !ok || i >= len(row.values) {
+		return ""
+	}
+	return strings.TrimSpace(row.values[i])
+}
+
+// Import reads the records in the CSV file r, with a row of column
+// names on top, and adds them all, or none of them if any row has a
+// problem. The report lists the problems. Jobs find their customer by
+// ID or by name, and the customers imported must not exist yet.
+func (ims *ImportService) Import(ctx context.Context, r io.Reader, opts *ImportOptions) (*ImportReport, error) {
+	ims.mu.Lock()
+	defer ims.mu.Unlock()
+	fields := importFields[opts.Kind]
+	if fields == nil {
+		verr := &ValidationError{Entity: "import"}
+		verr.add("kind", "%q is neither %s nor %s", opts.Kind, ImportJobs, ImportCustomers)
+		return nil, verr
+	}
+	rows, columns, err := readImportFile(r, fields, opts.Columns)
+	if err != nil {
+		return nil, err
+	}
+	report := &ImportReport{
+		Kind:    opts.Kind,
+		DryRun:  opts.DryRun,
+		Columns: columns,
+		Rows:    len(rows),
+		Errors:  make([]*ImportRowError, 0),
+		IDs:     make([]string, 0),
+	}
+	if opts.Kind == ImportJobs {
+		err = ims.importJobs(ctx, rows, opts, report)
+	} else {
+		err = ims.importCustomers(ctx, rows, report)
+	}
+	return report, err
+}
+
+func (ims *ImportService) importJobs(ctx context.Context, rows []*importRow, opts *ImportOptions, report *ImportReport) error {
+	if len(JobStatusList) == 0 {
+		return errors.New("there are no job statuses to start the jobs in")
+	}
+	customers, err := ims.customers.ListCustomers()
+	if err != nil {
+		return err
+	}
+	byName := make(map[string][]*Customer)
+	byID := make(map[string]*Customer)
+	for _, c := range customers {
+		byID[c.ID] = c
+		name := nameKey(c.Name)
+		byName[name] = append(byName[name], c)
+	}
+
+	jobsList := make([]*Job, 0, len(rows))
+	for _, row := range rows {
+		verr := &ValidationError{Entity: AuditEntityJob}
+		j := &Job{
+			OrderDate:    readImportDate(row, "order_date", opts.MonthFirst, verr),
+			DeadlineDate: readImportDate(row, "deadline_date", opts.MonthFirst, verr),
+			Status:       JobStatusList[0].Key,
+			Description:  row.get("description"),
+		}
+		if s := row.get("status"); s != "" {
+			if j.Status = findStatus(s); j.Status == "" {
+				verr.add("status", "%q is not a known status", s)
+			}
+		}
+		if s := row.get("customer"); s != "" {
+			if c, ok := byID[s]; ok {
+				j.CustomerID = c.ID
+			} else if matches := byName[nameKey(s)]; len(matches) == 1 {
+				j.CustomerID = matches[0].ID
+			} else if len(matches) > 1 {
+				verr.add("customer", "%d customers are called %q, use the ID of one", len(matches), s)
+			} else {
+				verr.add("customer", "%q is not the name or ID of a customer", s)
+			}
+		}
+		if item := readImportItem(row, j.Description, verr); item != nil {
+			j.Items = []*LineItem{item}
+		}
+		if err := ims.jobs.validate(j); err != nil && !addFieldErrors(err, verr) {
+			return err
+		}
+		if len(verr.Fields) > 0 {
+			report.Errors = append(report.Errors, &ImportRowError{Line: row.line, Fields: verr.Fields})
+		}
+		jobsList = append(jobsList, j)
+	}
+	if len(report.Errors) > 0 || opts.DryRun {
+		return nil
+	}
+	if err := ims.jobs.AddJobs(ctx, jobsList); err != nil {
+		return err
+	}
+	for _, j := range jobsList {
+		report.IDs = append(report.IDs, j.ID)
+	}
+	return nil
+}
+
+func (ims *ImportService) importCustomers(ctx context.Context, rows []*importRow, report *ImportReport) error {
+	existing, err := ims.customers.ListCustomers()
+	if err != nil {
+		return err
+	}
+	names := make(map[string]int)
+	for _, c := range existing {
+		names[nameKey(c.Name)] = 0
+	}
+
+	customers := make([]*Customer, 0, len(rows))
+	for _, row := range rows {
+		verr := &ValidationError{Entity: AuditEntityCustomer}
+		c := &Customer{
+			Name:            row.get("name"),
+			Note:            row.get("note"),
+			ContactPerson:   row.get("contact_person"),
+			Emails:          splitList(row.get("emails"), emailSeparators),
+			Phones:          splitList(row.get("phones"), phoneSeparators),
+			VATNumber:       row.get("vat_number"),
+			BillingAddress:  readImportAddress(row, "billing"),
+			ShippingAddress: readImportAddress(row, "shipping"),
+		}
+		if s := row.get("payment_terms_days"); s != "" {
+			days, err := strconv.Atoi(s)
+			if err != nil {
+				verr.add("payment_terms_days", "%q is not a number of days", s)
+			}
+			c.PaymentTermsDays = &days
+		}
+		name := nameKey(c.Name)
+		if line, ok := names[name]; ok && name != "" {
+			if line == 0 {
+				verr.add("name", "a customer called %q already exists", c.Name)
+			} else {
+				verr.add("name", "%q is also imported on line %d", c.Name, line)
+			}
+		} else {
+			names[name] = row.line
+		}
+		if err := validateCustomer(c); err != nil {
+			addFieldErrors(err, verr)
+		}
+		if len(verr.Fields) > 0 {
+			report.Errors = append(report.Errors, &ImportRowError{Line: row.line, Fields: verr.Fields})
+		}
+		customers = append(customers, c)
+	}
+	if len(report.Errors) > 0 || report.DryRun {
+		return nil
+	}
+	if err := ims.customers.AddCustomers(ctx, customers); err != nil {
+		return err
+	}
+	for _, c := range customers {
+		report.IDs = append(report.IDs, c.ID)
+	}
+	return nil
+}
+
+// nameKey returns what customer names are told apart by,
+// so that " acme" and "Acme" are the same customer.
+func nameKey(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// addFieldErrors adds the problems with the fields of err to verr,
+// leaving out the fields it already has a problem with, and reports
+// whether err was a *ValidationError.
+func addFieldErrors(err error, verr *ValidationError) bool {
+	fieldErr, ok := err.(*ValidationError)
+	if !ok {
+		return false
+	}
+	seen := make(map[string]bool)
+	for _, f := range verr.Fields {
+		seen[f.Field] = true
+	}
+	for _, f := range fieldErr.Fields {
+		if !seen[f.Field] {
+			verr.Fields = append(verr.Fields, f)
+		}
+	}
+	return true
+}
+
+// readImportFile reads the rows of the CSV file r and finds the columns
+// of fields in its first row. The columns can be separated by commas or,
+// like spreadsheets in much of Europe write them, by semicolons.
+func readImportFile(r io.Reader, fields []*importField, mapping map[string]string) ([]*importRow, map[string]string, error) {
+	verr := &ValidationError{Entity: "import"}
+	br := bufio.NewReader(r)
+	if bom, _ := br.Peek(3); string(bom) == "\xef\xbb\xbf" {
+		br.Discard(3)
+	}
+	firstLine, _ := br.Peek(4096)
+	cr := csv.NewReader(br)
+	cr.FieldsPerRecord = -1
+	if i := strings.IndexByte(string(firstLine), '\n'); i >= 0 {
+		firstLine = firstLine[:i]
+	}
+	if strings.Count(string(firstLine), ";") > strings.Count(string(firstLine), ",") {
+		cr.Comma = ';'
+	}
+	header, err := cr.Read()
+	if err == io.EOF {
+		verr.add("file", "is empty")
+		return nil, nil, verr
+	}
+	if err != nil {
+		verr.add("file", "is not CSV: %v", err)
+		return nil, nil, verr
+	}
+
+	columns := make(map[string]int)
+	names := make(map[string]string)
+	for _, f := range fields {
+		want := append([]string{f.name}, f.aliases...)
+		if name, ok := mapping[f.name]; ok {
+			want = []string{name}
+		}
+		for i, h := range header {
+			if _, ok := columns[f.name]; ok {
+				break
+			}
+			for _, w := range want {
+				if columnKey(h) == columnKey(w) {
+					columns[f.name], names[f.name] = i, h
+					break
+				}
+			}
+		}
+		if _, ok := columns[f.name]; !ok {
+			if name, ok := mapping[f.name]; ok {
+				verr.add("map."+f.name, "there is no column called %q", name)
+			} else if f.required {
+				verr.add(f.name, "has no column, name it %q or map it to one", f.name)
+			}
+		}
+	}
+	if err := verr.err(); err != nil {
+		return nil, nil, err
+	}
+
+	rows := make([]*importRow, 0)
+	for {
+		values, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			verr.add("file", "is not CSV: %v", err)
+			return nil, nil, verr
+		}
+		if strings.TrimSpace(strings.Join(values, "")) == "" {
+			continue
+		}
+		line, _ := cr.FieldPos(0)
+		rows = append(rows, &importRow{line: line, values: values, columns: columns, decimalComma: cr.Comma == ';'})
+	}
+	return rows, names, nil
+}
+
+// columnKey returns the letters and digits of a column name in
+// lower case, so that "Order Date" is the column of order_date.
+func columnKey(name string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, name)
+}
+
+// findStatus returns the key of the status s is the key or
+// label of, ignoring case and emoji, or "" if there is none.
+func findStatus(s string) string {
+	for _, status := range JobStatusList {
+		if columnKey(s) == columnKey(status.Key) || columnKey(s) == columnKey(status.Label) {
+			return status.Key
+		}
+	}
+	return ""
+}
+
+// The layouts of the dates that can be imported, besides the numeric
+// ones in dayFirstLayouts or monthFirstLayouts.
+var dateLayouts = []string{
+	JobsDateFormat,
+	"2006/01/02",
+	"2006.01.02",
+	time.RFC3339,
+	"2 Jan 2006",
+	"2 January 2006",
+	"2-Jan-2006",
+	"2-Jan-06",
+	"Jan 2, 2006",
+	"January 2, 2006",
+	"Mon, 2 Jan 2006",
+}
+
+var (
+	dayFirstLayouts   = []string{"2/1/2006", "2.1.2006", "2-1-2006", "2/1/06", "2.1.06"}
+	monthFirstLayouts = []string{"1/2/2006", "1.2.2006", "1-2-2006", "1/2/06", "1.2.06"}
+)
+
+// readImportDate reads the day in field of row.
+func readImportDate(row *importRow, field string, monthFirst bool, verr *ValidationError) *time.Time {
+	s := row.get(field)
+	if s == "" {
+		return nil
+	}
+	layouts := append(dayFirstLayouts, dateLayouts...)
+	if monthFirst {
+		layouts = append(monthFirstLayouts, dateLayouts...)
+	}
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+			return &day
+		}
+	}
+	verr.add(field, "%q is not a date, such as %s", s, time.Now().Format(JobsDateFormat))
+	return nil
+}
+
+// readImportItem reads the line item of a job from row,
+// or returns nil if it has none.
+func readImportItem(row *importRow, jobDescription string, verr *ValidationError) *LineItem {
+	price, quantity, taxRate := row.get("unit_price"), row.get("quantity"), row.get("tax_rate")
+	if price == "" && row.get("item") == "" {
+		return nil
+	}
+	li := &LineItem{Description: row.get("item"), Quantity: 1}
+	if li.Description == "" {
+		// Jobs with a price but no items are for what they describe.
+		li.Description = strings.TrimSpace(strings.SplitN(jobDescription, "\n", 2)[0])
+	}
+	if price != "" {
+		cents, err := readImportPrice(price, row.decimalComma)
+		if err != nil {
+			verr.add("unit_price", "%v", err)
+		}
+		li.UnitPrice = cents
+	}
+	if quantity != "" {
+		q, err := strconv.ParseFloat(quantity, 64)
+		if err != nil {
+			verr.add("quantity", "%q is not a number", quantity)
+		}
+		li.Quantity = q
+	}
+	if taxRate != "" {
+		rate, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(taxRate, "%")), 64)
+		if err != nil {
+			verr.add("tax_rate", "%q is not a percentage", taxRate)
+		}
+		li.TaxRate = rate
+	}
+	return li
+}
+
+var (
+	decimalCommaPrice   = regexp.MustCompile(`^\d+,\d{2}$`)
+	thousandsCommaPrice = regexp.MustCompile(`^\d{1,3}(,\d{3})+\.\d+$`)
+)
+
+// readImportPrice reads the price s in cents. A comma is the decimal
+// separator in files separated by semicolons, and in prices such as
+// 12,50 with two digits after it. It separates the thousands in prices
+// such as 1,250.00, and any other price with a comma is ambiguous.
+func readImportPrice(s string, decimalComma bool) (int64, error) {
+	amount := strings.TrimLeft(s, "£$€ ")
+	switch {
+	case !strings.Contains(amount, ","):
+	case decimalComma:
+		amount = strings.ReplaceAll(strings.ReplaceAll(amount, ".", ""), ",", ".")
+	case decimalCommaPrice.MatchString(amount):
+		amount = strings.ReplaceAll(amount, ",", ".")
+	case thousandsCommaPrice.MatchString(amount):
+		amount = strings.ReplaceAll(amount, ",", "")
+	default:
+		return 0, fmt.Errorf("%q is ambiguous, write it as 1250.00 or 1,250.00", s)
+	}
+	cents, err := ParseCents(amount)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not an amount", s)
+	}
+	return cents, nil
+}
+
+// readImportAddress reads the address whose fields start
+// with prefix from row, or returns nil if it has none.
+func readImportAddress(row *importRow, prefix string) *Address {
+	a := &Address{
+		Line1:    row.get(prefix + "_line1"),
+		Line2:    row.get(prefix + "_line2"),
+		City:     row.get(prefix + "_city"),
+		Postcode: row.get(prefix + "_postcode"),
+		Country:  row.get(prefix + "_country"),
+	}
+	if *a == (Address{}) {
+		return nil
+	}
+	return a
+}
+
+var (
+	emailSeparators = regexp.MustCompile(`[,;\s]+`)
+	phoneSeparators = regexp.MustCompile(`[,;\n]+`)
+)
+
+// splitList splits s into the items separated by separators.
+func splitList(s string, separators *regexp.Regexp) []string {
+	items := make([]string, 0)
+	for _, item := range separators.Split(s, -1) {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	if len(items) == 0 {
+		return nil
+	}
+	return items
+}
@@ -0,0 +1,227 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadImportPrice(t *testing.T) {
+	tests := []struct {
+		price        string
+		decimalComma bool
+		want         int64
+		ambiguous    bool
+	}{
+		{"12.50", false, 1250, false},
+		{"£12.50", false, 1250, false},
+		{"12,50", false, 1250, false},
+		{"€ 12,50", false, 1250, false},
+		{"1,250.00", false, 125000, false},
+		{"1,250", false, 0, true},
+		{"12,5", false, 0, true},
+		{"12,5", true, 1250, false},
+		{"1.250,00", true, 125000, false},
+		{"1250", true, 125000, false},
+	}
+	for _, tt := range tests {
+		got, err := readImportPrice(tt.price, tt.decimalComma)
+		if tt.ambiguous {
+			if err == nil {
+				t.Errorf("readImportPrice(%q, %v) = %d, want an error", tt.price, tt.decimalComma, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("readImportPrice(%q, %v) = %d, %v, want %d", tt.price, tt.decimalComma, got, err, tt.want)
+		}
+	}
+}
+
+// newTestImportService returns an import service and the store it
+// imports into, which holds the customers called names.
+func newTestImportService(t *testing.T, names ...string) (*ImportService, *MemoryStore, []*Customer) {
+	t.Helper()
+	store := NewMemoryStore()
+	js := NewJobService(store, store, nil)
+	cs := NewCustomerService(store, nil, js)
+	customers := make([]*Customer, 0, len(names))
+	for _, name := range names {
+		c := &Customer{Name: name}
+		if err := cs.AddCustomer(context.Background(), c); err != nil {
+			t.Fatal(err)
+		}
+		customers = append(customers, c)
+	}
+	return NewImportService(js, cs), store, customers
+}
+
+// importErrors lists the problems in report for test failures.
+func importErrors(report *ImportReport) string {
+	problems := make([]string, 0)
+	for _, e := range report.Errors {
+		for _, f := range e.Fields {
+			problems = append(problems, fmt.Sprintf("line %d: %s %s", e.Line, f.Field, f.Message))
+		}
+	}
+	return "[" + strings.Join(problems, "; ") + "]"
+}
+
+// importTestFile imports file with the options in the query params.
+func importTestFile(t *testing.T, ims *ImportService, params, file string) *ImportReport {
+	t.Helper()
+	v, err := url.ParseQuery(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts, err := ParseImportOptions(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := ims.Import(context.Background(), strings.NewReader(file), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return report
+}
+
+func TestImportDryRun(t *testing.T) {
+	ims, store, _ := newTestImportService(t)
+	report := importTestFile(t, ims, "kind=customers&dryRun=true", "name,email\nAcme,office@acme.test\nBeta,\n")
+	if report.Rows != 2 || len(report.Errors) != 0 || len(report.IDs) != 0 {
+		t.Errorf("dry run read %d rows with errors %s and imported %v, want 2 rows and nothing imported",
+			report.Rows, importErrors(report), report.IDs)
+	}
+	if customers, _ := store.ListCustomers(); len(customers) != 0 {
+		t.Errorf("dry run saved %d customers", len(customers))
+	}
+}
+
+func TestImportRejectsWholeFile(t *testing.T) {
+	ims, store, _ := newTestImportService(t)
+	report := importTestFile(t, ims, "kind=jobs",
+		"order_date,deadline_date,description\n2024-03-01,2024-03-15,Cables\n2024-03-02,soon,Plugs\n")
+	if len(report.Errors) != 1 || report.Errors[0].Line != 3 || report.Errors[0].Fields[0].Field != "deadline_date" {
+		t.Errorf("got errors %s, want one with the deadline on line 3", importErrors(report))
+	}
+	if jobsList, _ := store.ListJobs(); len(jobsList) != 0 || len(report.IDs) != 0 {
+		t.Errorf("saved %d jobs from a file with a bad row", len(jobsList))
+	}
+}
+
+func TestImportFindsCustomers(t *testing.T) {
+	ims, store, customers := newTestImportService(t, "Acme", "Beta", " beta")
+	acme, beta := customers[0], customers[1]
+	tests := []struct {
+		customer string
+		// want is the ID of the customer found, or "" if none is.
+		want string
+	}{
+		{acme.ID, acme.ID},
+		{"Acme", acme.ID},
+		{"  aCME ", acme.ID},
+		{beta.ID, beta.ID},
+		// Two customers are called Beta once their names are trimmed.
+		{"Beta", ""},
+		{"Gamma", ""},
+	}
+	for _, tt := range tests {
+		report := importTestFile(t, ims, "kind=jobs",
+			"order_date,deadline_date,customer\n2024-03-01,2024-03-15,\""+tt.customer+"\"\n")
+		if tt.want == "" {
+			if len(report.Errors) != 1 || report.Errors[0].Fields[0].Field != "customer" {
+				t.Errorf("customer %q: got errors %s, want one with the customer", tt.customer, importErrors(report))
+			}
+			continue
+		}
+		if len(report.IDs) != 1 {
+			t.Errorf("customer %q: got errors %s, want the job imported", tt.customer, importErrors(report))
+			continue
+		}
+		j, err := store.GetJob(report.IDs[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if j.CustomerID != tt.want {
+			t.Errorf("customer %q: job is for %q, want %q", tt.customer, j.CustomerID, tt.want)
+		}
+	}
+}
+
+func TestImportRejectsExistingCustomerNames(t *testing.T) {
+	ims, store, _ := newTestImportService(t, "Acme ")
+	report := importTestFile(t, ims, "kind=customers", "name\n\" acme\"\nBeta\n\"beta \"\n")
+	lines := make([]int, 0)
+	for _, e := range report.Errors {
+		lines = append(lines, e.Line)
+	}
+	if !reflect.DeepEqual(lines, []int{2, 4}) {
+		t.Errorf("got errors on lines %v, want 2 and 4", lines)
+	}
+	if customers, _ := store.ListCustomers(); len(customers) != 1 {
+		t.Errorf("store holds %d customers, want only the one there before", len(customers))
+	}
+}
+
+func TestImportMapsColumns(t *testing.T) {
+	ims, store, _ := newTestImportService(t)
+	report := importTestFile(t, ims, "kind=jobs&map.order_date=Bestellt&map.deadline_date=F%C3%A4llig",
+		"Bestellt;Fällig;Notes;Price\n2024-03-01;2024-03-15;Cables;12,5\n")
+	want := map[string]string{"order_date": "Bestellt", "deadline_date": "Fällig", "description": "Notes", "unit_price": "Price"}
+	if !reflect.DeepEqual(report.Columns, want) {
+		t.Errorf("read the fields from columns %v, want %v", report.Columns, want)
+	}
+	if len(report.IDs) != 1 {
+		t.Fatalf("got errors %s, want the job imported", importErrors(report))
+	}
+	j, err := store.GetJob(report.IDs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !j.OrderDate.Equal(*GetFormattedDate("2024-03-01")) || j.Description != "Cables" || j.Totals.Subtotal != 1250 {
+		t.Errorf("imported %q ordered on %s for %d, want Cables ordered on 2024-03-01 for 1250",
+			j.Description, j.OrderDate.Format(JobsDateFormat), j.Totals.Subtotal)
+	}
+
+	opts := &ImportOptions{Kind: ImportJobs, Columns: map[string]string{"order_date": "Ordered"}}
+	_, err = ims.Import(context.Background(), strings.NewReader("Bestellt,deadline\n2024-03-01,2024-03-15\n"), opts)
+	var verr *ValidationError
+	if !errors.As(err, &verr) || verr.Fields[0].Field != "map.order_date" {
+		t.Errorf("mapping a missing column returned %v, want a validation error on map.order_date", err)
+	}
+}
+
+func TestImportDates(t *testing.T) {
+	tests := []struct {
+		dates, date string
+		want        string
+	}{
+		{"dmy", "03/04/2024", "2024-04-03"},
+		{"mdy", "03/04/2024", "2024-03-04"},
+		{"", "3.4.24", "2024-04-03"},
+		{"mdy", "3-4-2024", "2024-03-04"},
+		{"dmy", "2024-03-04", "2024-03-04"},
+		{"mdy", "4 Mar 2024", "2024-03-04"},
+		{"dmy", "March 4, 2024", "2024-03-04"},
+	}
+	for _, tt := range tests {
+		ims, store, _ := newTestImportService(t)
+		report := importTestFile(t, ims, "kind=jobs&dates="+tt.dates,
+			"order_date,deadline_date\n\""+tt.date+"\",2024-12-31\n")
+		if len(report.IDs) != 1 {
+			t.Errorf("%s %q: got errors %s, want the job imported", tt.dates, tt.date, importErrors(report))
+			continue
+		}
+		j, err := store.GetJob(report.IDs[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := j.OrderDate.Format(JobsDateFormat); got != tt.want {
+			t.Errorf("%s %q: read %s, want %s", tt.dates, tt.date, got, tt.want)
+		}
+	}
+}
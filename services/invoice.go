@@ -0,0 +1,217 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Invoice bills a customer for one or more of their jobs. It keeps a copy
+// of everything it shows, so it reads the same however the jobs and the
+// customer change afterwards.
+type Invoice struct {
+	ID string `json:"id"`
+	// Number is sequential and gap-free.
+	Number       int    `json:"number"`
+	CustomerID   string `json:"customer_id"`
+	CustomerName string `json:"customer_name"`
+	// BillTo, CustomerVATNumber and PaymentTermsDays
+	// are copied from the customer profile.
+	BillTo            *Address       `json:"bill_to,omitempty"`
+	CustomerVATNumber string         `json:"customer_vat_number,omitempty"`
+	PaymentTermsDays  *int           `json:"payment_terms_days,omitempty"`
+	JobIDs            []string       `json:"job_ids"`
+	IssuedAt          time.Time      `json:"issued_at"`
+	Items             []*InvoiceItem `json:"items"`
+	Totals            Totals         `json:"totals"`
+}
+
+// InvoiceItem is a line item of one of the invoiced jobs.
+type InvoiceItem struct {
+	JobID string `json:"job_id"`
+	LineItem
+}
+
+// Reference is how the invoice is referred to on paper.
+func (inv *Invoice) Reference() string {
+	return fmt.Sprintf("INV-%05d", inv.Number)
+}
+
+// InvoiceJobs is what InvoiceService needs to know about jobs.
+type InvoiceJobs interface {
+	GetJob(id string) (*Job, error)
+	UpdateJob(ctx context.Context, id string, newJ *Job) (*Job, error)
+}
+
+// InvoiceCustomers is what InvoiceService needs to know about customers.
+type InvoiceCustomers interface {
+	GetCustomer(id string) (*Customer, error)
+}
+
+// InvoiceService is safe for concurrent use. Invoices are created one at a
+// time, so that no two invoices get the same number. Every invoice created
+// is recorded in the audit log, if there is one.
+type InvoiceService struct {
+	mu        sync.Mutex
+	store     InvoiceStore
+	audit     AuditLog
+	jobs      InvoiceJobs
+	customers InvoiceCustomers
+}
+
+func NewInvoiceService(store InvoiceStore, audit AuditLog, jobs InvoiceJobs, customers InvoiceCustomers) *InvoiceService {
+	return &InvoiceService{
+		store:     store,
+		audit:     audit,
+		jobs:      jobs,
+		customers: customers,
+	}
+}
+
+// ListInvoices returns the invoices of the customer customerID,
+// or all of them if it is empty, most recent first.
+func (is *InvoiceService) ListInvoices(customerID string) ([]*Invoice, error) {
+	all, err := is.store.ListInvoices()
+	if err != nil {
+		return nil, err
+	}
+	invList := make([]*Invoice, 0)
+	for _, inv := range all {
+		if customerID == "" || inv.CustomerID == customerID {
+			invList = append(invList, inv)
+		}
+	}
+	sort.Slice(invList, func(i, j int) bool {
+		return invList[i].Number > invList[j].Number
+	})
+	return invList, nil
+}
+
+func (is *InvoiceService) GetInvoice(id string) (*Invoice, error) {
+	return is.store.GetInvoice(id)
+}
+
+// CreateInvoice bills the jobs jobIDs, which must all belong to the same
+// customer and have line items, and moves them to InvoicedStatus. Jobs can
+// only be invoiced once. Once the invoice is saved it is returned, even if
+// some of the jobs could not be moved, which is logged.
+func (is *InvoiceService) CreateInvoice(ctx context.Context, jobIDs []string) (*Invoice, error) {
+	is.mu.Lock()
+	defer is.mu.Unlock()
+	verr := &ValidationError{Entity: AuditEntityInvoice}
+	if len(jobIDs) == 0 {
+		verr.add("job_ids", "is required")
+		return nil, verr
+	}
+
+	all, err := is.store.ListInvoices()
+	if err != nil {
+		return nil, err
+	}
+	invoiced := make(map[string]*Invoice)
+	number := 1
+	for _, inv := range all {
+		for _, id := range inv.JobIDs {
+			invoiced[id] = inv
+		}
+		if inv.Number >= number {
+			number = inv.Number + 1
+		}
+	}
+
+	inv := &Invoice{
+		ID:       uuid.New().String(),
+		Number:   number,
+		IssuedAt: time.Now().UTC(),
+		Items:    make([]*InvoiceItem, 0),
+	}
+	invoicedJobs := make([]*Job, 0, len(jobIDs))
+	seen := make(map[string]bool)
+	for _, id := range jobIDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		j, err := is.jobs.GetJob(id)
+		if err != nil {
+			return nil, err
+		}
+		if prev, ok := invoiced[id]; ok {
+			return nil, fmt.Errorf("job %s is already on invoice %s: %w", id, prev.Reference(), ErrConflict)
+		}
+		if inv.CustomerID == "" {
+			inv.CustomerID = j.CustomerID
+		}
+		if j.CustomerID == "" {
+			verr.add("job_ids", "job %s has no customer", id)
+		} else if j.CustomerID != inv.CustomerID {
+			verr.add("job_ids", "job %s belongs to another customer", id)
+		}
+		if len(j.Items) == 0 {
+			verr.add("job_ids", "job %s has no line items", id)
+		}
+		if GetJobStatus(InvoicedStatus) != nil {
+			if err := checkTransition(j.Status, InvoicedStatus); err != nil {
+				verr.add("job_ids", "job %s cannot be invoiced while %s", id, StatusLabel(j.Status))
+			}
+		}
+		for _, li := range j.Items {
+			inv.Items = append(inv.Items, &InvoiceItem{JobID: id, LineItem: *li})
+			inv.Totals.add(Totals{Subtotal: li.Subtotal, Tax: li.Tax, Total: li.Total})
+		}
+		inv.JobIDs = append(inv.JobIDs, id)
+		invoicedJobs = append(invoicedJobs, j)
+	}
+	if err := verr.err(); err != nil {
+		return nil, err
+	}
+	c, err := is.customers.GetCustomer(inv.CustomerID)
+	if err != nil {
+		return nil, err
+	}
+	inv.CustomerName = c.Name
+	inv.BillTo = c.BillingAddress
+	inv.CustomerVATNumber = c.VATNumber
+	inv.PaymentTermsDays = c.PaymentTermsDays
+
+	if err := is.store.PutInvoice(inv); err != nil {
+		return nil, err
+	}
+	recordChange(ctx, is.audit, AuditEntityInvoice, inv.ID, AuditActionCreate, nil, inv)
+	if GetJobStatus(InvoicedStatus) == nil {
+		return inv, nil
+	}
+	for _, j := range invoicedJobs {
+		if j.Status == InvoicedStatus {
+			continue
+		}
+		// The transitions were checked above, so this only fails if
+		// the job changed meanwhile or cannot be saved. The invoice
+		// is saved by now and is returned all the same.
+		if _, err := is.jobs.UpdateJob(ctx, j.ID, &Job{Status: InvoicedStatus}); err != nil {
+			log.Printf("invoice %s created but job %s not moved to %s: %v",
+				inv.Reference(), j.ID, StatusLabel(InvoicedStatus), err)
+		}
+	}
+	return inv, nil
+}
+
+func (inv *Invoice) clone() *Invoice {
+	c := *inv
+	c.JobIDs = append([]string(nil), inv.JobIDs...)
+	if inv.BillTo != nil {
+		a := *inv.BillTo
+		c.BillTo = &a
+	}
+	c.Items = make([]*InvoiceItem, len(inv.Items))
+	for i, item := range inv.Items {
+		cp := *item
+		c.Items[i] = &cp
+	}
+	return &c
+}
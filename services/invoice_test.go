@@ -0,0 +1,45 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+// failingJobUpdates cannot save any change to a job.
+type failingJobUpdates struct {
+	*JobService
+}
+
+func (failingJobUpdates) UpdateJob(ctx context.Context, id string, newJ *Job) (*Job, error) {
+	return nil, fmt.Errorf("disk full")
+}
+
+func TestCreateInvoiceReturnedIfJobsNotMoved(t *testing.T) {
+	store := NewMemoryStore()
+	js := NewJobService(store, store, nil)
+	cs := NewCustomerService(store, nil, js)
+	is := NewInvoiceService(store, nil, failingJobUpdates{js}, cs)
+	ctx := context.Background()
+	c := &Customer{Name: "Acme"}
+	if err := cs.AddCustomer(ctx, c); err != nil {
+		t.Fatal(err)
+	}
+	j := newTestJob(c.ID)
+	j.Status = ShippedStatus
+	j.Items = []*LineItem{{Description: "XLR cable", Quantity: 2, UnitPrice: 1500}}
+	if err := js.AddJob(ctx, j); err != nil {
+		t.Fatal(err)
+	}
+
+	inv, err := is.CreateInvoice(ctx, []string{j.ID})
+	if err != nil {
+		t.Fatalf("CreateInvoice failed although the invoice was saved: %v", err)
+	}
+	if _, err := store.GetInvoice(inv.ID); err != nil {
+		t.Errorf("invoice %s was not saved: %v", inv.Reference(), err)
+	}
+	if _, err := is.CreateInvoice(ctx, []string{j.ID}); err == nil {
+		t.Error("invoiced the job twice")
+	}
+}
@@ -0,0 +1,420 @@
+package jobs
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The headers GET /jobs pages its results with.
+const (
+	// TotalCountHeader holds how many jobs match the query in all.
+	TotalCountHeader = "X-Total-Count"
+	// NextCursorHeader holds the cursor of the next page, if there is one.
+	NextCursorHeader = "X-Next-Cursor"
+)
+
+// NoCustomer is the CustomerID of a JobQuery for the jobs without a customer.
+const NoCustomer = "unknown"
+
+// The fields jobs can be sorted by. Without one, jobs are
+// sorted in workflow order and then by deadline.
+const (
+	SortByOrderDate = "order_date"
+	SortByDeadline  = "deadline_date"
+	SortByStatus    = "status"
+	SortByCustomer  = "customer"
+	SortByTotal     = "total"
+)
+
+// JobQuery says which jobs to list and in what order. Jobs must match
+// all the fields that are set. Dates are days, and ranges include them.
+type JobQuery struct {
+	// CustomerID is the customer of the jobs, or NoCustomer.
+	CustomerID string
+	// Statuses are the keys of the statuses the jobs can be in.
+	Statuses    []string
+	OrderedFrom *time.Time
+	OrderedTo   *time.Time
+	DueFrom     *time.Time
+	DueTo       *time.Time
+	// Text is searched for in the descriptions of the jobs and their
+	// items, and in the names of their customers, ignoring case.
+	Text string
+	// Overdue only keeps the unfinished jobs past their deadline.
+	Overdue bool
+	Sort    string
+	Desc    bool
+	// Offset skips the first jobs. Cursor instead starts right after the
+	// last job of the page it came from, even if jobs were added since.
+	Offset int
+	Cursor string
+	// Limit is the most jobs a page holds, or 0 for no limit.
+	Limit int
+}
+
+// JobPage is a page of the jobs matching a JobQuery.
+type JobPage struct {
+	Jobs []*Job `json:"jobs"`
+	// Total is how many jobs match the query, on all the pages.
+	Total int `json:"total"`
+	// NextCursor gets the next page, and is empty on the last one.
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// ParseJobQuery reads a JobQuery from the query parameters of GET /jobs:
+// customerID, status (repeated or comma separated), orderedFrom, orderedTo,
+// dueFrom, dueTo, q, overdue, sort, order (asc or desc), offset, cursor
+// and limit.
+func ParseJobQuery(v url.Values) (*JobQuery, error) {
+	verr := &ValidationError{Entity: "job query"}
+	q := &JobQuery{
+		CustomerID: v.Get("customerID"),
+		Text:       strings.TrimSpace(v.Get("q")),
+		Sort:       v.Get("sort"),
+		Cursor:     v.Get("cursor"),
+	}
+	for _, param := range v["status"] {
+		for _, s := range strings.Split(param, ",") {
+			if s = strings.TrimSpace(s); s == "" {
+				continue
+			}
+			if getStatusIndex(s) < 0 {
+				verr.add("status", "%q is not a known status", s)
+			}
+			q.Statuses = append(q.Statuses, s)
+		}
+	}
+	day := func(name string) *time.Time {
+		s := v.Get(name)
+		if s == "" {
+			return nil
+		}
+		t, err := time.Parse(JobsDateFormat, s)
+		if err != nil {
+			verr.add(name, "%q is not a date like %s", s, JobsDateFormat)
+			return nil
+		}
+		return &t
+	}
+	q.OrderedFrom, q.OrderedTo = day("orderedFrom"), day("orderedTo")
+	q.DueFrom, q.DueTo = day("dueFrom"), day("dueTo")
+	number := func(name string) int {
+		s := v.Get(name)
+		if s == "" {
+			return 0
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			verr.add(name, "%q is not a positive number", s)
+		}
+		return n
+	}
+	q.Offset, q.Limit = number("offset"), number("limit")
+	if s := v.Get("overdue"); s != "" {
+		overdue, err := strconv.ParseBool(s)
+		if err != nil {
+			verr.add("overdue", "%q is neither true nor false", s)
+		}
+		q.Overdue = overdue
+	}
+	switch q.Sort {
+	case "", SortByOrderDate, SortByDeadline, SortByStatus, SortByCustomer, SortByTotal:
+	default:
+		verr.add("sort", "%q is not one of %s, %s, %s, %s or %s", q.Sort,
+			SortByOrderDate, SortByDeadline, SortByStatus, SortByCustomer, SortByTotal)
+	}
+	switch order := v.Get("order"); order {
+	case "", "asc":
+	case "desc":
+		q.Desc = true
+	default:
+		verr.add("order", "%q is neither asc nor desc", order)
+	}
+	if q.Cursor != "" && q.Offset != 0 {
+		verr.add("cursor", "cannot be combined with an offset")
+	}
+	return q, verr.err()
+}
+
+// Values returns the query parameters that ParseJobQuery reads q from.
+func (q *JobQuery) Values() url.Values {
+	v := url.Values{}
+	set := func(name, value string) {
+		if value != "" {
+			v.Set(name, value)
+		}
+	}
+	day := func(name string, t *time.Time) {
+		if t != nil {
+			v.Set(name, t.Format(JobsDateFormat))
+		}
+	}
+	set("customerID", q.CustomerID)
+	for _, s := range q.Statuses {
+		v.Add("status", s)
+	}
+	day("orderedFrom", q.OrderedFrom)
+	day("orderedTo", q.OrderedTo)
+	day("dueFrom", q.DueFrom)
+	day("dueTo", q.DueTo)
+	set("q", q.Text)
+	if q.Overdue {
+		v.Set("overdue", "true")
+	}
+	set("sort", q.Sort)
+	if q.Desc {
+		v.Set("order", "desc")
+	}
+	if q.Offset > 0 {
+		v.Set("offset", strconv.Itoa(q.Offset))
+	}
+	set("cursor", q.Cursor)
+	if q.Limit > 0 {
+		v.Set("limit", strconv.Itoa(q.Limit))
+	}
+	return v
+}
+
+// QueryJobs returns the page of the jobs outside the trash that q asks for.
+func (js *JobService) QueryJobs(q *JobQuery) (*JobPage, error) {
+	today := GetFormattedDate(time.Now().Format(JobsDateFormat))
+	if querier, ok := js.store.(JobQuerier); ok {
+		return js.queryStore(querier, q, *today)
+	}
+	customerNames, err := js.customerNames()
+	if err != nil {
+		return nil, err
+	}
+	jobsList, err := js.listJobs(func(j *Job) bool {
+		return j.DeletedAt == nil && q.matches(j, customerNames[j.CustomerID], *today)
+	})
+	if err != nil {
+		return nil, err
+	}
+	keys := make(map[*Job]string, len(jobsList))
+	for _, j := range jobsList {
+		keys[j] = q.sortKey(j, customerNames[j.CustomerID])
+	}
+	sort.Slice(jobsList, func(a, b int) bool {
+		if q.Desc {
+			return keys[jobsList[a]] > keys[jobsList[b]]
+		}
+		return keys[jobsList[a]] < keys[jobsList[b]]
+	})
+
+	start := q.Offset
+	if q.Cursor != "" {
+		after, err := decodeCursor(q.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		start = sort.Search(len(jobsList), func(i int) bool {
+			if q.Desc {
+				return keys[jobsList[i]] < after
+			}
+			return keys[jobsList[i]] > after
+		})
+	}
+	page := &JobPage{Jobs: make([]*Job, 0), Total: len(jobsList)}
+	if start >= len(jobsList) {
+		return page, nil
+	}
+	end := len(jobsList)
+	if q.Limit > 0 && start+q.Limit < end {
+		end = start + q.Limit
+		page.NextCursor = encodeCursor(keys[jobsList[end-1]])
+	}
+	page.Jobs = jobsList[start:end]
+	return page, nil
+}
+
+// queryStore has querier find the page of jobs q asks for,
+// and works out the cursor of the next page like QueryJobs.
+func (js *JobService) queryStore(querier JobQuerier, q *JobQuery, today time.Time) (*JobPage, error) {
+	var after []string
+	if q.Cursor != "" {
+		key, err := decodeCursor(q.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		if after = strings.Split(key, "\x00"); len(after) != sortKeyParts {
+			return nil, invalidCursor(q.Cursor)
+		}
+	}
+	// Ask for one job more than the page holds, to tell if there is a next page.
+	query := *q
+	if q.Limit > 0 {
+		query.Limit++
+	}
+	page, err := querier.QueryJobs(&query, after, today)
+	if err != nil {
+		return nil, err
+	}
+	if q.Limit > 0 && len(page.Jobs) > q.Limit {
+		page.Jobs = page.Jobs[:q.Limit]
+		last := page.Jobs[q.Limit-1]
+		var customerName string
+		if js.customers != nil && last.CustomerID != "" {
+			c, err := js.customers.GetCustomer(last.CustomerID)
+			if err != nil && !errors.Is(err, ErrNotFound) {
+				return nil, err
+			}
+			if err == nil {
+				customerName = c.Name
+			}
+		}
+		page.NextCursor = encodeCursor(q.sortKey(last, customerName))
+	}
+	return page, nil
+}
+
+// matches reports whether j, of the customer customerName, is one
+// of the jobs q asks for on the day today.
+func (q *JobQuery) matches(j *Job, customerName string, today time.Time) bool {
+	switch q.CustomerID {
+	case "":
+	case NoCustomer:
+		if j.CustomerID != "" {
+			return false
+		}
+	default:
+		if j.CustomerID != q.CustomerID {
+			return false
+		}
+	}
+	if len(q.Statuses) > 0 && !contains(q.Statuses, j.Status) {
+		return false
+	}
+	if !inRange(j.OrderDate, q.OrderedFrom, q.OrderedTo) || !inRange(j.DeadlineDate, q.DueFrom, q.DueTo) {
+		return false
+	}
+	if q.Overdue {
+		status := GetJobStatus(j.Status)
+		if status != nil && status.Terminal || j.DeadlineDate == nil || !j.DeadlineDate.Before(today) {
+			return false
+		}
+	}
+	if q.Text != "" {
+		text := []string{customerName, j.Description}
+		for _, li := range j.Items {
+			text = append(text, li.Description)
+		}
+		if !strings.Contains(strings.ToLower(strings.Join(text, "\n")), strings.ToLower(q.Text)) {
+			return false
+		}
+	}
+	return true
+}
+
+// sortKeyParts is how many parts a sort key has.
+const sortKeyParts = 4
+
+// sortKey returns a string that sorts j in the order q asks for. Numbers
+// and dates are written out at a fixed width so that they sort like
+// strings. Ties are broken in workflow order, and then by ID so that
+// a cursor always points between two jobs. The sortKeyParts parts of
+// the key are separated by NULs, and a JobQuerier must sort by them
+// in the same way.
+func (q *JobQuery) sortKey(j *Job, customerName string) string {
+	var key string
+	switch q.Sort {
+	case SortByOrderDate:
+		key = sortableDate(j.OrderDate)
+	case SortByDeadline:
+		key = sortableDate(j.DeadlineDate)
+	case SortByStatus:
+		key = statusSortKey(j.Status)
+	case SortByCustomer:
+		key = strings.ToLower(customerName)
+	case SortByTotal:
+		// Flipping the sign bit sorts negative totals first.
+		key = fmt.Sprintf("%020d", uint64(j.Totals.Total)^1<<63)
+	}
+	// Like sortJobs, unfinished jobs are sorted by deadline, latest first.
+	deadline := strings.Repeat("0", 8)
+	if s := GetJobStatus(j.Status); s != nil && !s.Terminal && j.DeadlineDate != nil {
+		d, _ := strconv.Atoi(sortableDate(j.DeadlineDate))
+		deadline = fmt.Sprintf("%08d", 99999999-d)
+	}
+	return strings.Join([]string{key, statusSortKey(j.Status), deadline, j.ID}, "\x00")
+}
+
+// statusSortKey sorts statuses in workflow order,
+// with the ones no longer configured last.
+func statusSortKey(status string) string {
+	i := getStatusIndex(status)
+	if i < 0 {
+		i = len(JobStatusList)
+	}
+	return fmt.Sprintf("%05d", i)
+}
+
+func sortableDate(t *time.Time) string {
+	if t == nil {
+		return strings.Repeat("0", 8)
+	}
+	return t.Format("20060102")
+}
+
+// customerNames returns the names of all the customers by ID.
+func (js *JobService) customerNames() (map[string]string, error) {
+	names := make(map[string]string)
+	if js.customers == nil {
+		return names, nil
+	}
+	customers, err := js.customers.ListCustomers()
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range customers {
+		names[c.ID] = c.Name
+	}
+	return names, nil
+}
+
+// encodeCursor returns the cursor of the page after the job
+// with the sort key key, which is opaque to clients.
+func encodeCursor(key string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(key))
+}
+
+func decodeCursor(cursor string) (string, error) {
+	key, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || !strings.Contains(string(key), "\x00") {
+		return "", invalidCursor(cursor)
+	}
+	return string(key), nil
+}
+
+func invalidCursor(cursor string) error {
+	verr := &ValidationError{Entity: "job query"}
+	verr.add("cursor", "%q is not a cursor from a previous page", cursor)
+	return verr
+}
+
+// inRange reports whether the day t is between from and to,
+// either of which can be nil. Missing days are never in range.
+func inRange(t, from, to *time.Time) bool {
+	if from == nil && to == nil {
+		return true
+	}
+	if t == nil {
+		return false
+	}
+	return (from == nil || !t.Before(*from)) && (to == nil || !t.After(*to))
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
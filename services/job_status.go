@@ -1,7 +1,190 @@
 package jobs
 
-var JobStatusList []string = []string{
-	"New ⭐️",
-	"Completed & Shipped ✅",
-	"Invoiced 🧾",
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const JOBS_MANAGER_STATUSES_FILE = "jobsManager-statuses.json"
+
+// JobStatus is a stage of the job workflow. Jobs store its Key,
+// the Label is only for display.
+type JobStatus struct {
+	Key   string `json:"key"`
+	Label string `json:"label"`
+	// Colour is the CSS background colour of jobs in this status. Jobs in
+	// statuses without one are coloured by how close their deadline is.
+	Colour string `json:"colour,omitempty"`
+	// Terminal statuses are the end of the road for a job.
+	Terminal bool `json:"terminal"`
+	// Next lists the keys of the statuses jobs can move on to from this
+	// one. Jobs can move to any status if it is null, and nowhere if it
+	// is empty.
+	Next []string `json:"next"`
+}
+
+// CanMoveTo reports whether jobs can go from status s to the status key.
+func (s *JobStatus) CanMoveTo(key string) bool {
+	if s.Key == key || s.Next == nil {
+		return true
+	}
+	for _, next := range s.Next {
+		if next == key {
+			return true
+		}
+	}
+	return false
+}
+
+// DefaultJobStatuses is the workflow used until a statuses file says otherwise.
+var DefaultJobStatuses = []*JobStatus{
+	{Key: "new", Label: "New ⭐️",
+		Next: []string{"in_progress", "awaiting_materials", "shipped", "cancelled"}},
+	{Key: "in_progress", Label: "In Progress 🔨",
+		Next: []string{"awaiting_materials", "shipped", "cancelled"}},
+	{Key: "awaiting_materials", Label: "Awaiting Materials 📦",
+		Next: []string{"in_progress", "cancelled"}},
+	{Key: "shipped", Label: "Completed & Shipped ✅", Colour: "lightgreen",
+		Next: []string{"invoiced"}},
+	{Key: "invoiced", Label: "Invoiced 🧾", Colour: "darkgreen",
+		Next: []string{"paid"}},
+	{Key: "paid", Label: "Paid 💰", Colour: "darkgreen", Terminal: true,
+		Next: []string{}},
+	{Key: "cancelled", Label: "Cancelled ❌", Colour: "lightgrey", Terminal: true,
+		Next: []string{}},
+}
+
+// ShippedStatus is the status of jobs that have been delivered,
+// which ends their lead time.
+const ShippedStatus = "shipped"
+
+// InvoicedStatus is the status jobs are moved to when they are
+// invoiced, if the workflow has it.
+const InvoicedStatus = "invoiced"
+
+// CancelledStatus is the status of jobs the customer called off.
+const CancelledStatus = "cancelled"
+
+// JobStatusList is the job workflow in display order.
+var JobStatusList = DefaultJobStatuses
+
+// LegacyJobStatuses maps the display strings jobs used
+// to store as their status to the keys that replaced them.
+var LegacyJobStatuses = map[string]string{
+	"New ⭐️":                "new",
+	"Completed & Shipped ✅": "shipped",
+	"Invoiced 🧾":            "invoiced",
+}
+
+// LoadJobStatuses reads the workflow from the statuses file in dir,
+// creating it with DefaultJobStatuses if it is missing.
+func LoadJobStatuses(dir string) ([]*JobStatus, error) {
+	fullPath := filepath.Join(dir, JOBS_MANAGER_STATUSES_FILE)
+	file, err := os.ReadFile(fullPath)
+	if errors.Is(err, os.ErrNotExist) {
+		// The file is meant to be edited by hand, so keep it readable.
+		var data bytes.Buffer
+		enc := json.NewEncoder(&data)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(DefaultJobStatuses); err != nil {
+			return nil, err
+		}
+		if err := writeFileAtomic(fullPath, data.Bytes()); err != nil {
+			return nil, err
+		}
+		return DefaultJobStatuses, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("opening %s: %w", fullPath, err)
+	}
+	statuses := make([]*JobStatus, 0)
+	if err := json.Unmarshal(file, &statuses); err != nil {
+		return nil, fmt.Errorf("unmarshalling %s: %w", fullPath, err)
+	}
+	if len(statuses) == 0 {
+		return nil, fmt.Errorf("%s has no statuses", fullPath)
+	}
+	keys := make(map[string]bool)
+	for i, s := range statuses {
+		if s.Key == "" {
+			return nil, fmt.Errorf("%s: status %d has no key", fullPath, i+1)
+		}
+		if keys[s.Key] {
+			return nil, fmt.Errorf("%s: status %s is listed twice", fullPath, s.Key)
+		}
+		keys[s.Key] = true
+		if s.Label == "" {
+			s.Label = s.Key
+		}
+	}
+	for _, s := range statuses {
+		for _, next := range s.Next {
+			if !keys[next] {
+				return nil, fmt.Errorf("%s: status %s moves on to unknown status %s", fullPath, s.Key, next)
+			}
+		}
+	}
+	return statuses, nil
+}
+
+// GetJobStatus returns the status key, or nil if there is no such status.
+func GetJobStatus(key string) *JobStatus {
+	if i := getStatusIndex(key); i >= 0 {
+		return JobStatusList[i]
+	}
+	return nil
+}
+
+// StatusLabel returns the label of the status key,
+// or the key itself if there is no such status.
+func StatusLabel(key string) string {
+	if s := GetJobStatus(key); s != nil {
+		return s.Label
+	}
+	return key
+}
+
+func getStatusIndex(key string) int {
+	for i, s := range JobStatusList {
+		if s.Key == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// migrateStatusTimes records that jobs entered the status they are in,
+// or the first status of the workflow if they have none, on their order
+// date, which is the earliest they can have entered it.
+func migrateStatusTimes(records []map[string]any) error {
+	for _, r := range records {
+		if _, ok := r["entered_status_at"]; ok {
+			continue
+		}
+		status, _ := r["status"].(string)
+		if status == "" {
+			status = JobStatusList[0].Key
+		}
+		if orderDate, ok := r["order_date"].(string); ok {
+			r["entered_status_at"] = map[string]any{status: orderDate}
+		}
+	}
+	return nil
+}
+
+// migrateJobStatuses replaces the legacy display strings
+// stored as job statuses with their keys.
+func migrateJobStatuses(records []map[string]any) error {
+	for _, r := range records {
+		status, _ := r["status"].(string)
+		if key, ok := LegacyJobStatuses[status]; ok {
+			r["status"] = key
+		}
+	}
+	return nil
 }
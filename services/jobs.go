@@ -1,10 +1,13 @@
 package jobs
 
 import (
+	"context"
 	_ "embed"
+	"errors"
 	"fmt"
 	"log"
 	"sort"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
@@ -13,40 +16,98 @@ import (
 const JobsDateFormat string = "2006-01-02"
 
 type Job struct {
-	ID           string     `json:"id"`
-	OrderDate    *time.Time `json:"order_date"`
-	DeadlineDate *time.Time `json:"deadline_date"`
-	Status       string     `json:"status"`
-	CustomerID   string     `json:"customer_id"`
-	Description  string     `json:"description"`
+	ID           string      `json:"id"`
+	OrderDate    *time.Time  `json:"order_date"`
+	DeadlineDate *time.Time  `json:"deadline_date"`
+	Status       string      `json:"status"`
+	CustomerID   string      `json:"customer_id"`
+	Description  string      `json:"description"`
+	Items        []*LineItem `json:"items,omitempty"`
+	// Totals adds up Items and is computed by the server.
+	Totals Totals `json:"totals"`
+	// EnteredStatusAt holds when the job last entered each status it
+	// has been in, keyed by status.
+	EnteredStatusAt map[string]time.Time `json:"entered_status_at,omitempty"`
+	// DeletedAt is set while the job is in the trash.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
 }
 
+// JobService is safe for concurrent use. Changes are serialised so
+// that concurrent updates of the same job do not overwrite each other.
+// Every change is recorded in the audit log, if there is one.
+// Jobs can only be given customers found in customers, if set, and
+// customers are checked within the change, so that a customer removed
+// through RemoveIfNoJobs or ReassignJobs is never given a job.
 type JobService struct {
-	jobs     map[string]*Job
-	filepath string
+	mu        sync.Mutex
+	store     JobStore
+	customers CustomerStore
+	audit     AuditLog
 }
 
-func NewJobService(filepath string) *JobService {
-	js := &JobService{
-		jobs:     make(map[string]*Job, 0),
-		filepath: filepath,
+func NewJobService(store JobStore, customers CustomerStore, audit AuditLog) *JobService {
+	return &JobService{
+		store:     store,
+		customers: customers,
+		audit:     audit,
 	}
-	js.importJobs(filepath)
-	return js
 }
 
-func (js *JobService) AddJob(j *Job) {
+// AddJob saves the new job j, which must pass validation,
+// and sets its ID.
+func (js *JobService) AddJob(ctx context.Context, j *Job) error {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	if err := js.validate(j); err != nil {
+		return err
+	}
 	id := uuid.New().String()
 	j.ID = id
-	js.jobs[id] = j
-	js.exportJobs()
+	j.EnteredStatusAt = map[string]time.Time{j.Status: time.Now().UTC()}
+	j.computeTotals()
+	if err := js.store.PutJob(j); err != nil {
+		return err
+	}
+	recordChange(ctx, js.audit, AuditEntityJob, id, AuditActionCreate, nil, j)
+	return nil
 }
 
-func (js *JobService) UpdateJob(id string, newJ *Job) error {
-	curr, ok := js.jobs[id]
-	if !ok {
-		return fmt.Errorf("job %s not found", id)
+// AddJobs saves the new jobs of jobsList, which must all pass
+// validation, and sets their IDs. Either all of them are saved
+// or, if any of them cannot be, none are.
+func (js *JobService) AddJobs(ctx context.Context, jobsList []*Job) error {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	for _, j := range jobsList {
+		if err := js.validate(j); err != nil {
+			return err
+		}
+	}
+	now := time.Now().UTC()
+	for _, j := range jobsList {
+		j.ID = uuid.New().String()
+		j.EnteredStatusAt = map[string]time.Time{j.Status: now}
+		j.computeTotals()
+	}
+	if err := js.store.PutJobs(jobsList); err != nil {
+		return err
+	}
+	for _, j := range jobsList {
+		recordChange(ctx, js.audit, AuditEntityJob, j.ID, AuditActionCreate, nil, j)
 	}
+	return nil
+}
+
+// UpdateJob changes the fields set in newJ on the job id and returns
+// the updated job. A CustomerID of "Unknown" removes the customer.
+func (js *JobService) UpdateJob(ctx context.Context, id string, newJ *Job) (*Job, error) {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	curr, err := js.getJob(id)
+	if err != nil {
+		return nil, err
+	}
+	before := curr.clone()
 
 	if newJ.OrderDate != nil {
 		curr.OrderDate = newJ.OrderDate
@@ -56,8 +117,11 @@ func (js *JobService) UpdateJob(id string, newJ *Job) error {
 		curr.DeadlineDate = newJ.DeadlineDate
 	}
 
-	if newJ.Status != "" {
-		curr.Status = newJ.Status
+	if newJ.Status != "" && newJ.Status != curr.Status {
+		if err := checkTransition(curr.Status, newJ.Status); err != nil {
+			return nil, err
+		}
+		curr.EnterStatus(newJ.Status, time.Now().UTC())
 	}
 	if newJ.CustomerID != "" && newJ.CustomerID != "Unknown" {
 		curr.CustomerID = newJ.CustomerID
@@ -68,70 +132,370 @@ func (js *JobService) UpdateJob(id string, newJ *Job) error {
 	if newJ.Description != "" {
 		curr.Description = newJ.Description
 	}
+	// An empty list removes all the items.
+	if newJ.Items != nil {
+		curr.Items = newJ.Items
+	}
+
+	// Only the fields newJ sets are checked, so that jobs from before
+	// a rule came in, or in a status no longer configured, can still
+	// be edited.
+	if err := js.validateChanges(curr, newJ, &ValidationError{Entity: AuditEntityJob}); err != nil {
+		return nil, err
+	}
+	curr.computeTotals()
+	if err := js.store.PutJob(curr); err != nil {
+		return nil, err
+	}
+	recordChange(ctx, js.audit, AuditEntityJob, id, AuditActionUpdate, before, curr)
+	return curr, nil
+}
+
+// validate checks that j has its dates, a known status and
+// sensible line items, and that its customer exists.
+func (js *JobService) validate(j *Job) error {
+	verr := &ValidationError{Entity: AuditEntityJob}
+	if j.OrderDate == nil {
+		verr.add("order_date", "is required")
+	}
+	if j.DeadlineDate == nil {
+		verr.add("deadline_date", "is required")
+	}
+	if j.Status == "" {
+		verr.add("status", "is required")
+	}
+	return js.validateChanges(j, j, verr)
+}
+
+// validateChanges adds the problems with the fields that changes
+// sets, as they are in j, to verr and returns it if there are any.
+func (js *JobService) validateChanges(j, changes *Job, verr *ValidationError) error {
+	datesChanged := changes.OrderDate != nil || changes.DeadlineDate != nil
+	if datesChanged && j.OrderDate != nil && j.DeadlineDate != nil && j.DeadlineDate.Before(*j.OrderDate) {
+		verr.add("deadline_date", "is before the order date")
+	}
+	if changes.Status != "" && getStatusIndex(j.Status) < 0 {
+		verr.add("status", "%q is not a known status", j.Status)
+	}
+	if changes.Items != nil {
+		validateItems(j.Items, verr)
+	}
+	if changes.CustomerID != "" && j.CustomerID != "" && js.customers != nil {
+		c, err := js.customers.GetCustomer(j.CustomerID)
+		if errors.Is(err, ErrNotFound) || err == nil && c.DeletedAt != nil {
+			verr.add("customer_id", "%s is not a known customer", j.CustomerID)
+		} else if err != nil {
+			return err
+		}
+	}
+	return verr.err()
+}
+
+// DeleteJob moves the job id to the trash.
+func (js *JobService) DeleteJob(ctx context.Context, id string) error {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	curr, err := js.getJob(id)
+	if err != nil {
+		return err
+	}
+	before := curr.clone()
+	now := time.Now().UTC()
+	curr.DeletedAt = &now
+	if err := js.store.PutJob(curr); err != nil {
+		return err
+	}
+	recordChange(ctx, js.audit, AuditEntityJob, id, AuditActionDelete, before, curr)
+	return nil
+}
 
-	js.jobs[id] = curr
-	js.exportJobs()
+// RestoreJob takes the job id back out of the trash.
+func (js *JobService) RestoreJob(ctx context.Context, id string) error {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	curr, err := js.getDeletedJob(id)
+	if err != nil {
+		return err
+	}
+	before := curr.clone()
+	curr.DeletedAt = nil
+	if err := js.store.PutJob(curr); err != nil {
+		return err
+	}
+	recordChange(ctx, js.audit, AuditEntityJob, id, AuditActionRestore, before, curr)
 	return nil
 }
 
-func (js *JobService) DeleteJob(id string) {
-	delete(js.jobs, id)
-	js.exportJobs()
+// PurgeJob permanently deletes the job id, which must be in the trash.
+func (js *JobService) PurgeJob(ctx context.Context, id string) error {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	return js.purgeJob(ctx, id)
+}
+
+// PurgeDeletedJobs permanently deletes the jobs moved
+// to the trash before cutoff and returns how many.
+func (js *JobService) PurgeDeletedJobs(ctx context.Context, cutoff time.Time) (int, error) {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	all, err := js.store.ListJobs()
+	if err != nil {
+		return 0, err
+	}
+	purged := 0
+	for _, j := range all {
+		if j.DeletedAt == nil || !j.DeletedAt.Before(cutoff) {
+			continue
+		}
+		if err := js.purgeJob(ctx, j.ID); err != nil {
+			return purged, err
+		}
+		purged++
+	}
+	return purged, nil
 }
 
-func (js *JobService) ListJobs() []*Job {
+func (js *JobService) purgeJob(ctx context.Context, id string) error {
+	before, err := js.getDeletedJob(id)
+	if err != nil {
+		return err
+	}
+	if err := js.store.DeleteJob(id); err != nil {
+		return err
+	}
+	recordChange(ctx, js.audit, AuditEntityJob, id, AuditActionPurge, before, nil)
+	return nil
+}
+
+// RemoveIfNoJobs calls remove, which deletes the customer customerID,
+// unless the customer still has jobs out of the trash, in which case
+// it returns a *CustomerInUseError. No job can be given the customer
+// until remove returns.
+func (js *JobService) RemoveIfNoJobs(customerID string, remove func() error) error {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	jobsList, err := js.FilterJobs(customerID)
+	if err != nil {
+		return err
+	}
+	if len(jobsList) > 0 {
+		return &CustomerInUseError{CustomerID: customerID, Jobs: jobsList}
+	}
+	return remove()
+}
+
+// ReassignJobs moves all the jobs of the customer fromCustomerID, including
+// the ones in the trash, to toCustomerID and then calls remove, which
+// deletes fromCustomerID. An empty toCustomerID leaves the jobs without a
+// customer. No job can be given fromCustomerID until remove returns, and
+// if it fails the jobs are moved back.
+func (js *JobService) ReassignJobs(ctx context.Context, fromCustomerID, toCustomerID string, remove func() error) error {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	all, err := js.customerJobs(fromCustomerID)
+	if err != nil {
+		return err
+	}
+	before := make([]*Job, 0)
+	moved := make([]*Job, 0)
+	for _, j := range all {
+		before = append(before, j.clone())
+		j.CustomerID = toCustomerID
+		moved = append(moved, j)
+	}
+	if len(moved) > 0 {
+		if err := js.store.PutJobs(moved); err != nil {
+			return err
+		}
+	}
+	if err := remove(); err != nil {
+		if len(before) == 0 {
+			return err
+		}
+		if rerr := js.store.PutJobs(before); rerr != nil {
+			return fmt.Errorf("%v, and moving its jobs back failed: %w", err, rerr)
+		}
+		return err
+	}
+	for i, j := range moved {
+		recordChange(ctx, js.audit, AuditEntityJob, j.ID, AuditActionUpdate, before[i], j)
+	}
+	return nil
+}
+
+// GetJob returns the job id, unless it is in the trash.
+func (js *JobService) GetJob(id string) (*Job, error) {
+	return js.getJob(id)
+}
+
+func (js *JobService) getJob(id string) (*Job, error) {
+	j, err := js.store.GetJob(id)
+	if err != nil {
+		return nil, err
+	}
+	if j.DeletedAt != nil {
+		return nil, fmt.Errorf("job %s %w", id, ErrNotFound)
+	}
+	return j, nil
+}
+
+func (js *JobService) getDeletedJob(id string) (*Job, error) {
+	j, err := js.store.GetJob(id)
+	if err != nil {
+		return nil, err
+	}
+	if j.DeletedAt == nil {
+		return nil, fmt.Errorf("job %s is not in the trash: %w", id, ErrNotFound)
+	}
+	return j, nil
+}
+
+// History returns the changes made to the job id, oldest first.
+func (js *JobService) History(id string) ([]*AuditEntry, error) {
+	if js.audit == nil {
+		return []*AuditEntry{}, nil
+	}
+	return js.audit.History(AuditEntityJob, id)
+}
+
+func (js *JobService) ListJobs() ([]*Job, error) {
+	return js.listJobs(func(j *Job) bool {
+		return j.DeletedAt == nil
+	})
+}
+
+func (js *JobService) FilterJobs(customerID string) ([]*Job, error) {
+	all, err := js.customerJobs(customerID)
+	if err != nil {
+		return nil, err
+	}
 	jobsList := make([]*Job, 0)
-	for _, o := range js.jobs {
-		jobsList = append(jobsList, o)
+	for _, j := range all {
+		if j.DeletedAt == nil {
+			jobsList = append(jobsList, j)
+		}
 	}
 	sortJobs(jobsList)
-	return jobsList
+	return jobsList, nil
 }
 
-func (js *JobService) FilterJobs(customerID string) []*Job {
+// customerJobs returns the jobs of the customer customerID,
+// including the ones in the trash.
+func (js *JobService) customerJobs(customerID string) ([]*Job, error) {
+	if querier, ok := js.store.(JobQuerier); ok {
+		return querier.ListCustomerJobs(customerID)
+	}
+	all, err := js.store.ListJobs()
+	if err != nil {
+		return nil, err
+	}
 	jobsList := make([]*Job, 0)
-	for _, o := range js.jobs {
-		if o.CustomerID == customerID {
-			jobsList = append(jobsList, o)
+	for _, j := range all {
+		if j.CustomerID == customerID {
+			jobsList = append(jobsList, j)
 		}
 	}
-	sortJobs(jobsList)
-	return jobsList
+	return jobsList, nil
 }
 
-func sortJobs(jobsList []*Job) {
-	// sort by status first
+// ListDeletedJobs returns the jobs in the trash, most recently deleted first.
+func (js *JobService) ListDeletedJobs() ([]*Job, error) {
+	all, err := js.store.ListJobs()
+	if err != nil {
+		return nil, err
+	}
+	jobsList := make([]*Job, 0)
+	for _, j := range all {
+		if j.DeletedAt != nil {
+			jobsList = append(jobsList, j)
+		}
+	}
 	sort.Slice(jobsList, func(i, j int) bool {
-		return getStatusIndex(jobsList[i].Status) < getStatusIndex(jobsList[j].Status)
+		return jobsList[i].DeletedAt.After(*jobsList[j].DeletedAt)
 	})
-	// sort the new ones by deadline
+	return jobsList, nil
+}
+
+func (js *JobService) listJobs(keep func(j *Job) bool) ([]*Job, error) {
+	all, err := js.store.ListJobs()
+	if err != nil {
+		return nil, err
+	}
+	jobsList := make([]*Job, 0)
+	for _, j := range all {
+		if keep(j) {
+			jobsList = append(jobsList, j)
+		}
+	}
+	sortJobs(jobsList)
+	return jobsList, nil
+}
+
+// sortJobs sorts jobs in workflow order and the unfinished
+// jobs of each status by deadline, latest first.
+func sortJobs(jobsList []*Job) {
 	sort.SliceStable(jobsList, func(i, j int) bool {
-		if getStatusIndex(jobsList[i].Status) == 0 && getStatusIndex(jobsList[j].Status) == 0 {
-			return jobsList[i].DeadlineDate.After(*jobsList[j].DeadlineDate)
+		si, sj := getStatusIndex(jobsList[i].Status), getStatusIndex(jobsList[j].Status)
+		if si != sj {
+			return si < sj
 		}
-		// leave unsorted otherwise
-		return true
+		if s := GetJobStatus(jobsList[i].Status); s == nil || s.Terminal {
+			return false
+		}
+		di, dj := jobsList[i].DeadlineDate, jobsList[j].DeadlineDate
+		return di != nil && dj != nil && di.After(*dj)
 	})
 }
 
-func getStatusIndex(status string) int {
-	for i, s := range JobStatusList {
-		if s == status {
-			return i
-		}
+// EnterStatus moves j to status at time t.
+func (j *Job) EnterStatus(status string, t time.Time) {
+	if j.EnteredStatusAt == nil {
+		j.EnteredStatusAt = make(map[string]time.Time)
 	}
-	return -1
+	j.EnteredStatusAt[status] = t
+	j.Status = status
 }
 
-func (js *JobService) importJobs(filepath string) {
-	rows := openJobsFile(filepath)
-	for _, row := range rows {
-		js.jobs[row.ID] = row
+// EnteredAt returns when j last entered status,
+// or nil if it has never been in it.
+func (j *Job) EnteredAt(status string) *time.Time {
+	t, ok := j.EnteredStatusAt[status]
+	if !ok {
+		return nil
 	}
+	return &t
 }
 
-func (js *JobService) exportJobs() {
-	writeJobsFile(js.filepath, js.ListJobs())
+// checkTransition returns a ValidationError unless the workflow lets
+// jobs move from the status from to the status to. Jobs in statuses
+// that are no longer configured can move anywhere.
+func checkTransition(from, to string) error {
+	s := GetJobStatus(from)
+	// Unknown statuses are reported by validate.
+	if s == nil || GetJobStatus(to) == nil || s.CanMoveTo(to) {
+		return nil
+	}
+	verr := &ValidationError{Entity: AuditEntityJob}
+	verr.add("status", "cannot move from %s to %s", s.Label, StatusLabel(to))
+	return verr
+}
+
+func (j *Job) clone() *Job {
+	c := *j
+	if j.Items != nil {
+		c.Items = make([]*LineItem, len(j.Items))
+		for i, li := range j.Items {
+			item := *li
+			c.Items[i] = &item
+		}
+	}
+	if j.EnteredStatusAt != nil {
+		c.EnteredStatusAt = make(map[string]time.Time, len(j.EnteredStatusAt))
+		for s, t := range j.EnteredStatusAt {
+			c.EnteredStatusAt[s] = t
+		}
+	}
+	return &c
 }
 
 func GetFormattedDate(s string) *time.Time {
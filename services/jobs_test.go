@@ -0,0 +1,430 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// storeKinds are the stores the services are tested against. open
+// returns a new empty store, and a function that opens it again
+// from what it persisted.
+var storeKinds = []struct {
+	name string
+	open func(t *testing.T) (store Store, reopen func() Store)
+}{
+	{"MemoryStore", func(t *testing.T) (Store, func() Store) {
+		ms := NewMemoryStore()
+		return ms, func() Store { return ms }
+	}},
+	{"FileStore", func(t *testing.T) (Store, func() Store) {
+		dir := t.TempDir()
+		fs, err := NewFileStore(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fs, func() Store {
+			fs, err := NewFileStore(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return fs
+		}
+	}},
+}
+
+func newTestJob(customerID string) *Job {
+	return &Job{
+		OrderDate:    GetFormattedDate("2024-03-01"),
+		DeadlineDate: GetFormattedDate("2024-03-15"),
+		Status:       "new",
+		CustomerID:   customerID,
+		Description:  "Cables",
+	}
+}
+
+func TestAddJobConcurrently(t *testing.T) {
+	for _, kind := range storeKinds {
+		kind := kind
+		t.Run(kind.name, func(t *testing.T) {
+			t.Parallel()
+			store, reopen := kind.open(t)
+			js := NewJobService(store, store, nil)
+			ctx := context.Background()
+
+			const n = 50
+			ids := make([]string, n)
+			errs := make([]error, n)
+			var wg sync.WaitGroup
+			for i := 0; i < n; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					j := newTestJob("")
+					errs[i] = js.AddJob(ctx, j)
+					ids[i] = j.ID
+				}(i)
+			}
+			wg.Wait()
+
+			seen := make(map[string]bool)
+			for i, err := range errs {
+				if err != nil {
+					t.Fatalf("AddJob %d: %v", i, err)
+				}
+				if seen[ids[i]] {
+					t.Fatalf("ID %s was given to two jobs", ids[i])
+				}
+				seen[ids[i]] = true
+			}
+			for name, s := range map[string]Store{"store": store, "reopened store": reopen()} {
+				jobsList, err := s.ListJobs()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(jobsList) != n {
+					t.Errorf("%s has %d jobs, want %d", name, len(jobsList), n)
+				}
+				for _, j := range jobsList {
+					if !seen[j.ID] {
+						t.Errorf("%s has job %s, which was never added", name, j.ID)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestUpdateAndDeleteJobsConcurrently(t *testing.T) {
+	for _, kind := range storeKinds {
+		kind := kind
+		t.Run(kind.name, func(t *testing.T) {
+			t.Parallel()
+			store, reopen := kind.open(t)
+			js := NewJobService(store, store, nil)
+			cs := NewCustomerService(store, nil, js)
+			ctx := context.Background()
+			customer := &Customer{Name: "Acme"}
+			if err := cs.AddCustomer(ctx, customer); err != nil {
+				t.Fatal(err)
+			}
+
+			const n = 20
+			updated := make([]*Job, n)
+			deleted := make([]*Job, n)
+			for i := range updated {
+				updated[i], deleted[i] = newTestJob(""), newTestJob("")
+				if err := js.AddJob(ctx, updated[i]); err != nil {
+					t.Fatal(err)
+				}
+				if err := js.AddJob(ctx, deleted[i]); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// Every update of a job changes a different field, so
+			// all of them must be found in the job in the end.
+			item := &LineItem{Description: "XLR", Quantity: 2, UnitPrice: 1050}
+			updates := []*Job{
+				{Description: "Cables and plugs"},
+				{DeadlineDate: GetFormattedDate("2024-04-01")},
+				{Status: "in_progress"},
+				{CustomerID: customer.ID},
+				{Items: []*LineItem{item}},
+			}
+			var wg sync.WaitGroup
+			errs := make(chan error, n*(len(updates)+1))
+			for i := 0; i < n; i++ {
+				for _, u := range updates {
+					wg.Add(1)
+					go func(id string, u Job) {
+						defer wg.Done()
+						if _, err := js.UpdateJob(ctx, id, &u); err != nil {
+							errs <- fmt.Errorf("UpdateJob %s: %w", id, err)
+						}
+					}(updated[i].ID, *u)
+				}
+				wg.Add(1)
+				go func(id string) {
+					defer wg.Done()
+					if err := js.DeleteJob(ctx, id); err != nil {
+						errs <- fmt.Errorf("DeleteJob %s: %w", id, err)
+					}
+				}(deleted[i].ID)
+			}
+			wg.Wait()
+			close(errs)
+			for err := range errs {
+				t.Error(err)
+			}
+
+			for name, s := range map[string]Store{"store": store, "reopened store": reopen()} {
+				for _, want := range updated {
+					j, err := s.GetJob(want.ID)
+					if err != nil {
+						t.Fatalf("%s: %v", name, err)
+					}
+					if j.Description != "Cables and plugs" || j.DeadlineDate.Format(JobsDateFormat) != "2024-04-01" ||
+						j.Status != "in_progress" || j.CustomerID != customer.ID || len(j.Items) != 1 {
+						t.Errorf("%s lost updates of job %s: %+v", name, j.ID, j)
+					}
+					if j.Totals.Total != 2100 {
+						t.Errorf("%s: job %s totals %d, want 2100", name, j.ID, j.Totals.Total)
+					}
+					if j.DeletedAt != nil {
+						t.Errorf("%s: job %s is in the trash", name, j.ID)
+					}
+				}
+				for _, want := range deleted {
+					j, err := s.GetJob(want.ID)
+					if err != nil {
+						t.Fatalf("%s: %v", name, err)
+					}
+					if j.DeletedAt == nil {
+						t.Errorf("%s: job %s is not in the trash", name, j.ID)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestAddAndUpdateCustomersConcurrently(t *testing.T) {
+	for _, kind := range storeKinds {
+		kind := kind
+		t.Run(kind.name, func(t *testing.T) {
+			t.Parallel()
+			store, reopen := kind.open(t)
+			js := NewJobService(store, store, nil)
+			cs := NewCustomerService(store, nil, js)
+			ctx := context.Background()
+
+			const n = 20
+			added := make([]*Customer, n)
+			var wg sync.WaitGroup
+			errs := make(chan error, 3*n)
+			for i := range added {
+				added[i] = &Customer{Name: fmt.Sprintf("Customer %d", i)}
+				wg.Add(1)
+				go func(c *Customer) {
+					defer wg.Done()
+					if err := cs.AddCustomer(ctx, c); err != nil {
+						errs <- err
+					}
+				}(added[i])
+			}
+			wg.Wait()
+			seen := make(map[string]bool)
+			for _, c := range added {
+				if c.ID == "" || seen[c.ID] {
+					t.Fatalf("customer %q has the ID %q, which is missing or taken", c.Name, c.ID)
+				}
+				seen[c.ID] = true
+			}
+
+			for _, c := range added {
+				for _, u := range []*Customer{{Note: "Pays late"}, {VATNumber: "GB123"}} {
+					wg.Add(1)
+					go func(id string, u *Customer) {
+						defer wg.Done()
+						if _, err := cs.UpdateCustomer(ctx, id, u); err != nil {
+							errs <- err
+						}
+					}(c.ID, u)
+				}
+			}
+			wg.Wait()
+			close(errs)
+			for err := range errs {
+				t.Error(err)
+			}
+
+			for name, s := range map[string]Store{"store": store, "reopened store": reopen()} {
+				for _, want := range added {
+					c, err := s.GetCustomer(want.ID)
+					if err != nil {
+						t.Fatalf("%s: %v", name, err)
+					}
+					if c.Name != want.Name || c.Note != "Pays late" || c.VATNumber != "GB123" {
+						t.Errorf("%s lost updates of customer %s: %+v", name, c.ID, c)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestAddJobsWhileDeletingTheirCustomer(t *testing.T) {
+	for _, kind := range storeKinds {
+		kind := kind
+		t.Run(kind.name, func(t *testing.T) {
+			t.Parallel()
+			store, _ := kind.open(t)
+			js := NewJobService(store, store, nil)
+			cs := NewCustomerService(store, nil, js)
+			ctx := context.Background()
+
+			for round := 0; round < 10; round++ {
+				customer := &Customer{Name: fmt.Sprintf("Customer %d", round)}
+				if err := cs.AddCustomer(ctx, customer); err != nil {
+					t.Fatal(err)
+				}
+				var wg sync.WaitGroup
+				for i := 0; i < 5; i++ {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						js.AddJob(ctx, newTestJob(customer.ID))
+					}()
+				}
+				var deleteErr error
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					deleteErr = cs.DeleteCustomer(ctx, customer.ID, DeleteCustomerOptions{})
+				}()
+				wg.Wait()
+
+				jobsList, err := js.FilterJobs(customer.ID)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if deleteErr == nil && len(jobsList) > 0 {
+					t.Fatalf("customer %s was deleted with %d jobs", customer.ID, len(jobsList))
+				}
+			}
+		})
+	}
+}
+
+// failingCustomerStore fails to save the customers moved to the trash.
+type failingCustomerStore struct {
+	CustomerStore
+}
+
+func (s failingCustomerStore) PutCustomer(c *Customer) error {
+	if c.DeletedAt != nil {
+		return fmt.Errorf("disk full")
+	}
+	return s.CustomerStore.PutCustomer(c)
+}
+
+func TestReassignJobsUndoneIfCustomerNotDeleted(t *testing.T) {
+	for _, kind := range storeKinds {
+		kind := kind
+		t.Run(kind.name, func(t *testing.T) {
+			t.Parallel()
+			store, _ := kind.open(t)
+			js := NewJobService(store, store, nil)
+			cs := NewCustomerService(failingCustomerStore{store}, nil, js)
+			ctx := context.Background()
+			from, to := &Customer{Name: "Acme"}, &Customer{Name: "Beta"}
+			for _, c := range []*Customer{from, to} {
+				if err := cs.AddCustomer(ctx, c); err != nil {
+					t.Fatal(err)
+				}
+			}
+			j := newTestJob(from.ID)
+			if err := js.AddJob(ctx, j); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, opts := range []DeleteCustomerOptions{{Jobs: ReassignJobs, ReassignTo: to.ID}, {Jobs: DetachJobs}} {
+				if err := cs.DeleteCustomer(ctx, from.ID, opts); err == nil {
+					t.Fatalf("deleted customer %s with %s although it could not be saved", from.ID, opts.Jobs)
+				}
+				got, err := store.GetJob(j.ID)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got.CustomerID != from.ID {
+					t.Errorf("job %s was left with customer %q after failing to %s its jobs", j.ID, got.CustomerID, opts.Jobs)
+				}
+			}
+		})
+	}
+}
+
+func TestDeleteCustomerWithUnknownJobsOption(t *testing.T) {
+	store := NewMemoryStore()
+	js := NewJobService(store, store, nil)
+	cs := NewCustomerService(store, nil, js)
+	ctx := context.Background()
+	c := &Customer{Name: "Acme"}
+	if err := cs.AddCustomer(ctx, c); err != nil {
+		t.Fatal(err)
+	}
+	err := cs.DeleteCustomer(ctx, c.ID, DeleteCustomerOptions{Jobs: "bogus"})
+	var verr *ValidationError
+	if !errors.As(err, &verr) || len(verr.Fields) != 1 || verr.Fields[0].Field != "jobs" {
+		t.Fatalf("deleting with jobs=bogus returned %v, want a validation error on jobs", err)
+	}
+	if _, err := cs.GetCustomer(c.ID); err != nil {
+		t.Errorf("customer %s was deleted: %v", c.ID, err)
+	}
+}
+
+func TestUpdateJobChecksOnlyChangedFields(t *testing.T) {
+	store := NewMemoryStore()
+	js := NewJobService(store, store, nil)
+	ctx := context.Background()
+	// A job saved before its status was taken out of the workflow,
+	// with a customer that has since been purged.
+	legacy := newTestJob("gone")
+	legacy.ID, legacy.Status = "j1", "retired"
+	if err := store.PutJob(legacy); err != nil {
+		t.Fatal(err)
+	}
+
+	updated, err := js.UpdateJob(ctx, legacy.ID, &Job{Description: "Plugs", DeadlineDate: GetFormattedDate("2024-04-01")})
+	if err != nil {
+		t.Fatalf("could not edit a job in a status no longer configured: %v", err)
+	}
+	if updated.Description != "Plugs" || updated.Status != "retired" {
+		t.Errorf("job has description %q and status %q, want Plugs and retired", updated.Description, updated.Status)
+	}
+
+	for _, changes := range []*Job{
+		{Status: "bogus"},
+		{DeadlineDate: GetFormattedDate("2024-02-01")},
+		{CustomerID: "gone"},
+		{Items: []*LineItem{{Quantity: 1}}},
+	} {
+		if _, err := js.UpdateJob(ctx, legacy.ID, changes); !errors.Is(err, ErrInvalid) {
+			t.Errorf("UpdateJob(%+v) returned %v, want a validation error", changes, err)
+		}
+	}
+}
+
+// failingAuditLog cannot append any entry.
+type failingAuditLog struct{}
+
+func (failingAuditLog) Append(e *AuditEntry) error {
+	return fmt.Errorf("disk full")
+}
+
+func (failingAuditLog) History(entity, id string) ([]*AuditEntry, error) {
+	return nil, fmt.Errorf("disk full")
+}
+
+func TestChangesSavedWithoutAudit(t *testing.T) {
+	store := NewMemoryStore()
+	js := NewJobService(store, store, failingAuditLog{})
+	ctx := context.Background()
+	j := newTestJob("")
+	if err := js.AddJob(ctx, j); err != nil {
+		t.Fatalf("AddJob failed although the job was saved: %v", err)
+	}
+	if _, err := js.UpdateJob(ctx, j.ID, &Job{Description: "Plugs"}); err != nil {
+		t.Fatalf("UpdateJob failed although the job was saved: %v", err)
+	}
+	jobsList, err := store.ListJobs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobsList) != 1 || jobsList[0].Description != "Plugs" {
+		t.Errorf("store holds %d jobs, want the one job, updated", len(jobsList))
+	}
+}
@@ -0,0 +1,110 @@
+package jobs
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// LineItem is something a job is charged for. Amounts are in cents,
+// Subtotal, Tax and Total are computed by the server.
+type LineItem struct {
+	Description string  `json:"description"`
+	Quantity    float64 `json:"quantity"`
+	UnitPrice   int64   `json:"unit_price"`
+	// TaxRate is the percentage of tax charged on the discounted price.
+	TaxRate float64 `json:"tax_rate"`
+	// Discount is the percentage taken off the price.
+	Discount float64 `json:"discount"`
+	Subtotal int64   `json:"subtotal"`
+	Tax      int64   `json:"tax"`
+	Total    int64   `json:"total"`
+}
+
+// Totals adds up line items, in cents.
+type Totals struct {
+	Subtotal int64 `json:"subtotal"`
+	Tax      int64 `json:"tax"`
+	Total    int64 `json:"total"`
+}
+
+func (t *Totals) add(o Totals) {
+	t.Subtotal += o.Subtotal
+	t.Tax += o.Tax
+	t.Total += o.Total
+}
+
+// computeTotals works out the amounts of every line item of j and their totals.
+func (j *Job) computeTotals() {
+	j.Totals = computeItems(j.Items)
+}
+
+// computeItems works out the amounts of every line item and returns their totals.
+func computeItems(items []*LineItem) Totals {
+	var t Totals
+	for _, li := range items {
+		li.compute()
+		t.add(Totals{Subtotal: li.Subtotal, Tax: li.Tax, Total: li.Total})
+	}
+	return t
+}
+
+// compute rounds each amount to the cent, so that
+// the amounts on a line always add up.
+func (li *LineItem) compute() {
+	gross := li.Quantity * float64(li.UnitPrice)
+	li.Subtotal = int64(math.Round(gross * (1 - li.Discount/100)))
+	li.Tax = int64(math.Round(float64(li.Subtotal) * li.TaxRate / 100))
+	li.Total = li.Subtotal + li.Tax
+}
+
+// validateItems adds the problems with the line items to verr.
+func validateItems(items []*LineItem, verr *ValidationError) {
+	for i, li := range items {
+		field := fmt.Sprintf("items[%d]", i)
+		if strings.TrimSpace(li.Description) == "" {
+			verr.add(field+".description", "is required")
+		}
+		if li.Quantity <= 0 {
+			verr.add(field+".quantity", "must be more than 0")
+		}
+		if li.UnitPrice < 0 {
+			verr.add(field+".unit_price", "cannot be negative")
+		}
+		if li.TaxRate < 0 || li.TaxRate > 100 {
+			verr.add(field+".tax_rate", "must be between 0 and 100")
+		}
+		if li.Discount < 0 || li.Discount > 100 {
+			verr.add(field+".discount", "must be between 0 and 100")
+		}
+	}
+}
+
+// SumTotals adds up the totals of jobsList.
+func SumTotals(jobsList []*Job) Totals {
+	var t Totals
+	for _, j := range jobsList {
+		t.add(j.Totals)
+	}
+	return t
+}
+
+// FormatCents formats an amount in cents as units with two decimals.
+func FormatCents(cents int64) string {
+	sign := ""
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, cents/100, cents%100)
+}
+
+// ParseCents parses an amount in units, like "12.5", into cents.
+func ParseCents(s string) (int64, error) {
+	f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not an amount", s)
+	}
+	return int64(math.Round(f * 100)), nil
+}
@@ -0,0 +1,137 @@
+package jobs
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// RenderMarkdown renders the Markdown in s, such as a job description
+// or customer note, as HTML. It knows paragraphs, headings, lists,
+// quotes, code, emphasis and links. The output is safe to put in a page
+// as is: all of s is escaped, only the tags of the Markdown it renders
+// are added, and links only go to web pages, email addresses or the
+// site itself. Line breaks are kept, as people write notes line by line.
+func RenderMarkdown(s string) string {
+	var b strings.Builder
+	lines := strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n")
+	var paragraph []string
+	list := ""
+	flush := func() {
+		if len(paragraph) > 0 {
+			b.WriteString("<p>" + strings.Join(paragraph, "<br>") + "</p>")
+			paragraph = nil
+		}
+		if list != "" {
+			b.WriteString("</" + list + ">")
+			list = ""
+		}
+	}
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimRight(lines[i], " \t")
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") {
+			flush()
+			code := make([]string, 0)
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), "```"); i++ {
+				code = append(code, html.EscapeString(lines[i]))
+			}
+			b.WriteString("<pre><code>" + strings.Join(code, "\n") + "</code></pre>")
+			continue
+		}
+		if trimmed == "" {
+			flush()
+			continue
+		}
+		if m := headingPattern.FindStringSubmatch(trimmed); m != nil {
+			flush()
+			level := len(m[1])
+			b.WriteString(fmt.Sprintf("<h%d>%s</h%d>", level, renderInline(m[2]), level))
+			continue
+		}
+		if m := listPattern.FindStringSubmatch(trimmed); m != nil {
+			kind := "ul"
+			if m[1] != "-" && m[1] != "*" && m[1] != "+" {
+				kind = "ol"
+			}
+			if list != kind {
+				flush()
+				b.WriteString("<" + kind + ">")
+				list = kind
+			}
+			b.WriteString("<li>" + renderInline(m[2]) + "</li>")
+			continue
+		}
+		if strings.HasPrefix(trimmed, ">") {
+			flush()
+			b.WriteString("<blockquote>" + renderInline(strings.TrimSpace(trimmed[1:])) + "</blockquote>")
+			continue
+		}
+		if list != "" {
+			flush()
+		}
+		paragraph = append(paragraph, renderInline(trimmed))
+	}
+	flush()
+	return b.String()
+}
+
+var (
+	headingPattern = regexp.MustCompile(`^(#{1,6})\s+(.*)$`)
+	listPattern    = regexp.MustCompile(`^([-*+]|\d+[.)])\s+(.*)$`)
+	codePattern    = regexp.MustCompile("`([^`]+)`")
+	linkPattern    = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+	strongPattern  = regexp.MustCompile(`\*\*([^*]+)\*\*|__([^_]+)__`)
+	emPattern      = regexp.MustCompile(`\*([^*\s][^*]*)\*|\b_([^_]+)_\b`)
+	// placeholderPattern finds the code and links set aside while
+	// rendering the rest, so that their text is left as it is.
+	placeholderPattern = regexp.MustCompile("\x00(\\d+)\x00")
+)
+
+// linkSchemes are the starts of the link targets that are rendered.
+var linkSchemes = []string{"http://", "https://", "mailto:", "/", "#"}
+
+// renderInline renders the code, links and emphasis in the line s.
+func renderInline(s string) string {
+	s = strings.ReplaceAll(s, "\x00", "")
+	setAside := make([]string, 0)
+	keep := func(rendered string) string {
+		setAside = append(setAside, rendered)
+		return fmt.Sprintf("\x00%d\x00", len(setAside)-1)
+	}
+	s = codePattern.ReplaceAllStringFunc(s, func(m string) string {
+		return keep("<code>" + html.EscapeString(m[1:len(m)-1]) + "</code>")
+	})
+	s = html.EscapeString(s)
+	s = linkPattern.ReplaceAllStringFunc(s, func(m string) string {
+		parts := linkPattern.FindStringSubmatch(m)
+		text, target := parts[1], parts[2]
+		for _, scheme := range linkSchemes {
+			if strings.HasPrefix(strings.ToLower(target), scheme) {
+				return keep(fmt.Sprintf(`<a href="%s" rel="noopener noreferrer" target="_blank">%s</a>`, target, emphasize(text)))
+			}
+		}
+		return text
+	})
+	s = emphasize(s)
+	// Links set aside can hold code set aside before them.
+	for placeholderPattern.MatchString(s) {
+		s = placeholderPattern.ReplaceAllStringFunc(s, func(m string) string {
+			i, _ := strconv.Atoi(strings.Trim(m, "\x00"))
+			return setAside[i]
+		})
+	}
+	return s
+}
+
+// emphasize renders the strong and emphasised text in the escaped s.
+func emphasize(s string) string {
+	s = strongPattern.ReplaceAllStringFunc(s, func(m string) string {
+		return "<strong>" + m[2:len(m)-2] + "</strong>"
+	})
+	return emPattern.ReplaceAllStringFunc(s, func(m string) string {
+		return "<em>" + m[1:len(m)-1] + "</em>"
+	})
+}
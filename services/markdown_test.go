@@ -0,0 +1,42 @@
+package jobs
+
+import "testing"
+
+func TestRenderMarkdown(t *testing.T) {
+	tests := []struct {
+		name, markdown, want string
+	}{
+		{"escaping", `<script>alert("x")</script> & co`,
+			`<p>&lt;script&gt;alert(&#34;x&#34;)&lt;/script&gt; &amp; co</p>`},
+		{"NULs", "a\x000\x00b", `<p>a0b</p>`},
+		{"line breaks", "one\ntwo\n\nthree", `<p>one<br>two</p><p>three</p>`},
+		{"heading", "## Cables *now*", `<h2>Cables <em>now</em></h2>`},
+		{"lists", "- one\n- two\n1. first", `<ul><li>one</li><li>two</li></ul><ol><li>first</li></ol>`},
+		{"quote", "> said **so**", `<blockquote>said <strong>so</strong></blockquote>`},
+		{"code", "use `<b>**x**</b>` here", `<p>use <code>&lt;b&gt;**x**&lt;/b&gt;</code> here</p>`},
+		{"code block", "```\n<b>\n**x**\n```", "<pre><code>&lt;b&gt;\n**x**</code></pre>"},
+		{"link", "[site](https://a.example/?a=1&b=2)",
+			`<p><a href="https://a.example/?a=1&amp;b=2" rel="noopener noreferrer" target="_blank">site</a></p>`},
+		{"mail and local links", "[m](mailto:a@b.example) [j](/jobs)",
+			`<p><a href="mailto:a@b.example" rel="noopener noreferrer" target="_blank">m</a> ` +
+				`<a href="/jobs" rel="noopener noreferrer" target="_blank">j</a></p>`},
+		{"unknown scheme", "[click](javascript:alert(1))", `<p>click)</p>`},
+		{"unknown scheme in capitals", "[click](JavaScript:alert)", `<p>click</p>`},
+		{"quotes in target", `[x](https://a/"onclick="y)`,
+			`<p><a href="https://a/&#34;onclick=&#34;y" rel="noopener noreferrer" target="_blank">x</a></p>`},
+		{"emphasis", "**bold** __bold__ *em* _em_ snake_case_name",
+			`<p><strong>bold</strong> <strong>bold</strong> <em>em</em> <em>em</em> snake_case_name</p>`},
+		{"code in link", "[`x`](https://a)",
+			`<p><a href="https://a" rel="noopener noreferrer" target="_blank"><code>x</code></a></p>`},
+		{"emphasis in link", "[**x** y](https://a)",
+			`<p><a href="https://a" rel="noopener noreferrer" target="_blank"><strong>x</strong> y</a></p>`},
+		{"link in emphasis", "**[x](https://a)**",
+			`<p><strong><a href="https://a" rel="noopener noreferrer" target="_blank">x</a></strong></p>`},
+		{"emphasis in code", "`*x*` *`y`*", `<p><code>*x*</code> <em><code>y</code></em></p>`},
+	}
+	for _, tt := range tests {
+		if got := RenderMarkdown(tt.markdown); got != tt.want {
+			t.Errorf("%s: RenderMarkdown(%q) =\n%s\nwant\n%s", tt.name, tt.markdown, got, tt.want)
+		}
+	}
+}
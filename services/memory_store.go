@@ -0,0 +1,364 @@
+package jobs
+
+import (
+	"fmt"
+	"sync"
+)
+
+// MemoryStore is a Store that keeps everything in memory.
+// It is mostly useful for tests. It is safe for concurrent use.
+type MemoryStore struct {
+	mu        sync.RWMutex
+	jobs      map[string]*Job
+	customers map[string]*Customer
+	invoices  map[string]*Invoice
+	payments  map[string]*Payment
+	quotes    map[string]*Quote
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		jobs:      make(map[string]*Job, 0),
+		customers: make(map[string]*Customer, 0),
+		invoices:  make(map[string]*Invoice, 0),
+		payments:  make(map[string]*Payment, 0),
+		quotes:    make(map[string]*Quote, 0),
+	}
+}
+
+func (ms *MemoryStore) GetJob(id string) (*Job, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	return ms.getJob(id)
+}
+
+func (ms *MemoryStore) getJob(id string) (*Job, error) {
+	j, ok := ms.jobs[id]
+	if !ok {
+		return nil, fmt.Errorf("job %s %w", id, ErrNotFound)
+	}
+	return j.clone(), nil
+}
+
+func (ms *MemoryStore) ListJobs() ([]*Job, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	return ms.listJobs()
+}
+
+func (ms *MemoryStore) listJobs() ([]*Job, error) {
+	jobsList := make([]*Job, 0, len(ms.jobs))
+	for _, j := range ms.jobs {
+		jobsList = append(jobsList, j.clone())
+	}
+	return jobsList, nil
+}
+
+func (ms *MemoryStore) PutJob(j *Job) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	return ms.putJob(j)
+}
+
+func (ms *MemoryStore) putJob(j *Job) error {
+	ms.jobs[j.ID] = j.clone()
+	return nil
+}
+
+func (ms *MemoryStore) PutJobs(jobsList []*Job) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	for _, j := range jobsList {
+		if err := ms.putJob(j); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ms *MemoryStore) DeleteJob(id string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	return ms.deleteJob(id)
+}
+
+func (ms *MemoryStore) deleteJob(id string) error {
+	if _, ok := ms.jobs[id]; !ok {
+		return fmt.Errorf("job %s %w", id, ErrNotFound)
+	}
+	delete(ms.jobs, id)
+	return nil
+}
+
+func (ms *MemoryStore) GetCustomer(id string) (*Customer, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	return ms.getCustomer(id)
+}
+
+func (ms *MemoryStore) getCustomer(id string) (*Customer, error) {
+	c, ok := ms.customers[id]
+	if !ok {
+		return nil, fmt.Errorf("customer %s %w", id, ErrNotFound)
+	}
+	return c.clone(), nil
+}
+
+func (ms *MemoryStore) ListCustomers() ([]*Customer, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	return ms.listCustomers()
+}
+
+func (ms *MemoryStore) listCustomers() ([]*Customer, error) {
+	csList := make([]*Customer, 0, len(ms.customers))
+	for _, c := range ms.customers {
+		csList = append(csList, c.clone())
+	}
+	return csList, nil
+}
+
+func (ms *MemoryStore) PutCustomer(c *Customer) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	return ms.putCustomer(c)
+}
+
+func (ms *MemoryStore) putCustomer(c *Customer) error {
+	ms.customers[c.ID] = c.clone()
+	return nil
+}
+
+func (ms *MemoryStore) PutCustomers(csList []*Customer) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	for _, c := range csList {
+		if err := ms.putCustomer(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ms *MemoryStore) DeleteCustomer(id string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	return ms.deleteCustomer(id)
+}
+
+func (ms *MemoryStore) deleteCustomer(id string) error {
+	if _, ok := ms.customers[id]; !ok {
+		return fmt.Errorf("customer %s %w", id, ErrNotFound)
+	}
+	delete(ms.customers, id)
+	return nil
+}
+
+func (ms *MemoryStore) GetInvoice(id string) (*Invoice, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	return ms.getInvoice(id)
+}
+
+func (ms *MemoryStore) getInvoice(id string) (*Invoice, error) {
+	inv, ok := ms.invoices[id]
+	if !ok {
+		return nil, fmt.Errorf("invoice %s %w", id, ErrNotFound)
+	}
+	return inv.clone(), nil
+}
+
+func (ms *MemoryStore) ListInvoices() ([]*Invoice, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	return ms.listInvoices()
+}
+
+func (ms *MemoryStore) listInvoices() ([]*Invoice, error) {
+	invList := make([]*Invoice, 0, len(ms.invoices))
+	for _, inv := range ms.invoices {
+		invList = append(invList, inv.clone())
+	}
+	return invList, nil
+}
+
+func (ms *MemoryStore) PutInvoice(inv *Invoice) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	return ms.putInvoice(inv)
+}
+
+func (ms *MemoryStore) putInvoice(inv *Invoice) error {
+	ms.invoices[inv.ID] = inv.clone()
+	return nil
+}
+
+func (ms *MemoryStore) GetPayment(id string) (*Payment, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	return ms.getPayment(id)
+}
+
+func (ms *MemoryStore) getPayment(id string) (*Payment, error) {
+	p, ok := ms.payments[id]
+	if !ok {
+		return nil, fmt.Errorf("payment %s %w", id, ErrNotFound)
+	}
+	return p.clone(), nil
+}
+
+func (ms *MemoryStore) ListPayments() ([]*Payment, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	return ms.listPayments()
+}
+
+func (ms *MemoryStore) listPayments() ([]*Payment, error) {
+	payList := make([]*Payment, 0, len(ms.payments))
+	for _, p := range ms.payments {
+		payList = append(payList, p.clone())
+	}
+	return payList, nil
+}
+
+func (ms *MemoryStore) PutPayment(p *Payment) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	return ms.putPayment(p)
+}
+
+func (ms *MemoryStore) putPayment(p *Payment) error {
+	ms.payments[p.ID] = p.clone()
+	return nil
+}
+
+func (ms *MemoryStore) DeletePayment(id string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	return ms.deletePayment(id)
+}
+
+func (ms *MemoryStore) deletePayment(id string) error {
+	if _, ok := ms.payments[id]; !ok {
+		return fmt.Errorf("payment %s %w", id, ErrNotFound)
+	}
+	delete(ms.payments, id)
+	return nil
+}
+
+func (ms *MemoryStore) GetQuote(id string) (*Quote, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	return ms.getQuote(id)
+}
+
+func (ms *MemoryStore) getQuote(id string) (*Quote, error) {
+	q, ok := ms.quotes[id]
+	if !ok {
+		return nil, fmt.Errorf("quote %s %w", id, ErrNotFound)
+	}
+	return q.clone(), nil
+}
+
+func (ms *MemoryStore) ListQuotes() ([]*Quote, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	return ms.listQuotes()
+}
+
+func (ms *MemoryStore) listQuotes() ([]*Quote, error) {
+	qList := make([]*Quote, 0, len(ms.quotes))
+	for _, q := range ms.quotes {
+		qList = append(qList, q.clone())
+	}
+	return qList, nil
+}
+
+func (ms *MemoryStore) PutQuote(q *Quote) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	return ms.putQuote(q)
+}
+
+func (ms *MemoryStore) putQuote(q *Quote) error {
+	ms.quotes[q.ID] = q.clone()
+	return nil
+}
+
+// Snapshot writes all the records into dir in the same
+// format as the JSON data files.
+func (ms *MemoryStore) Snapshot(dir string) error {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	jobsList, err := ms.listJobs()
+	if err != nil {
+		return err
+	}
+	sortJobs(jobsList)
+	if err := writeJobsFile(dir, jobsList); err != nil {
+		return err
+	}
+	csList, err := ms.listCustomers()
+	if err != nil {
+		return err
+	}
+	if err := writeCustomersFile(dir, csList); err != nil {
+		return err
+	}
+	invList, err := ms.listInvoices()
+	if err != nil {
+		return err
+	}
+	if err := writeInvoicesFile(dir, invList); err != nil {
+		return err
+	}
+	payList, err := ms.listPayments()
+	if err != nil {
+		return err
+	}
+	if err := writePaymentsFile(dir, payList); err != nil {
+		return err
+	}
+	qList, err := ms.listQuotes()
+	if err != nil {
+		return err
+	}
+	return writeQuotesFile(dir, qList)
+}
+
+// Restore replaces all the records with the ones
+// in the JSON data files in dir.
+func (ms *MemoryStore) Restore(dir string) error {
+	data, err := ReadJSONFiles(dir)
+	if err != nil {
+		return err
+	}
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.replace(data)
+	return nil
+}
+
+// replace must be called with ms.mu held.
+func (ms *MemoryStore) replace(data *Data) {
+	ms.jobs = make(map[string]*Job, len(data.Jobs))
+	for _, j := range data.Jobs {
+		ms.jobs[j.ID] = j
+	}
+	ms.customers = make(map[string]*Customer, len(data.Customers))
+	for _, c := range data.Customers {
+		ms.customers[c.ID] = c
+	}
+	ms.invoices = make(map[string]*Invoice, len(data.Invoices))
+	for _, inv := range data.Invoices {
+		ms.invoices[inv.ID] = inv
+	}
+	ms.payments = make(map[string]*Payment, len(data.Payments))
+	for _, p := range data.Payments {
+		ms.payments[p.ID] = p
+	}
+	ms.quotes = make(map[string]*Quote, len(data.Quotes))
+	for _, q := range data.Quotes {
+		ms.quotes[q.ID] = q
+	}
+}
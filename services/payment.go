@@ -0,0 +1,427 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// PaidStatus is the status jobs are moved to when they
+// are paid in full, if the workflow has it.
+const PaidStatus = "paid"
+
+// Payment is money received against an invoice. Invoices
+// can be paid in any number of partial payments.
+type Payment struct {
+	ID        string `json:"id"`
+	InvoiceID string `json:"invoice_id"`
+	// JobID is set when the payment is for one of the invoiced jobs.
+	// Payments without one pay off the jobs of the invoice in order.
+	JobID string `json:"job_id,omitempty"`
+	// CustomerID is the customer of the invoice.
+	CustomerID string `json:"customer_id"`
+	// Amount is in cents.
+	Amount     int64      `json:"amount"`
+	Date       *time.Time `json:"date"`
+	Method     string     `json:"method"`
+	Reference  string     `json:"reference"`
+	RecordedAt time.Time  `json:"recorded_at"`
+}
+
+// Balance is how much of an amount, in cents, is still to be paid.
+type Balance struct {
+	Total       int64 `json:"total"`
+	Paid        int64 `json:"paid"`
+	Outstanding int64 `json:"outstanding"`
+	// Overdue is the part of Outstanding past its due date.
+	Overdue int64 `json:"overdue"`
+	// PaymentOverdue is set when some of the balance is overdue.
+	PaymentOverdue bool `json:"payment_overdue"`
+}
+
+func (b *Balance) add(o Balance) {
+	b.Total += o.Total
+	b.Paid += o.Paid
+	b.Outstanding += o.Outstanding
+	b.Overdue += o.Overdue
+	b.PaymentOverdue = b.PaymentOverdue || o.PaymentOverdue
+}
+
+// JobBalance is the balance of an invoiced job.
+type JobBalance struct {
+	JobID     string `json:"job_id"`
+	InvoiceID string `json:"invoice_id"`
+	Balance
+}
+
+// InvoiceBalance is the balance of an invoice and its jobs.
+type InvoiceBalance struct {
+	InvoiceID    string        `json:"invoice_id"`
+	Reference    string        `json:"reference"`
+	CustomerID   string        `json:"customer_id"`
+	CustomerName string        `json:"customer_name"`
+	IssuedAt     time.Time     `json:"issued_at"`
+	DueDate      time.Time     `json:"due_date"`
+	Jobs         []*JobBalance `json:"jobs"`
+	Balance
+}
+
+// CustomerBalance is the balance of all the invoices of a customer.
+type CustomerBalance struct {
+	CustomerID   string            `json:"customer_id"`
+	CustomerName string            `json:"customer_name"`
+	Invoices     []*InvoiceBalance `json:"invoices"`
+	Balance
+}
+
+// PaymentService is safe for concurrent use. Payments are recorded one
+// at a time, so that invoices cannot be paid more than once. Every change
+// is recorded in the audit log, if there is one.
+type PaymentService struct {
+	mu       sync.Mutex
+	store    PaymentStore
+	audit    AuditLog
+	invoices InvoiceStore
+	jobs     InvoiceJobs
+	// termsDays is how many days customers have to pay an invoice.
+	termsDays int
+}
+
+func NewPaymentService(store PaymentStore, audit AuditLog, invoices InvoiceStore, jobs InvoiceJobs, termsDays int) *PaymentService {
+	return &PaymentService{
+		store:     store,
+		audit:     audit,
+		invoices:  invoices,
+		jobs:      jobs,
+		termsDays: termsDays,
+	}
+}
+
+// ListPayments returns the payments of the invoice invoiceID and the
+// customer customerID, ignoring either if it is empty, oldest first.
+func (ps *PaymentService) ListPayments(invoiceID, customerID string) ([]*Payment, error) {
+	all, err := ps.store.ListPayments()
+	if err != nil {
+		return nil, err
+	}
+	payList := make([]*Payment, 0)
+	for _, p := range all {
+		if (invoiceID == "" || p.InvoiceID == invoiceID) &&
+			(customerID == "" || p.CustomerID == customerID) {
+			payList = append(payList, p)
+		}
+	}
+	sortPayments(payList)
+	return payList, nil
+}
+
+// AddPayment records the new payment p, which must pass validation and
+// cannot be more than is outstanding, and sets its ID. Jobs paid in full
+// are moved to PaidStatus.
+func (ps *PaymentService) AddPayment(ctx context.Context, p *Payment) error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	verr := &ValidationError{Entity: AuditEntityPayment}
+	if p.Amount <= 0 {
+		verr.add("amount", "must be more than 0")
+	}
+	if p.Date == nil {
+		verr.add("date", "is required")
+	}
+	if strings.TrimSpace(p.Method) == "" {
+		verr.add("method", "is required")
+	}
+	if p.InvoiceID == "" {
+		verr.add("invoice_id", "is required")
+		return verr
+	}
+	inv, err := ps.invoices.GetInvoice(p.InvoiceID)
+	if err != nil {
+		return err
+	}
+	payList, err := ps.ListPayments(inv.ID, "")
+	if err != nil {
+		return err
+	}
+	ib := ps.invoiceBalance(inv, payList, time.Now())
+	outstanding := ib.Outstanding
+	if p.JobID != "" {
+		jb := ib.job(p.JobID)
+		if jb == nil {
+			verr.add("job_id", "job %s is not on invoice %s", p.JobID, inv.Reference())
+		} else {
+			outstanding = jb.Outstanding
+		}
+	}
+	if p.Amount > outstanding {
+		verr.add("amount", "cannot be more than the %s outstanding", FormatCents(outstanding))
+	}
+	if err := verr.err(); err != nil {
+		return err
+	}
+
+	p.ID = uuid.New().String()
+	p.CustomerID = inv.CustomerID
+	p.RecordedAt = time.Now().UTC()
+	if err := ps.store.PutPayment(p); err != nil {
+		return err
+	}
+	recordChange(ctx, ps.audit, AuditEntityPayment, p.ID, AuditActionCreate, nil, p)
+	return ps.markPaid(ctx, ps.invoiceBalance(inv, append(payList, p), time.Now()))
+}
+
+// markPaid moves the jobs of ib paid in full to PaidStatus,
+// where the workflow allows it.
+func (ps *PaymentService) markPaid(ctx context.Context, ib *InvoiceBalance) error {
+	if GetJobStatus(PaidStatus) == nil {
+		return nil
+	}
+	for _, jb := range ib.Jobs {
+		if jb.Outstanding > 0 {
+			continue
+		}
+		j, err := ps.jobs.GetJob(jb.JobID)
+		if err != nil {
+			// Paid jobs may have been deleted since they were invoiced.
+			continue
+		}
+		if j.Status == PaidStatus || checkTransition(j.Status, PaidStatus) != nil {
+			continue
+		}
+		if _, err := ps.jobs.UpdateJob(ctx, j.ID, &Job{Status: PaidStatus}); err != nil {
+			return fmt.Errorf("payment recorded but job %s not moved to %s: %w",
+				j.ID, StatusLabel(PaidStatus), err)
+		}
+	}
+	return nil
+}
+
+// DeletePayment removes the payment id, e.g. when it was recorded by
+// mistake. Jobs already moved to PaidStatus stay there.
+func (ps *PaymentService) DeletePayment(ctx context.Context, id string) error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	p, err := ps.store.GetPayment(id)
+	if err != nil {
+		return err
+	}
+	if err := ps.store.DeletePayment(id); err != nil {
+		return err
+	}
+	recordChange(ctx, ps.audit, AuditEntityPayment, id, AuditActionDelete, p, nil)
+	return nil
+}
+
+// DueDate returns when inv has to be paid by, on the payment
+// terms of the customer or else on the default terms.
+func (ps *PaymentService) DueDate(inv *Invoice) time.Time {
+	days := ps.termsDays
+	if inv.PaymentTermsDays != nil {
+		days = *inv.PaymentTermsDays
+	}
+	return inv.IssuedAt.AddDate(0, 0, days)
+}
+
+// Receivables returns the balance of every customer who still has
+// invoices to pay, with only those invoices. Customers with overdue
+// payments come first, then those who owe the most.
+func (ps *PaymentService) Receivables() ([]*CustomerBalance, error) {
+	balances, err := ps.customerBalances(time.Now())
+	if err != nil {
+		return nil, err
+	}
+	receivables := make([]*CustomerBalance, 0)
+	for _, cb := range balances {
+		if cb.Outstanding == 0 {
+			continue
+		}
+		open := make([]*InvoiceBalance, 0)
+		for _, ib := range cb.Invoices {
+			if ib.Outstanding > 0 {
+				open = append(open, ib)
+			}
+		}
+		cb.Invoices = open
+		receivables = append(receivables, cb)
+	}
+	sort.SliceStable(receivables, func(i, j int) bool {
+		if receivables[i].Overdue != receivables[j].Overdue {
+			return receivables[i].Overdue > receivables[j].Overdue
+		}
+		return receivables[i].Outstanding > receivables[j].Outstanding
+	})
+	return receivables, nil
+}
+
+// CustomerBalance returns the balance of all the invoices of the
+// customer customerID, which is zero if they were never invoiced.
+func (ps *PaymentService) CustomerBalance(customerID string) (*CustomerBalance, error) {
+	balances, err := ps.customerBalances(time.Now())
+	if err != nil {
+		return nil, err
+	}
+	for _, cb := range balances {
+		if cb.CustomerID == customerID {
+			return cb, nil
+		}
+	}
+	return &CustomerBalance{CustomerID: customerID, Invoices: make([]*InvoiceBalance, 0)}, nil
+}
+
+// JobBalance returns the balance of the job jobID,
+// which must have been invoiced.
+func (ps *PaymentService) JobBalance(jobID string) (*JobBalance, error) {
+	balances, err := ps.invoiceBalances(time.Now())
+	if err != nil {
+		return nil, err
+	}
+	for _, ib := range balances {
+		if jb := ib.job(jobID); jb != nil {
+			return jb, nil
+		}
+	}
+	return nil, fmt.Errorf("invoice of job %s %w", jobID, ErrNotFound)
+}
+
+// customerBalances groups the balances of all the
+// invoices by customer, most recent invoice first.
+func (ps *PaymentService) customerBalances(now time.Time) ([]*CustomerBalance, error) {
+	balances, err := ps.invoiceBalances(now)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(balances, func(i, j int) bool {
+		return balances[i].IssuedAt.After(balances[j].IssuedAt)
+	})
+	byCustomer := make(map[string]*CustomerBalance)
+	cbList := make([]*CustomerBalance, 0)
+	for _, ib := range balances {
+		cb, ok := byCustomer[ib.CustomerID]
+		if !ok {
+			cb = &CustomerBalance{
+				CustomerID:   ib.CustomerID,
+				CustomerName: ib.CustomerName,
+				Invoices:     make([]*InvoiceBalance, 0),
+			}
+			byCustomer[ib.CustomerID] = cb
+			cbList = append(cbList, cb)
+		}
+		cb.Invoices = append(cb.Invoices, ib)
+		cb.add(ib.Balance)
+	}
+	return cbList, nil
+}
+
+func (ps *PaymentService) invoiceBalances(now time.Time) ([]*InvoiceBalance, error) {
+	invList, err := ps.invoices.ListInvoices()
+	if err != nil {
+		return nil, err
+	}
+	payList, err := ps.store.ListPayments()
+	if err != nil {
+		return nil, err
+	}
+	sortPayments(payList)
+	byInvoice := make(map[string][]*Payment)
+	for _, p := range payList {
+		byInvoice[p.InvoiceID] = append(byInvoice[p.InvoiceID], p)
+	}
+	balances := make([]*InvoiceBalance, 0, len(invList))
+	for _, inv := range invList {
+		balances = append(balances, ps.invoiceBalance(inv, byInvoice[inv.ID], now))
+	}
+	return balances, nil
+}
+
+// invoiceBalance works out the balance of inv and its jobs from the
+// payments payList made against it. Payments for a job go to that job,
+// the others pay off the jobs in the order they are on the invoice.
+func (ps *PaymentService) invoiceBalance(inv *Invoice, payList []*Payment, now time.Time) *InvoiceBalance {
+	ib := &InvoiceBalance{
+		InvoiceID:    inv.ID,
+		Reference:    inv.Reference(),
+		CustomerID:   inv.CustomerID,
+		CustomerName: inv.CustomerName,
+		IssuedAt:     inv.IssuedAt,
+		DueDate:      ps.DueDate(inv),
+		Jobs:         make([]*JobBalance, 0, len(inv.JobIDs)),
+	}
+	for _, id := range inv.JobIDs {
+		jb := &JobBalance{JobID: id, InvoiceID: inv.ID}
+		for _, item := range inv.Items {
+			if item.JobID == id {
+				jb.Total += item.Total
+			}
+		}
+		ib.Jobs = append(ib.Jobs, jb)
+	}
+
+	var unassigned int64
+	for _, p := range payList {
+		if jb := ib.job(p.JobID); jb != nil {
+			jb.Paid += p.Amount
+		} else {
+			unassigned += p.Amount
+		}
+	}
+	for _, jb := range ib.Jobs {
+		paid := min64(unassigned, jb.Total-jb.Paid)
+		if paid > 0 {
+			jb.Paid += paid
+			unassigned -= paid
+		}
+	}
+
+	overdue := now.After(ib.DueDate)
+	for _, jb := range ib.Jobs {
+		jb.Outstanding = jb.Total - jb.Paid
+		if jb.Outstanding < 0 {
+			jb.Outstanding = 0
+		}
+		if overdue && jb.Outstanding > 0 {
+			jb.Overdue = jb.Outstanding
+			jb.PaymentOverdue = true
+		}
+		ib.add(jb.Balance)
+	}
+	// Anything left over was paid on the invoice as a whole.
+	ib.Paid += unassigned
+	return ib
+}
+
+// job returns the balance of the job id, or nil if it is not on the invoice.
+func (ib *InvoiceBalance) job(id string) *JobBalance {
+	for _, jb := range ib.Jobs {
+		if id != "" && jb.JobID == id {
+			return jb
+		}
+	}
+	return nil
+}
+
+func sortPayments(payList []*Payment) {
+	sort.SliceStable(payList, func(i, j int) bool {
+		di, dj := payList[i].Date, payList[j].Date
+		if di != nil && dj != nil && !di.Equal(*dj) {
+			return di.Before(*dj)
+		}
+		return payList[i].RecordedAt.Before(payList[j].RecordedAt)
+	})
+}
+
+func min64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func (p *Payment) clone() *Payment {
+	c := *p
+	return &c
+}
@@ -0,0 +1,279 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// The states of a quote. Only open quotes can be changed.
+const (
+	QuoteOpen     = "open"
+	QuoteAccepted = "accepted"
+	QuoteDeclined = "declined"
+)
+
+// Quote is an offer made to a customer, which becomes a job
+// once they accept it.
+type Quote struct {
+	ID string `json:"id"`
+	// Number is sequential, like the invoice numbers.
+	Number      int         `json:"number"`
+	CustomerID  string      `json:"customer_id"`
+	Description string      `json:"description"`
+	Items       []*LineItem `json:"items"`
+	// Totals adds up Items and is computed by the server.
+	Totals    Totals    `json:"totals"`
+	CreatedAt time.Time `json:"created_at"`
+	// ValidUntil is the last day the customer can accept the quote.
+	ValidUntil *time.Time `json:"valid_until"`
+	// DeadlineDate is the deadline promised for the job, if any.
+	DeadlineDate *time.Time `json:"deadline_date,omitempty"`
+	State        string     `json:"state"`
+	// JobID is set once the quote has been converted into a job.
+	JobID string `json:"job_id,omitempty"`
+}
+
+// Reference is how the quote is referred to on paper.
+func (q *Quote) Reference() string {
+	return fmt.Sprintf("Q-%05d", q.Number)
+}
+
+// Expired reports whether q is still open after its last valid day.
+func (q *Quote) Expired(now time.Time) bool {
+	if q.State != QuoteOpen || q.ValidUntil == nil {
+		return false
+	}
+	return now.After(q.ValidUntil.AddDate(0, 0, 1))
+}
+
+// QuoteJobs is what QuoteService needs to create jobs.
+type QuoteJobs interface {
+	AddJob(ctx context.Context, j *Job) error
+}
+
+// QuoteCustomers is what QuoteService needs to know about customers.
+type QuoteCustomers interface {
+	GetCustomer(id string) (*Customer, error)
+}
+
+// QuoteService is safe for concurrent use. Changes are serialised, so
+// that no two quotes get the same number and quotes are only converted
+// once. Every change is recorded in the audit log, if there is one.
+type QuoteService struct {
+	mu        sync.Mutex
+	store     QuoteStore
+	audit     AuditLog
+	jobs      QuoteJobs
+	customers QuoteCustomers
+}
+
+func NewQuoteService(store QuoteStore, audit AuditLog, jobs QuoteJobs, customers QuoteCustomers) *QuoteService {
+	return &QuoteService{
+		store:     store,
+		audit:     audit,
+		jobs:      jobs,
+		customers: customers,
+	}
+}
+
+// ListQuotes returns the quotes of the customer customerID,
+// or all of them if it is empty, most recent first.
+func (qs *QuoteService) ListQuotes(customerID string) ([]*Quote, error) {
+	all, err := qs.store.ListQuotes()
+	if err != nil {
+		return nil, err
+	}
+	qList := make([]*Quote, 0)
+	for _, q := range all {
+		if customerID == "" || q.CustomerID == customerID {
+			qList = append(qList, q)
+		}
+	}
+	sort.Slice(qList, func(i, j int) bool {
+		return qList[i].Number > qList[j].Number
+	})
+	return qList, nil
+}
+
+func (qs *QuoteService) GetQuote(id string) (*Quote, error) {
+	return qs.store.GetQuote(id)
+}
+
+// AddQuote saves the new quote q, which must pass validation,
+// and sets its ID and number. Quotes start open.
+func (qs *QuoteService) AddQuote(ctx context.Context, q *Quote) error {
+	qs.mu.Lock()
+	defer qs.mu.Unlock()
+	q.State = QuoteOpen
+	q.JobID = ""
+	if q.Items == nil {
+		q.Items = make([]*LineItem, 0)
+	}
+	if err := qs.validate(q); err != nil {
+		return err
+	}
+	all, err := qs.store.ListQuotes()
+	if err != nil {
+		return err
+	}
+	q.Number = 1
+	for _, other := range all {
+		if other.Number >= q.Number {
+			q.Number = other.Number + 1
+		}
+	}
+	q.ID = uuid.New().String()
+	q.CreatedAt = time.Now().UTC()
+	q.Totals = computeItems(q.Items)
+	if err := qs.store.PutQuote(q); err != nil {
+		return err
+	}
+	recordChange(ctx, qs.audit, AuditEntityQuote, q.ID, AuditActionCreate, nil, q)
+	return nil
+}
+
+// UpdateQuote changes the fields set in newQ on the open quote id and
+// returns the updated quote. Setting the State accepts or declines it.
+func (qs *QuoteService) UpdateQuote(ctx context.Context, id string, newQ *Quote) (*Quote, error) {
+	qs.mu.Lock()
+	defer qs.mu.Unlock()
+	curr, err := qs.store.GetQuote(id)
+	if err != nil {
+		return nil, err
+	}
+	if curr.State != QuoteOpen {
+		return nil, fmt.Errorf("quote %s is %s and can no longer be changed: %w",
+			curr.Reference(), curr.State, ErrConflict)
+	}
+	before := curr.clone()
+	if newQ.CustomerID != "" {
+		curr.CustomerID = newQ.CustomerID
+	}
+	if newQ.Description != "" {
+		curr.Description = newQ.Description
+	}
+	if newQ.Items != nil {
+		curr.Items = newQ.Items
+	}
+	if newQ.ValidUntil != nil {
+		curr.ValidUntil = newQ.ValidUntil
+	}
+	if newQ.DeadlineDate != nil {
+		curr.DeadlineDate = newQ.DeadlineDate
+	}
+	if newQ.State != "" {
+		curr.State = newQ.State
+	}
+	if err := qs.validate(curr); err != nil {
+		return nil, err
+	}
+	curr.Totals = computeItems(curr.Items)
+	if err := qs.store.PutQuote(curr); err != nil {
+		return nil, err
+	}
+	recordChange(ctx, qs.audit, AuditEntityQuote, id, AuditActionUpdate, before, curr)
+	return curr, nil
+}
+
+// ConvertQuote creates a job for the customer of the quote id, with its
+// description and items, and marks the quote accepted. The job is due on
+// deadline, or on the deadline of the quote if it is nil. Declined and
+// expired quotes cannot be converted, and no quote is converted twice.
+func (qs *QuoteService) ConvertQuote(ctx context.Context, id string, deadline *time.Time) (*Job, error) {
+	qs.mu.Lock()
+	defer qs.mu.Unlock()
+	curr, err := qs.store.GetQuote(id)
+	if err != nil {
+		return nil, err
+	}
+	if curr.JobID != "" {
+		return nil, fmt.Errorf("quote %s was already converted into job %s: %w",
+			curr.Reference(), curr.JobID, ErrConflict)
+	}
+	verr := &ValidationError{Entity: AuditEntityQuote}
+	if curr.State == QuoteDeclined {
+		verr.add("state", "the quote was declined")
+	}
+	if curr.Expired(time.Now()) {
+		verr.add("valid_until", "the quote expired on %s", curr.ValidUntil.Format(JobsDateFormat))
+	}
+	if deadline == nil {
+		deadline = curr.DeadlineDate
+	}
+	if deadline == nil {
+		verr.add("deadline_date", "is required")
+	}
+	if len(JobStatusList) == 0 {
+		return nil, errors.New("there are no job statuses to start the job in")
+	}
+	if err := verr.err(); err != nil {
+		return nil, err
+	}
+
+	items := make([]*LineItem, len(curr.Items))
+	for i, li := range curr.Items {
+		item := *li
+		items[i] = &item
+	}
+	today := GetFormattedDate(time.Now().Format(JobsDateFormat))
+	j := &Job{
+		OrderDate:    today,
+		DeadlineDate: deadline,
+		Status:       JobStatusList[0].Key,
+		CustomerID:   curr.CustomerID,
+		Description:  curr.Description,
+		Items:        items,
+	}
+	if err := qs.jobs.AddJob(ctx, j); err != nil {
+		return nil, err
+	}
+
+	before := curr.clone()
+	curr.State = QuoteAccepted
+	curr.JobID = j.ID
+	if err := qs.store.PutQuote(curr); err != nil {
+		return nil, fmt.Errorf("job %s created but quote %s not marked converted: %w",
+			j.ID, curr.Reference(), err)
+	}
+	recordChange(ctx, qs.audit, AuditEntityQuote, id, AuditActionUpdate, before, curr)
+	return j, nil
+}
+
+func (qs *QuoteService) validate(q *Quote) error {
+	verr := &ValidationError{Entity: AuditEntityQuote}
+	if q.CustomerID == "" {
+		verr.add("customer_id", "is required")
+	} else if _, err := qs.customers.GetCustomer(q.CustomerID); errors.Is(err, ErrNotFound) {
+		verr.add("customer_id", "%s is not a known customer", q.CustomerID)
+	} else if err != nil {
+		return err
+	}
+	if q.ValidUntil == nil {
+		verr.add("valid_until", "is required")
+	}
+	switch q.State {
+	case QuoteOpen, QuoteAccepted, QuoteDeclined:
+	default:
+		verr.add("state", "%q is not one of %s, %s or %s", q.State, QuoteOpen, QuoteAccepted, QuoteDeclined)
+	}
+	validateItems(q.Items, verr)
+	return verr.err()
+}
+
+func (q *Quote) clone() *Quote {
+	c := *q
+	if q.Items != nil {
+		c.Items = make([]*LineItem, len(q.Items))
+		for i, li := range q.Items {
+			item := *li
+			c.Items[i] = &item
+		}
+	}
+	return &c
+}
@@ -1,8 +1,8 @@
 package jobs
 
 import (
-	"encoding/base64"
 	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"time"
@@ -38,14 +38,44 @@ func NewCustomersResponse(resp *http.Response) ([]*Customer, error) {
 	return bs, nil
 }
 
-func NewCustomerSearchResponse(resp *http.Response) (*Customer, error) {
+func NewAuditResponse(resp *http.Response) ([]*AuditEntry, error) {
 	body, err := io.ReadAll(resp.Body)
 	defer resp.Body.Close()
 	if err != nil {
 		return nil, err
 	}
 
-	var bs Customer
+	var bs []*AuditEntry
+	if err := json.Unmarshal(body, &bs); err != nil {
+		return nil, err
+	}
+
+	return bs, nil
+}
+
+func NewJobStatusesResponse(resp *http.Response) ([]*JobStatus, error) {
+	body, err := io.ReadAll(resp.Body)
+	defer resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	var bs []*JobStatus
+	if err := json.Unmarshal(body, &bs); err != nil {
+		return nil, err
+	}
+
+	return bs, nil
+}
+
+func NewInvoiceResponse(resp *http.Response) (*Invoice, error) {
+	body, err := io.ReadAll(resp.Body)
+	defer resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	var bs Invoice
 	if err := json.Unmarshal(body, &bs); err != nil {
 		return nil, err
 	}
@@ -53,6 +83,89 @@ func NewCustomerSearchResponse(resp *http.Response) (*Customer, error) {
 	return &bs, nil
 }
 
+func NewReceivablesResponse(resp *http.Response) ([]*CustomerBalance, error) {
+	body, err := io.ReadAll(resp.Body)
+	defer resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	var bs []*CustomerBalance
+	if err := json.Unmarshal(body, &bs); err != nil {
+		return nil, err
+	}
+
+	return bs, nil
+}
+
+func NewSearchResponse(resp *http.Response) ([]*SearchResult, error) {
+	body, err := io.ReadAll(resp.Body)
+	defer resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	var bs []*SearchResult
+	if err := json.Unmarshal(body, &bs); err != nil {
+		return nil, err
+	}
+
+	return bs, nil
+}
+
+func NewQuotesResponse(resp *http.Response) ([]*Quote, error) {
+	body, err := io.ReadAll(resp.Body)
+	defer resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	var bs []*Quote
+	if err := json.Unmarshal(body, &bs); err != nil {
+		return nil, err
+	}
+
+	return bs, nil
+}
+
+func NewCustomerInUseResponse(resp *http.Response) (*CustomerInUseError, error) {
+	body, err := io.ReadAll(resp.Body)
+	defer resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	var bs CustomerInUseError
+	if err := json.Unmarshal(body, &bs); err != nil {
+		return nil, err
+	}
+
+	return &bs, nil
+}
+
+// CheckResponse turns a failed request, or a response without the
+// expected status code, into an error carrying the server's message.
+func CheckResponse(resp *http.Response, err error, expected int) error {
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == expected {
+		return nil
+	}
+	body, err := io.ReadAll(resp.Body)
+	defer resp.Body.Close()
+	if err != nil {
+		return err
+	}
+	var msg struct {
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(body, &msg); err != nil || msg.Message == "" {
+		return fmt.Errorf("%s", resp.Status)
+	}
+	return fmt.Errorf("%s", msg.Message)
+}
+
 func NewJob(orderDate string, deadline string, status string,
 	customerID string, description string) *Job {
 	j := &Job{}
@@ -67,13 +180,13 @@ func NewJob(orderDate string, deadline string, status string,
 	}
 	j.Status = status
 	j.CustomerID = customerID
-	j.Description = base64.StdEncoding.EncodeToString([]byte(description))
+	j.Description = description
 	return j
 }
 
 func NewCustomer(name, note string) *Customer {
 	cust := &Customer{}
 	cust.Name = name
-	cust.Note = base64.StdEncoding.EncodeToString([]byte(note))
+	cust.Note = note
 	return cust
 }
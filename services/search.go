@@ -0,0 +1,386 @@
+package jobs
+
+import (
+	"html"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// The kinds of search results.
+const (
+	SearchKindJob      = "job"
+	SearchKindCustomer = "customer"
+)
+
+// SearchResult is a job or customer matching a search, best first.
+type SearchResult struct {
+	Kind  string `json:"kind"`
+	ID    string `json:"id"`
+	Title string `json:"title"`
+	// Snippet is the part of the text that matched, as HTML with
+	// the matching words in <mark> tags and everything else escaped.
+	Snippet string  `json:"snippet"`
+	Score   float64 `json:"score"`
+	// The job results also say who the job is for and where it is at.
+	CustomerID string     `json:"customer_id,omitempty"`
+	Status     string     `json:"status,omitempty"`
+	OrderDate  *time.Time `json:"order_date,omitempty"`
+}
+
+// searchField is text that can be searched. Matches
+// in fields with a higher weight rank higher.
+type searchField struct {
+	text   string
+	weight float64
+}
+
+// searchDoc is a job or customer in the search index.
+type searchDoc struct {
+	result *SearchResult
+	fields []searchField
+	// source is what the document was indexed from,
+	// to tell when it has to be indexed again.
+	source string
+}
+
+// SearchService searches the jobs and customers outside the trash. It
+// keeps an index of the words in their descriptions, line items,
+// names and notes, which is brought up to date before every search, so
+// that only the records that changed since are indexed again. Stores
+// that are a ChangeCounter are not even read unless they changed. It
+// is safe for concurrent use.
+type SearchService struct {
+	mu        sync.Mutex
+	jobs      JobStore
+	customers CustomerStore
+	docs      map[string]*searchDoc
+	// postings holds, for every word, the weighted number
+	// of times it is found in each document.
+	postings map[string]map[string]float64
+	// words are the keys of postings in order, or nil
+	// if they changed since they were last sorted.
+	words []string
+	// changes are the changes the job and customer stores counted
+	// when the index was last brought up to date, if they count them.
+	changes *[2]uint64
+}
+
+func NewSearchService(jobs JobStore, customers CustomerStore) *SearchService {
+	return &SearchService{
+		jobs:      jobs,
+		customers: customers,
+		docs:      make(map[string]*searchDoc),
+		postings:  make(map[string]map[string]float64),
+	}
+}
+
+// Search returns the limit best matches of query. Every word of the
+// query must be found, in full or as the start of a longer word.
+func (ss *SearchService) Search(query string, limit int) ([]*SearchResult, error) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	if err := ss.refresh(); err != nil {
+		return nil, err
+	}
+	terms := tokenize(query)
+	results := make([]*SearchResult, 0)
+	if len(terms) == 0 {
+		return results, nil
+	}
+	scores := make(map[string]float64)
+	for i, term := range terms {
+		termScores := make(map[string]float64)
+		for _, word := range ss.matchingWords(term) {
+			docs := ss.postings[word]
+			idf := math.Log(1 + float64(len(ss.docs))/float64(len(docs)))
+			if word != term {
+				// Whole words are better matches than prefixes.
+				idf /= 2
+			}
+			for key, tf := range docs {
+				termScores[key] += idf * tf / (tf + 1.2)
+			}
+		}
+		for key := range scores {
+			if _, ok := termScores[key]; !ok {
+				delete(scores, key)
+			}
+		}
+		for key, score := range termScores {
+			if _, ok := scores[key]; ok || i == 0 {
+				scores[key] += score
+			}
+		}
+	}
+
+	for key, score := range scores {
+		doc := ss.docs[key]
+		r := *doc.result
+		r.Score = math.Round(score*1000) / 1000
+		r.Snippet = doc.snippet(terms)
+		results = append(results, &r)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		ri, rj := results[i], results[j]
+		if ri.Score != rj.Score {
+			return ri.Score > rj.Score
+		}
+		if ri.OrderDate != nil && rj.OrderDate != nil && !ri.OrderDate.Equal(*rj.OrderDate) {
+			return ri.OrderDate.After(*rj.OrderDate)
+		}
+		return ri.Kind+ri.ID < rj.Kind+rj.ID
+	})
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+// matchingWords returns the indexed words that start with term.
+func (ss *SearchService) matchingWords(term string) []string {
+	if ss.words == nil {
+		ss.words = make([]string, 0, len(ss.postings))
+		for word := range ss.postings {
+			ss.words = append(ss.words, word)
+		}
+		sort.Strings(ss.words)
+	}
+	matching := make([]string, 0)
+	for i := sort.SearchStrings(ss.words, term); i < len(ss.words); i++ {
+		if !strings.HasPrefix(ss.words[i], term) {
+			break
+		}
+		matching = append(matching, ss.words[i])
+	}
+	return matching
+}
+
+// refresh brings the index up to date with the stores.
+func (ss *SearchService) refresh() error {
+	changes := ss.countChanges()
+	if changes != nil && ss.changes != nil && *changes == *ss.changes {
+		return nil
+	}
+	customers, err := ss.customers.ListCustomers()
+	if err != nil {
+		return err
+	}
+	jobsList, err := ss.jobs.ListJobs()
+	if err != nil {
+		return err
+	}
+	current := make(map[string]*searchDoc)
+	names := make(map[string]string)
+	for _, c := range customers {
+		names[c.ID] = c.Name
+		if c.DeletedAt != nil {
+			continue
+		}
+		current[SearchKindCustomer+"/"+c.ID] = &searchDoc{
+			result: &SearchResult{Kind: SearchKindCustomer, ID: c.ID, Title: c.Name},
+			fields: []searchField{{c.Name, 3}, {c.Note, 1}},
+			source: c.Name + "\x00" + c.Note,
+		}
+	}
+	for _, j := range jobsList {
+		if j.DeletedAt != nil {
+			continue
+		}
+		items := make([]string, len(j.Items))
+		for i, li := range j.Items {
+			items[i] = li.Description
+		}
+		title := "Job without a customer"
+		if name, ok := names[j.CustomerID]; ok {
+			title = "Job for " + name
+		}
+		current[SearchKindJob+"/"+j.ID] = &searchDoc{
+			result: &SearchResult{
+				Kind:       SearchKindJob,
+				ID:         j.ID,
+				Title:      title,
+				CustomerID: j.CustomerID,
+				Status:     j.Status,
+				OrderDate:  j.OrderDate,
+			},
+			fields: []searchField{{j.Description, 2}, {strings.Join(items, "\n"), 1.5}, {names[j.CustomerID], 1}},
+			source: strings.Join(append([]string{title, j.Status, j.Description}, items...), "\x00"),
+		}
+	}
+
+	for key, doc := range ss.docs {
+		if next, ok := current[key]; !ok || next.source != doc.source {
+			ss.remove(key, doc)
+		}
+	}
+	for key, doc := range current {
+		if old, ok := ss.docs[key]; ok {
+			// The text is the same, but the dates may not be.
+			old.result = doc.result
+			continue
+		}
+		ss.add(key, doc)
+	}
+	ss.changes = changes
+	return nil
+}
+
+// countChanges returns the changes counted by the job and
+// customer stores, or nil if either does not count them.
+func (ss *SearchService) countChanges() *[2]uint64 {
+	jobs, ok := ss.jobs.(ChangeCounter)
+	if !ok {
+		return nil
+	}
+	customers, ok := ss.customers.(ChangeCounter)
+	if !ok {
+		return nil
+	}
+	return &[2]uint64{jobs.Changes(), customers.Changes()}
+}
+
+func (ss *SearchService) add(key string, doc *searchDoc) {
+	ss.docs[key] = doc
+	for _, f := range doc.fields {
+		for _, word := range tokenize(f.text) {
+			if ss.postings[word] == nil {
+				ss.postings[word] = make(map[string]float64)
+				ss.words = nil
+			}
+			ss.postings[word][key] += f.weight
+		}
+	}
+}
+
+func (ss *SearchService) remove(key string, doc *searchDoc) {
+	delete(ss.docs, key)
+	for _, f := range doc.fields {
+		for _, word := range tokenize(f.text) {
+			delete(ss.postings[word], key)
+			if len(ss.postings[word]) == 0 {
+				delete(ss.postings, word)
+				ss.words = nil
+			}
+		}
+	}
+}
+
+// snippetLength is about how many bytes of text a snippet shows.
+const snippetLength = 160
+
+// snippet returns the part of the best matching field of doc around
+// the first word that starts with one of terms, with the words that
+// do highlighted.
+func (doc *searchDoc) snippet(terms []string) string {
+	matches := func(word string) bool {
+		word = strings.ToLower(word)
+		for _, t := range terms {
+			if strings.HasPrefix(word, t) {
+				return true
+			}
+		}
+		return false
+	}
+	var text string
+	var spans [][2]int
+	best := -1
+	for _, f := range doc.fields {
+		fieldSpans := wordSpans(f.text)
+		hits := 0
+		for _, s := range fieldSpans {
+			if matches(f.text[s[0]:s[1]]) {
+				hits++
+			}
+		}
+		if hits > best {
+			text, spans, best = f.text, fieldSpans, hits
+		}
+	}
+
+	first := 0
+	for i, s := range spans {
+		if matches(text[s[0]:s[1]]) {
+			first = i
+			break
+		}
+	}
+	// Show a few words before the first match.
+	start, end := 0, len(text)
+	if len(spans) > 0 {
+		start = spans[first][0]
+		for i := first - 1; i >= 0 && spans[first][0]-spans[i][0] <= snippetLength/4; i-- {
+			start = spans[i][0]
+		}
+		if first == 0 || start == spans[0][0] {
+			start = 0
+		}
+	}
+	if end-start > snippetLength {
+		// Stop at the next space, stepping over whole runes so that
+		// the text is not cut in the middle of one.
+		for end = start + snippetLength; end < len(text); {
+			r, size := utf8.DecodeRuneInString(text[end:])
+			if unicode.IsSpace(r) {
+				break
+			}
+			end += size
+		}
+	}
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	}
+	pos := start
+	for _, s := range spans {
+		if s[0] < start || s[1] > end || !matches(text[s[0]:s[1]]) {
+			continue
+		}
+		b.WriteString(html.EscapeString(text[pos:s[0]]))
+		b.WriteString("<mark>" + html.EscapeString(text[s[0]:s[1]]) + "</mark>")
+		pos = s[1]
+	}
+	b.WriteString(html.EscapeString(text[pos:end]))
+	if end < len(text) {
+		b.WriteString("…")
+	}
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+// tokenize returns the words of s in lower case.
+func tokenize(s string) []string {
+	spans := wordSpans(s)
+	words := make([]string, len(spans))
+	for i, span := range spans {
+		words[i] = strings.ToLower(s[span[0]:span[1]])
+	}
+	return words
+}
+
+// wordSpans returns where the words of s, which are runs
+// of letters and digits, start and end in bytes.
+func wordSpans(s string) [][2]int {
+	spans := make([][2]int, 0)
+	start := -1
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		inWord := unicode.IsLetter(r) || unicode.IsDigit(r)
+		if inWord && start < 0 {
+			start = i
+		}
+		if !inWord && start >= 0 {
+			spans = append(spans, [2]int{start, i})
+			start = -1
+		}
+		i += size
+	}
+	if start >= 0 {
+		spans = append(spans, [2]int{start, len(s)})
+	}
+	return spans
+}
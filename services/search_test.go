@@ -0,0 +1,23 @@
+package jobs
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSnippetKeepsRunesWhole(t *testing.T) {
+	// à is encoded as 0xC3 0xA0, and 0xA0 on its own
+	// is a no-break space.
+	for offset := 0; offset < 4; offset++ {
+		text := "cable " + strings.Repeat("x", offset) + strings.Repeat("à", snippetLength)
+		doc := &searchDoc{fields: []searchField{{text: text, weight: 1}}}
+		got := doc.snippet([]string{"cable"})
+		if !utf8.ValidString(got) {
+			t.Errorf("snippet of %d bytes is not valid UTF-8: %q", len(got), got)
+		}
+		if !strings.HasPrefix(got, "<mark>cable</mark>") {
+			t.Errorf("snippet %q does not start with the match", got)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package sqlite
+
+import (
+	"database/sql/driver"
+	"strings"
+	"time"
+
+	jobs "github.com/addetz/order-manager/services"
+	"modernc.org/sqlite"
+)
+
+func init() {
+	// The lower function of SQLite only knows ASCII, and jobs are
+	// sorted and searched by what strings.ToLower makes of the text.
+	sqlite.MustRegisterDeterministicScalarFunction("go_lower", 1,
+		func(ctx *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+			s, ok := args[0].(string)
+			if !ok {
+				return args[0], nil
+			}
+			return strings.ToLower(s), nil
+		})
+}
+
+// QueryJobs finds the jobs of q with the indexes on the job columns,
+// and sorts and pages them in the database by the parts of their sort
+// keys, which are worked out in SQL like JobQuery works them out in Go.
+func (s *Store) QueryJobs(q *jobs.JobQuery, after []string, today time.Time) (*jobs.JobPage, error) {
+	from := " FROM jobs LEFT JOIN customers ON customers.id = jobs.customer_id"
+	where, whereArgs := jobFilter(q, today)
+	page := &jobs.JobPage{Jobs: make([]*jobs.Job, 0)}
+	err := s.db.QueryRow("SELECT count(*)"+from+" WHERE "+where, whereArgs...).Scan(&page.Total)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, args := jobSortKeys(q.Sort)
+	query := "SELECT data FROM (SELECT jobs.id AS id, jobs.data AS data, " + keys + from + " WHERE " + where + ")"
+	args = append(args, whereArgs...)
+	order, compare := "", ">"
+	if q.Desc {
+		order, compare = " DESC", "<"
+	}
+	if after != nil {
+		query += " WHERE (sort_key, status_key, deadline_key, id) " + compare + " (?, ?, ?, ?)"
+		for _, part := range after {
+			args = append(args, part)
+		}
+	}
+	query += " ORDER BY sort_key" + order + ", status_key" + order + ", deadline_key" + order + ", id" + order
+	limit := -1
+	if q.Limit > 0 {
+		limit = q.Limit
+	}
+	query += " LIMIT ? OFFSET ?"
+	args = append(args, limit, q.Offset)
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		j := &jobs.Job{}
+		if err := scanData(rows, j); err != nil {
+			return nil, err
+		}
+		page.Jobs = append(page.Jobs, j)
+	}
+	return page, rows.Err()
+}
+
+// ListCustomerJobs returns the jobs of the customer customerID,
+// including the ones in the trash.
+func (s *Store) ListCustomerJobs(customerID string) ([]*jobs.Job, error) {
+	rows, err := s.db.Query("SELECT data FROM jobs WHERE customer_id = ?", customerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	jobsList := make([]*jobs.Job, 0)
+	for rows.Next() {
+		j := &jobs.Job{}
+		if err := scanData(rows, j); err != nil {
+			return nil, err
+		}
+		jobsList = append(jobsList, j)
+	}
+	return jobsList, rows.Err()
+}
+
+// jobFilter returns the condition that the jobs of q meet on
+// the day today, and its arguments.
+func jobFilter(q *jobs.JobQuery, today time.Time) (string, []any) {
+	conds := []string{"json_extract(jobs.data, '$.deleted_at') IS NULL"}
+	args := make([]any, 0)
+	switch q.CustomerID {
+	case "":
+	case jobs.NoCustomer:
+		conds = append(conds, "jobs.customer_id = ''")
+	default:
+		conds = append(conds, "jobs.customer_id = ?")
+		args = append(args, q.CustomerID)
+	}
+	if len(q.Statuses) > 0 {
+		conds = append(conds, "jobs.status IN ("+placeholders(len(q.Statuses))+")")
+		for _, status := range q.Statuses {
+			args = append(args, status)
+		}
+	}
+	for _, r := range []struct {
+		column string
+		day    *time.Time
+		op     string
+	}{
+		{"order_date", q.OrderedFrom, ">="},
+		{"order_date", q.OrderedTo, "<="},
+		{"deadline_date", q.DueFrom, ">="},
+		{"deadline_date", q.DueTo, "<="},
+	} {
+		if r.day != nil {
+			conds = append(conds, "jobs."+r.column+" "+r.op+" ?")
+			args = append(args, formatDate(r.day))
+		}
+	}
+	if q.Overdue {
+		if terminal := statusKeys(true); len(terminal) > 0 {
+			conds = append(conds, "jobs.status NOT IN ("+placeholders(len(terminal))+")")
+			args = append(args, terminal...)
+		}
+		conds = append(conds, "jobs.deadline_date < ?")
+		args = append(args, formatDate(&today))
+	}
+	if q.Text != "" {
+		conds = append(conds, `instr(go_lower(COALESCE(customers.name, '') || char(10) ||
+			COALESCE(json_extract(jobs.data, '$.description'), '') ||
+			COALESCE((SELECT group_concat(char(10) || COALESCE(json_extract(value, '$.description'), ''), '')
+				FROM json_each(jobs.data, '$.items')), '')), ?) > 0`)
+		args = append(args, strings.ToLower(q.Text))
+	}
+	return strings.Join(conds, " AND "), args
+}
+
+// totalSortKey writes the total out like JobQuery does, as the 20 digits
+// of the total with its sign bit flipped. Totals of 0 and more take more
+// than 63 bits then, so their digits are added up in two halves.
+const totalSortKey = `CASE WHEN total < 0 THEN printf('%020d', 9223372036854775807 + total + 1)
+	ELSE printf('%010d%010d',
+		922337203 + total / 10000000000 + (6854775808 + total % 10000000000) / 10000000000,
+		(6854775808 + total % 10000000000) % 10000000000) END`
+
+// jobSortKeys returns the columns sort_key, status_key and deadline_key
+// holding the parts of the sort keys of the jobs sorted by sortBy,
+// and their arguments.
+func jobSortKeys(sortBy string) (string, []any) {
+	statusKey, statusArgs := statusSortKey()
+	var key string
+	var args []any
+	switch sortBy {
+	case jobs.SortByOrderDate:
+		key = "COALESCE(replace(jobs.order_date, '-', ''), '00000000')"
+	case jobs.SortByDeadline:
+		key = "COALESCE(replace(jobs.deadline_date, '-', ''), '00000000')"
+	case jobs.SortByStatus:
+		key, args = statusKey, statusArgs
+	case jobs.SortByCustomer:
+		key = "go_lower(COALESCE(customers.name, ''))"
+	case jobs.SortByTotal:
+		key = strings.ReplaceAll(totalSortKey, "total", "COALESCE(json_extract(jobs.data, '$.totals.total'), 0)")
+	default:
+		key = "''"
+	}
+	args = append(args, statusArgs...)
+
+	// Like sortJobs, unfinished jobs are sorted by deadline, latest first.
+	deadlineKey := "'00000000'"
+	if unfinished := statusKeys(false); len(unfinished) > 0 {
+		deadlineKey = "CASE WHEN jobs.status IN (" + placeholders(len(unfinished)) + `) AND jobs.deadline_date IS NOT NULL
+			THEN printf('%08d', 99999999 - CAST(replace(jobs.deadline_date, '-', '') AS INTEGER))
+			ELSE '00000000' END`
+		args = append(args, unfinished...)
+	}
+	return key + " AS sort_key, " + statusKey + " AS status_key, " + deadlineKey + " AS deadline_key", args
+}
+
+// statusSortKey returns the expression that sorts the statuses of jobs
+// in workflow order, with the ones no longer configured last, and its
+// arguments.
+func statusSortKey() (string, []any) {
+	if len(jobs.JobStatusList) == 0 {
+		return "printf('%05d', 0)", nil
+	}
+	var b strings.Builder
+	args := make([]any, 0, 2*len(jobs.JobStatusList)+1)
+	b.WriteString("printf('%05d', CASE jobs.status")
+	for i, s := range jobs.JobStatusList {
+		b.WriteString(" WHEN ? THEN ?")
+		args = append(args, s.Key, i)
+	}
+	b.WriteString(" ELSE ? END)")
+	args = append(args, len(jobs.JobStatusList))
+	return b.String(), args
+}
+
+// statusKeys returns the keys of the terminal statuses,
+// or of the others if terminal is false.
+func statusKeys(terminal bool) []any {
+	keys := make([]any, 0)
+	for _, s := range jobs.JobStatusList {
+		if jobs.GetJobStatus(s.Key).Terminal == terminal {
+			keys = append(keys, s.Key)
+		}
+	}
+	return keys
+}
+
+// placeholders returns n comma separated placeholders.
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
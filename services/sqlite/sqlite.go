@@ -0,0 +1,696 @@
+// Package sqlite implements the jobs.Store interface on top of an embedded
+// SQLite database using a pure Go driver.
+//
+// Every record is kept as a JSON document in the data column, alongside
+// the handful of columns we filter and sort on so they can be indexed.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	jobs "github.com/addetz/order-manager/services"
+	_ "modernc.org/sqlite"
+)
+
+const JOBS_MANAGER_DB_FILE = "jobsManager.db"
+
+const schema = `
+CREATE TABLE IF NOT EXISTS jobs (
+	id            TEXT PRIMARY KEY,
+	customer_id   TEXT NOT NULL DEFAULT '',
+	status        TEXT NOT NULL DEFAULT '',
+	order_date    TEXT,
+	deadline_date TEXT,
+	data          TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS jobs_customer_id ON jobs (customer_id);
+CREATE INDEX IF NOT EXISTS jobs_status ON jobs (status);
+CREATE INDEX IF NOT EXISTS jobs_deadline_date ON jobs (deadline_date);
+
+CREATE TABLE IF NOT EXISTS customers (
+	id   TEXT PRIMARY KEY,
+	name TEXT NOT NULL DEFAULT '',
+	data TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS invoices (
+	id          TEXT PRIMARY KEY,
+	number      INTEGER NOT NULL UNIQUE,
+	customer_id TEXT NOT NULL DEFAULT '',
+	data        TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS invoices_customer_id ON invoices (customer_id);
+
+CREATE TABLE IF NOT EXISTS payments (
+	id          TEXT PRIMARY KEY,
+	invoice_id  TEXT NOT NULL DEFAULT '',
+	customer_id TEXT NOT NULL DEFAULT '',
+	data        TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS payments_invoice_id ON payments (invoice_id);
+CREATE INDEX IF NOT EXISTS payments_customer_id ON payments (customer_id);
+
+CREATE TABLE IF NOT EXISTS quotes (
+	id          TEXT PRIMARY KEY,
+	number      INTEGER NOT NULL UNIQUE,
+	customer_id TEXT NOT NULL DEFAULT '',
+	state       TEXT NOT NULL DEFAULT '',
+	data        TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS quotes_customer_id ON quotes (customer_id);
+
+CREATE TABLE IF NOT EXISTS meta (
+	key   TEXT PRIMARY KEY,
+	value TEXT NOT NULL
+);
+`
+
+// Store is a jobs.Store backed by SQLite. It is meant to be the only
+// writer of its database, so that it can count the changes made to it.
+type Store struct {
+	db      *sql.DB
+	changes atomic.Uint64
+}
+
+var (
+	_ jobs.Store         = (*Store)(nil)
+	_ jobs.JobQuerier    = (*Store)(nil)
+	_ jobs.ChangeCounter = (*Store)(nil)
+)
+
+// Open opens, and creates if needed, the database at path.
+func Open(path string) (*Store, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite only allows a single writer, so don't pretend otherwise.
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("creating schema: %w", err)
+	}
+	if err := migrate(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("migrating: %w", err)
+	}
+	return &Store{db: db}, nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Changes returns how many times the data was written to.
+func (s *Store) Changes() uint64 {
+	return s.changes.Load()
+}
+
+func (s *Store) GetJob(id string) (*jobs.Job, error) {
+	j := &jobs.Job{}
+	if err := s.get("jobs", id, j); err != nil {
+		if errors.Is(err, jobs.ErrNotFound) {
+			return nil, fmt.Errorf("job %s %w", id, jobs.ErrNotFound)
+		}
+		return nil, err
+	}
+	return j, nil
+}
+
+func (s *Store) ListJobs() ([]*jobs.Job, error) {
+	rows, err := s.db.Query("SELECT data FROM jobs")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	jobsList := make([]*jobs.Job, 0)
+	for rows.Next() {
+		j := &jobs.Job{}
+		if err := scanData(rows, j); err != nil {
+			return nil, err
+		}
+		jobsList = append(jobsList, j)
+	}
+	return jobsList, rows.Err()
+}
+
+func (s *Store) PutJob(j *jobs.Job) error {
+	defer s.changes.Add(1)
+	return putJob(s.db, j)
+}
+
+// PutJobs saves all of jobsList in one transaction.
+func (s *Store) PutJobs(jobsList []*jobs.Job) (err error) {
+	defer s.changes.Add(1)
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+	for _, j := range jobsList {
+		if err = putJob(tx, j); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *Store) DeleteJob(id string) error {
+	defer s.changes.Add(1)
+	if err := s.delete("jobs", id); err != nil {
+		if errors.Is(err, jobs.ErrNotFound) {
+			return fmt.Errorf("job %s %w", id, jobs.ErrNotFound)
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *Store) GetCustomer(id string) (*jobs.Customer, error) {
+	c := &jobs.Customer{}
+	if err := s.get("customers", id, c); err != nil {
+		if errors.Is(err, jobs.ErrNotFound) {
+			return nil, fmt.Errorf("customer %s %w", id, jobs.ErrNotFound)
+		}
+		return nil, err
+	}
+	return c, nil
+}
+
+func (s *Store) ListCustomers() ([]*jobs.Customer, error) {
+	rows, err := s.db.Query("SELECT data FROM customers")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	csList := make([]*jobs.Customer, 0)
+	for rows.Next() {
+		c := &jobs.Customer{}
+		if err := scanData(rows, c); err != nil {
+			return nil, err
+		}
+		csList = append(csList, c)
+	}
+	return csList, rows.Err()
+}
+
+func (s *Store) PutCustomer(c *jobs.Customer) error {
+	defer s.changes.Add(1)
+	return putCustomer(s.db, c)
+}
+
+// PutCustomers saves all of csList in one transaction.
+func (s *Store) PutCustomers(csList []*jobs.Customer) (err error) {
+	defer s.changes.Add(1)
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+	for _, c := range csList {
+		if err = putCustomer(tx, c); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *Store) DeleteCustomer(id string) error {
+	defer s.changes.Add(1)
+	if err := s.delete("customers", id); err != nil {
+		if errors.Is(err, jobs.ErrNotFound) {
+			return fmt.Errorf("customer %s %w", id, jobs.ErrNotFound)
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *Store) GetInvoice(id string) (*jobs.Invoice, error) {
+	inv := &jobs.Invoice{}
+	if err := s.get("invoices", id, inv); err != nil {
+		if errors.Is(err, jobs.ErrNotFound) {
+			return nil, fmt.Errorf("invoice %s %w", id, jobs.ErrNotFound)
+		}
+		return nil, err
+	}
+	return inv, nil
+}
+
+func (s *Store) ListInvoices() ([]*jobs.Invoice, error) {
+	rows, err := s.db.Query("SELECT data FROM invoices ORDER BY number")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	invList := make([]*jobs.Invoice, 0)
+	for rows.Next() {
+		inv := &jobs.Invoice{}
+		if err := scanData(rows, inv); err != nil {
+			return nil, err
+		}
+		invList = append(invList, inv)
+	}
+	return invList, rows.Err()
+}
+
+func (s *Store) PutInvoice(inv *jobs.Invoice) error {
+	defer s.changes.Add(1)
+	return putInvoice(s.db, inv)
+}
+
+func (s *Store) GetPayment(id string) (*jobs.Payment, error) {
+	p := &jobs.Payment{}
+	if err := s.get("payments", id, p); err != nil {
+		if errors.Is(err, jobs.ErrNotFound) {
+			return nil, fmt.Errorf("payment %s %w", id, jobs.ErrNotFound)
+		}
+		return nil, err
+	}
+	return p, nil
+}
+
+func (s *Store) ListPayments() ([]*jobs.Payment, error) {
+	rows, err := s.db.Query("SELECT data FROM payments")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	payList := make([]*jobs.Payment, 0)
+	for rows.Next() {
+		p := &jobs.Payment{}
+		if err := scanData(rows, p); err != nil {
+			return nil, err
+		}
+		payList = append(payList, p)
+	}
+	return payList, rows.Err()
+}
+
+func (s *Store) PutPayment(p *jobs.Payment) error {
+	defer s.changes.Add(1)
+	return putPayment(s.db, p)
+}
+
+func (s *Store) DeletePayment(id string) error {
+	defer s.changes.Add(1)
+	if err := s.delete("payments", id); err != nil {
+		if errors.Is(err, jobs.ErrNotFound) {
+			return fmt.Errorf("payment %s %w", id, jobs.ErrNotFound)
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *Store) GetQuote(id string) (*jobs.Quote, error) {
+	q := &jobs.Quote{}
+	if err := s.get("quotes", id, q); err != nil {
+		if errors.Is(err, jobs.ErrNotFound) {
+			return nil, fmt.Errorf("quote %s %w", id, jobs.ErrNotFound)
+		}
+		return nil, err
+	}
+	return q, nil
+}
+
+func (s *Store) ListQuotes() ([]*jobs.Quote, error) {
+	rows, err := s.db.Query("SELECT data FROM quotes ORDER BY number")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	qList := make([]*jobs.Quote, 0)
+	for rows.Next() {
+		q := &jobs.Quote{}
+		if err := scanData(rows, q); err != nil {
+			return nil, err
+		}
+		qList = append(qList, q)
+	}
+	return qList, rows.Err()
+}
+
+func (s *Store) PutQuote(q *jobs.Quote) error {
+	defer s.changes.Add(1)
+	return putQuote(s.db, q)
+}
+
+// tables lists the tables holding data, as opposed to bookkeeping.
+var tables = []string{"jobs", "customers", "invoices", "payments", "quotes"}
+
+// Snapshot copies the database into dir.
+func (s *Store) Snapshot(dir string) error {
+	_, err := s.db.Exec("VACUUM INTO ?", filepath.Join(dir, JOBS_MANAGER_DB_FILE))
+	return err
+}
+
+// Restore replaces all the data with the data in the
+// database previously copied into dir by Snapshot.
+func (s *Store) Restore(dir string) (err error) {
+	defer s.changes.Add(1)
+	ctx := context.Background()
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// ATTACH is not allowed inside a transaction.
+	snapshot := filepath.Join(dir, JOBS_MANAGER_DB_FILE)
+	if _, err := os.Stat(snapshot); err != nil {
+		return err
+	}
+	if _, err := conn.ExecContext(ctx, "ATTACH DATABASE ? AS snapshot", snapshot); err != nil {
+		return err
+	}
+	defer conn.ExecContext(ctx, "DETACH DATABASE snapshot")
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+	for _, table := range tables {
+		if _, err = tx.Exec(fmt.Sprintf("DELETE FROM main.%s", table)); err != nil {
+			return err
+		}
+		// Snapshots taken by older builds may not have all the tables.
+		var n int
+		err = tx.QueryRow("SELECT count(*) FROM snapshot.sqlite_master WHERE type = 'table' AND name = ?", table).Scan(&n)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			continue
+		}
+		if _, err = tx.Exec(fmt.Sprintf("INSERT INTO main.%[1]s SELECT * FROM snapshot.%[1]s", table)); err != nil {
+			return err
+		}
+	}
+	// The snapshot may have been taken by an older build,
+	// before descriptions and notes were stored as plain text.
+	var plain int
+	err = tx.QueryRow("SELECT count(*) FROM snapshot.sqlite_master WHERE type = 'table' AND name = 'meta'").Scan(&plain)
+	if err != nil {
+		return err
+	}
+	if plain > 0 {
+		err = tx.QueryRow("SELECT count(*) FROM snapshot.meta WHERE key = ?", plainTextKey).Scan(&plain)
+		if err != nil {
+			return err
+		}
+	}
+	if plain == 0 {
+		if _, err = tx.Exec("DELETE FROM main.meta WHERE key = ?", plainTextKey); err != nil {
+			return err
+		}
+	}
+	if err = migrate(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ImportJSON copies the jobs and customers from the JSON data files in
+// filepath into the database. It only ever runs once per database, so
+// it is safe to call on every start.
+func (s *Store) ImportJSON(filepath string) (err error) {
+	var done string
+	err = s.db.QueryRow("SELECT value FROM meta WHERE key = 'json_imported'").Scan(&done)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	data, err := jobs.ReadJSONFiles(filepath)
+	if err != nil {
+		return err
+	}
+	defer s.changes.Add(1)
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+	for _, c := range data.Customers {
+		if err = putCustomer(tx, c); err != nil {
+			return err
+		}
+	}
+	for _, j := range data.Jobs {
+		if err = putJob(tx, j); err != nil {
+			return err
+		}
+	}
+	for _, inv := range data.Invoices {
+		if err = putInvoice(tx, inv); err != nil {
+			return err
+		}
+	}
+	for _, p := range data.Payments {
+		if err = putPayment(tx, p); err != nil {
+			return err
+		}
+	}
+	for _, q := range data.Quotes {
+		if err = putQuote(tx, q); err != nil {
+			return err
+		}
+	}
+	_, err = tx.Exec("INSERT INTO meta (key, value) VALUES ('json_imported', ?)",
+		time.Now().Format(time.RFC3339))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// migrate brings the records in db up to date with the ones written
+// by this build, like the migrations of the JSON data files do.
+func migrate(db querier) error {
+	for label, key := range jobs.LegacyJobStatuses {
+		_, err := db.Exec(`UPDATE jobs SET status = ?, data = json_set(data, '$.status', ?)
+			WHERE status = ?`, key, key, label)
+		if err != nil {
+			return err
+		}
+	}
+	_, err := db.Exec(`UPDATE jobs
+		SET data = json_set(data, '$.entered_status_at',
+			json_object(CASE status WHEN '' THEN ? ELSE status END, json_extract(data, '$.order_date')))
+		WHERE json_extract(data, '$.entered_status_at') IS NULL
+			AND json_extract(data, '$.order_date') IS NOT NULL`, jobs.JobStatusList[0].Key)
+	if err != nil {
+		return err
+	}
+	return migratePlainText(db)
+}
+
+// plainTextKey is set in the meta table once the descriptions and
+// notes are stored as plain text rather than base64.
+const plainTextKey = "plain_text"
+
+// plainTextFields are the fields that used to be stored base64 encoded.
+var plainTextFields = []struct{ table, field string }{
+	{"jobs", "description"},
+	{"customers", "note"},
+	{"quotes", "description"},
+}
+
+// migratePlainText decodes the base64 encoded descriptions and notes.
+// It only runs once, as plain text can look like base64 too.
+func migratePlainText(db querier) error {
+	var done int
+	if err := db.QueryRow("SELECT count(*) FROM meta WHERE key = ?", plainTextKey).Scan(&done); err != nil {
+		return err
+	}
+	if done > 0 {
+		return nil
+	}
+	for _, f := range plainTextFields {
+		rows, err := db.Query(fmt.Sprintf("SELECT id, json_extract(data, '$.%s') FROM %s", f.field, f.table))
+		if err != nil {
+			return err
+		}
+		// The rows have to be closed before updating,
+		// as there is only the one connection.
+		decoded := make(map[string]string)
+		for rows.Next() {
+			var id string
+			var value sql.NullString
+			if err := rows.Scan(&id, &value); err != nil {
+				rows.Close()
+				return err
+			}
+			if text, ok := jobs.DecodeBase64Text(value.String); ok {
+				decoded[id] = text
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		for id, text := range decoded {
+			_, err := db.Exec(fmt.Sprintf("UPDATE %s SET data = json_set(data, '$.%s', ?) WHERE id = ?", f.table, f.field), text, id)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	_, err := db.Exec("INSERT INTO meta (key, value) VALUES (?, ?)", plainTextKey, time.Now().Format(time.RFC3339))
+	return err
+}
+
+// execer is satisfied by both *sql.DB and *sql.Tx.
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// querier is satisfied by both *sql.DB and *sql.Tx.
+type querier interface {
+	execer
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+func putJob(db execer, j *jobs.Job) error {
+	data, err := json.Marshal(j)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`INSERT INTO jobs (id, customer_id, status, order_date, deadline_date, data)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET
+			customer_id = excluded.customer_id,
+			status = excluded.status,
+			order_date = excluded.order_date,
+			deadline_date = excluded.deadline_date,
+			data = excluded.data`,
+		j.ID, j.CustomerID, j.Status, formatDate(j.OrderDate), formatDate(j.DeadlineDate), string(data))
+	return err
+}
+
+func putCustomer(db execer, c *jobs.Customer) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`INSERT INTO customers (id, name, data) VALUES (?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET name = excluded.name, data = excluded.data`,
+		c.ID, c.Name, string(data))
+	return err
+}
+
+func putInvoice(db execer, inv *jobs.Invoice) error {
+	data, err := json.Marshal(inv)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`INSERT INTO invoices (id, number, customer_id, data) VALUES (?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET
+			number = excluded.number,
+			customer_id = excluded.customer_id,
+			data = excluded.data`,
+		inv.ID, inv.Number, inv.CustomerID, string(data))
+	return err
+}
+
+func putPayment(db execer, p *jobs.Payment) error {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`INSERT INTO payments (id, invoice_id, customer_id, data) VALUES (?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET
+			invoice_id = excluded.invoice_id,
+			customer_id = excluded.customer_id,
+			data = excluded.data`,
+		p.ID, p.InvoiceID, p.CustomerID, string(data))
+	return err
+}
+
+func putQuote(db execer, q *jobs.Quote) error {
+	data, err := json.Marshal(q)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`INSERT INTO quotes (id, number, customer_id, state, data) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET
+			number = excluded.number,
+			customer_id = excluded.customer_id,
+			state = excluded.state,
+			data = excluded.data`,
+		q.ID, q.Number, q.CustomerID, q.State, string(data))
+	return err
+}
+
+func (s *Store) get(table, id string, v any) error {
+	var data string
+	err := s.db.QueryRow(fmt.Sprintf("SELECT data FROM %s WHERE id = ?", table), id).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return jobs.ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(data), v)
+}
+
+func (s *Store) delete(table, id string) error {
+	res, err := s.db.Exec(fmt.Sprintf("DELETE FROM %s WHERE id = ?", table), id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return jobs.ErrNotFound
+	}
+	return nil
+}
+
+func scanData(rows *sql.Rows, v any) error {
+	var data string
+	if err := rows.Scan(&data); err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(data), v)
+}
+
+// formatDate stores dates as sortable strings so the indexes are useful.
+func formatDate(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+	return t.Format(jobs.JobsDateFormat)
+}
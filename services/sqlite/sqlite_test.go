@@ -0,0 +1,216 @@
+package sqlite
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	jobs "github.com/addetz/order-manager/services"
+)
+
+// testJobs returns jobs and customers with all sorts of the values
+// jobs are filtered and sorted by, including missing ones.
+func testJobs() ([]*jobs.Job, []*jobs.Customer) {
+	customers := []*jobs.Customer{
+		{ID: "c1", Name: "Acme"},
+		{ID: "c2", Name: "Österreich Kabel"},
+		{ID: "c3", Name: "beta"},
+	}
+	deleted := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	customers[2].DeletedAt = &deleted
+
+	statuses := []string{"new", "in_progress", "shipped", "paid", "cancelled", "retired"}
+	customerIDs := []string{"c1", "c2", "c3", ""}
+	descriptions := []string{"Cables", "ÖL filters", "XLR plugs", ""}
+	jobsList := make([]*jobs.Job, 0)
+	for i := 0; i < 60; i++ {
+		j := &jobs.Job{
+			ID:          fmt.Sprintf("j%02d", (i*7)%60),
+			OrderDate:   jobs.GetFormattedDate(fmt.Sprintf("2024-03-%02d", 1+i%5)),
+			Status:      statuses[i%len(statuses)],
+			CustomerID:  customerIDs[i%len(customerIDs)],
+			Description: descriptions[i%len(descriptions)],
+		}
+		if i%4 != 0 {
+			j.DeadlineDate = jobs.GetFormattedDate(fmt.Sprintf("2024-04-%02d", 1+i%9))
+		}
+		if i%3 == 0 {
+			j.Items = []*jobs.LineItem{{Description: "Käbel", Quantity: 1, UnitPrice: 100}}
+		}
+		j.Totals.Total = int64((i%11 - 5) * 1000)
+		if i%17 == 0 {
+			j.DeletedAt = &deleted
+		}
+		jobsList = append(jobsList, j)
+	}
+	return jobsList, customers
+}
+
+// openTestServices returns job services for a MemoryStore and a
+// database holding the same testJobs.
+func openTestServices(t *testing.T) (memory, database *jobs.JobService) {
+	db, err := Open(filepath.Join(t.TempDir(), JOBS_MANAGER_DB_FILE))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	ms := jobs.NewMemoryStore()
+	jobsList, customers := testJobs()
+	for _, s := range []jobs.Store{db, ms} {
+		if err := s.PutCustomers(customers); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.PutJobs(jobsList); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return jobs.NewJobService(ms, ms, nil), jobs.NewJobService(db, db, nil)
+}
+
+func TestQueryJobsLikeMemoryStore(t *testing.T) {
+	want, got := openTestServices(t)
+
+	day := jobs.GetFormattedDate
+	queries := []*jobs.JobQuery{
+		{},
+		{CustomerID: "c1"},
+		{CustomerID: jobs.NoCustomer},
+		{Statuses: []string{"new", "paid"}},
+		{OrderedFrom: day("2024-03-02"), OrderedTo: day("2024-03-04")},
+		{DueFrom: day("2024-04-03"), DueTo: day("2024-04-05")},
+		{Overdue: true},
+		{Text: "öl"},
+		{Text: "käbel"},
+		{Text: "österreich"},
+	}
+	for _, sortBy := range []string{"", jobs.SortByOrderDate, jobs.SortByDeadline,
+		jobs.SortByStatus, jobs.SortByCustomer, jobs.SortByTotal} {
+		for _, desc := range []bool{false, true} {
+			queries = append(queries, &jobs.JobQuery{Sort: sortBy, Desc: desc})
+		}
+	}
+	queries = append(queries, &jobs.JobQuery{Sort: jobs.SortByCustomer, Offset: 10, Limit: 7})
+
+	for _, q := range queries {
+		name := q.Values().Encode()
+		wantPage, err := want.QueryJobs(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gotPage, err := got.QueryJobs(q)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !reflect.DeepEqual(jobIDs(gotPage.Jobs), jobIDs(wantPage.Jobs)) || gotPage.Total != wantPage.Total {
+			t.Errorf("%s: got %d of %d jobs %v, want %d of %d jobs %v", name,
+				len(gotPage.Jobs), gotPage.Total, jobIDs(gotPage.Jobs),
+				len(wantPage.Jobs), wantPage.Total, jobIDs(wantPage.Jobs))
+		}
+
+		// Page through the jobs with the cursors of either store.
+		for _, s := range []*jobs.JobService{want, got} {
+			paged := make([]string, 0)
+			query := *q
+			query.Limit, query.Offset = 4, 0
+			for {
+				page, err := s.QueryJobs(&query)
+				if err != nil {
+					t.Fatalf("%s: %v", name, err)
+				}
+				paged = append(paged, jobIDs(page.Jobs)...)
+				if page.NextCursor == "" {
+					break
+				}
+				query.Cursor = page.NextCursor
+			}
+			if q.Limit == 0 && !reflect.DeepEqual(paged, jobIDs(wantPage.Jobs)) {
+				t.Errorf("%s: paged through %v, want %v", name, paged, jobIDs(wantPage.Jobs))
+			}
+		}
+	}
+}
+
+func TestFilterJobsLikeMemoryStore(t *testing.T) {
+	want, got := openTestServices(t)
+	for _, id := range []string{"c1", "c2", "c3", "", "c4"} {
+		wantJobs, err := want.FilterJobs(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gotJobs, err := got.FilterJobs(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Jobs that sortJobs ties on can come in any order.
+		gotIDs, wantIDs := jobIDs(gotJobs), jobIDs(wantJobs)
+		sort.Strings(gotIDs)
+		sort.Strings(wantIDs)
+		if !reflect.DeepEqual(gotIDs, wantIDs) {
+			t.Errorf("jobs of customer %q are %v, want %v", id, gotIDs, wantIDs)
+		}
+	}
+}
+
+func TestSearchSeesChanges(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), JOBS_MANAGER_DB_FILE))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	ss := jobs.NewSearchService(db, db)
+	if err := db.PutJob(&jobs.Job{ID: "j1", Status: "new", Description: "Cables"}); err != nil {
+		t.Fatal(err)
+	}
+	if results, err := ss.Search("cables", 0); err != nil || len(results) != 1 {
+		t.Fatalf("found %d jobs, %v, want 1", len(results), err)
+	}
+	changes := db.Changes()
+	if err := db.DeleteJob("j1"); err != nil {
+		t.Fatal(err)
+	}
+	if db.Changes() == changes {
+		t.Error("deleting a job was not counted as a change")
+	}
+	if results, err := ss.Search("cables", 0); err != nil || len(results) != 0 {
+		t.Errorf("found %d jobs, %v, want none after deleting it", len(results), err)
+	}
+}
+
+func TestMigrateStatusTimes(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), JOBS_MANAGER_DB_FILE))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for _, r := range []struct{ id, status string }{{"j1", "shipped"}, {"j2", ""}} {
+		_, err := db.db.Exec(`INSERT INTO jobs (id, status, order_date, data) VALUES (?, ?, '2024-03-01', ?)`,
+			r.id, r.status, `{"id":"`+r.id+`","status":"`+r.status+`","order_date":"2024-03-01T00:00:00Z"}`)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := migrate(db.db); err != nil {
+		t.Fatal(err)
+	}
+	orderDate := jobs.GetFormattedDate("2024-03-01")
+	for id, status := range map[string]string{"j1": "shipped", "j2": jobs.JobStatusList[0].Key} {
+		j, err := db.GetJob(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if at, ok := j.EnteredStatusAt[status]; len(j.EnteredStatusAt) != 1 || !ok || !at.Equal(*orderDate) {
+			t.Errorf("job %s entered statuses at %v, want %s on its order date", id, j.EnteredStatusAt, status)
+		}
+	}
+}
+
+func jobIDs(jobsList []*jobs.Job) []string {
+	ids := make([]string, len(jobsList))
+	for i, j := range jobsList {
+		ids[i] = j.ID
+	}
+	return ids
+}
@@ -0,0 +1,108 @@
+package jobs
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrNotFound is returned by stores and services when the requested
+// record does not exist.
+var ErrNotFound = errors.New("not found")
+
+// ErrConflict is returned when a change clashes with the current
+// state of the data, e.g. deleting a customer who still has jobs.
+var ErrConflict = errors.New("conflict")
+
+// ErrInvalid is returned when a record is not saved because
+// some of its fields are missing or wrong, see ValidationError.
+var ErrInvalid = errors.New("invalid")
+
+// JobStore persists jobs. PutJobs saves all the jobs it is
+// given at once, or none of them if it fails.
+type JobStore interface {
+	GetJob(id string) (*Job, error)
+	ListJobs() ([]*Job, error)
+	PutJob(j *Job) error
+	PutJobs(jobsList []*Job) error
+	DeleteJob(id string) error
+}
+
+// CustomerStore persists customers. PutCustomers saves all the
+// customers it is given at once, or none of them if it fails.
+type CustomerStore interface {
+	GetCustomer(id string) (*Customer, error)
+	ListCustomers() ([]*Customer, error)
+	PutCustomer(c *Customer) error
+	PutCustomers(csList []*Customer) error
+	DeleteCustomer(id string) error
+}
+
+// JobQuerier is implemented by the stores that can find jobs themselves,
+// such as databases with indexes, rather than have JobService read and
+// check every job. JobService uses it when its store has it.
+type JobQuerier interface {
+	// QueryJobs returns the page of the jobs outside the trash that q
+	// asks for on the day today, without a NextCursor. The jobs are in
+	// the order of their JobQuery sort keys, starting after the key
+	// split into after, if any.
+	QueryJobs(q *JobQuery, after []string, today time.Time) (*JobPage, error)
+	// ListCustomerJobs returns the jobs of the customer customerID,
+	// including the ones in the trash.
+	ListCustomerJobs(customerID string) ([]*Job, error)
+}
+
+// ChangeCounter is implemented by the stores that count their
+// changes, so that what is worked out of their records need only
+// be worked out again once the count went up.
+type ChangeCounter interface {
+	Changes() uint64
+}
+
+// InvoiceStore persists invoices. Invoices are never deleted,
+// so that their numbers stay gap-free.
+type InvoiceStore interface {
+	GetInvoice(id string) (*Invoice, error)
+	ListInvoices() ([]*Invoice, error)
+	PutInvoice(inv *Invoice) error
+}
+
+// QuoteStore persists quotes. Quotes are declined rather than deleted.
+type QuoteStore interface {
+	GetQuote(id string) (*Quote, error)
+	ListQuotes() ([]*Quote, error)
+	PutQuote(q *Quote) error
+}
+
+// PaymentStore persists payments.
+type PaymentStore interface {
+	GetPayment(id string) (*Payment, error)
+	ListPayments() ([]*Payment, error)
+	PutPayment(p *Payment) error
+	DeletePayment(id string) error
+}
+
+// Snapshotter copies all the data of a store into a directory
+// and replaces it with the data previously copied into a directory.
+type Snapshotter interface {
+	Snapshot(dir string) error
+	Restore(dir string) error
+}
+
+// Store persists all the entities of the order manager.
+type Store interface {
+	JobStore
+	CustomerStore
+	InvoiceStore
+	PaymentStore
+	QuoteStore
+	Snapshotter
+}
+
+// Data is all the records kept in a store.
+type Data struct {
+	Jobs      []*Job
+	Customers []*Customer
+	Invoices  []*Invoice
+	Payments  []*Payment
+	Quotes    []*Quote
+}
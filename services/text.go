@@ -0,0 +1,41 @@
+package jobs
+
+import (
+	"encoding/base64"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// DecodeBase64Text returns the text s encodes, if s is the base64
+// encoding of text. Descriptions and notes used to be stored like
+// this, so it tells them apart from the plain text stored since.
+func DecodeBase64Text(s string) (string, bool) {
+	if s == "" {
+		return "", false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil || !utf8.Valid(decoded) {
+		return "", false
+	}
+	for _, r := range string(decoded) {
+		if unicode.IsControl(r) && r != '\n' && r != '\r' && r != '\t' {
+			return "", false
+		}
+	}
+	return string(decoded), true
+}
+
+// migratePlainText returns a migration that decodes the base64
+// encoded text of field, leaving text that is not encoded alone.
+func migratePlainText(field string) func(records []map[string]any) error {
+	return func(records []map[string]any) error {
+		for _, r := range records {
+			s, _ := r[field].(string)
+			if text, ok := DecodeBase64Text(s); ok {
+				r[field] = text
+			}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,32 @@
+package jobs
+
+import (
+	"encoding/base64"
+	"testing"
+)
+
+func TestDecodeBase64Text(t *testing.T) {
+	encode := func(s string) string {
+		return base64.StdEncoding.EncodeToString([]byte(s))
+	}
+	tests := []struct {
+		s    string
+		want string
+		ok   bool
+	}{
+		{encode("Cables\n**two** of them"), "Cables\n**two** of them", true},
+		{encode("Kabel für Österreich\t€12"), "Kabel für Österreich\t€12", true},
+		{" " + encode("Pays late") + "\n", "Pays late", true},
+		{"", "", false},
+		{"Cables", "", false},
+		{"Two cables, one plug", "", false},
+		{encode("\x00\x01binary"), "", false},
+		{encode("\xff\xfe"), "", false},
+	}
+	for _, tt := range tests {
+		got, ok := DecodeBase64Text(tt.s)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("DecodeBase64Text(%q) = %q, %v, want %q, %v", tt.s, got, ok, tt.want, tt.ok)
+		}
+	}
+}
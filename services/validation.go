@@ -0,0 +1,45 @@
+package jobs
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FieldError describes what is wrong with a single field of a record.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists the fields that stop a record from being saved.
+type ValidationError struct {
+	Entity string
+	Fields []*FieldError
+}
+
+func (e *ValidationError) Error() string {
+	problems := make([]string, 0, len(e.Fields))
+	for _, f := range e.Fields {
+		problems = append(problems, fmt.Sprintf("%s %s", f.Field, f.Message))
+	}
+	return fmt.Sprintf("invalid %s: %s", e.Entity, strings.Join(problems, ", "))
+}
+
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrInvalid
+}
+
+func (e *ValidationError) add(field, format string, args ...any) {
+	e.Fields = append(e.Fields, &FieldError{
+		Field:   field,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// err returns e if any field was found to be wrong, nil otherwise.
+func (e *ValidationError) err() error {
+	if len(e.Fields) == 0 {
+		return nil
+	}
+	return e
+}